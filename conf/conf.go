@@ -32,6 +32,7 @@ type (
 		ModelsDir    string                `toml:"models_dir"     yaml:"models_dir"     comment:"\nGoinfer recursively searches GGUF files in one or multiple folders separated by ':'\nList your GGUF dirs with: locate .gguf | sed -e 's,/[^/]*$,,' | uniq\nenv. var: GI_MODELS_DIR"`
 		DefaultModel string                `toml:"default_model"  yaml:"default_model"  comment:"\nThe default model name to load at startup\nCan also be set with: ./goinfer -start <model-name>"`
 		Addr         string                `toml:"addr"           yaml:"addr"           comment:"address can be 'host:port' or 'ip:por' or simply ':port' (for host = localhost)"`
+		LogFormat    string                `toml:"log_format"     yaml:"log_format"     comment:"\nLogs of Goinfer, llama-swap and llama-server: text or json (one object per line)\nenv. var: GI_LOG_FORMAT"`
 	}
 
 	// Llama holds the inference engine settings.
@@ -74,6 +75,7 @@ func DefaultCfg() *Cfg {
 		Host:         "",
 		Origins:      "localhost",
 		Addr:         ":8080",
+		LogFormat:    config.LogFormatText,
 		Llama: Llama{
 			Exe:     "/home/me/llama.cpp/build/bin/llama-server",
 			Verbose: "",
@@ -113,6 +115,7 @@ func (cfg *Cfg) Print() {
 	printEnvVar("GI_ORIGINS", false)
 	printEnvVar("GI_API_KEY", true)
 	printEnvVar("GI_LLAMA_EXE", false)
+	printEnvVar("GI_LOG_FORMAT", false)
 
 	slog.Info("-------------------------------------------")
 
@@ -122,6 +125,11 @@ func (cfg *Cfg) Print() {
 		return
 	}
 
+	if cfg.LogFormat == config.LogFormatJSON {
+		slog.Info("config", "yaml", string(yml)) // keep one JSON object per line
+		return
+	}
+
 	_, err = os.Stdout.Write(yml)
 	if err != nil {
 		slog.Error("Failed Write(yml)", "err", err, "content", string(yml[:200]))
@@ -176,6 +184,11 @@ func (cfg *Cfg) validate(noAPIKey bool) error {
 		return gerr.New(gerr.ConfigErr, "GI_LLAMA_EXE or 'exe' in goinfer.ini: must be a file, not a directory", "exe", cfg.Llama.Exe)
 	}
 
+	// GI_LOG_FORMAT
+	if cfg.LogFormat != config.LogFormatText && cfg.LogFormat != config.LogFormatJSON {
+		return gerr.New(gerr.ConfigErr, "GI_LOG_FORMAT or 'log_format' in goinfer.ini: must be text or json", "log_format", cfg.LogFormat)
+	}
+
 	// API key
 	if noAPIKey {
 		slog.Info("Flag -no-api-key => Do not verify API key.")
@@ -188,6 +188,18 @@ func TestCfg_UnmarshalAndValidate(t *testing.T) {
 	if err == nil {
 		t.Fatalf("expected validation error for missing admin API key")
 	}
+
+	// Only text and json log formats.
+	cfg.LogFormat = "xml"
+	err = cfg.validate(false)
+	if err == nil {
+		t.Fatalf("expected validation error for log_format=xml")
+	}
+	cfg.LogFormat = "json"
+	err = cfg.validate(false)
+	if err != nil {
+		t.Fatalf("validation3 error: %v", err)
+	}
 }
 
 // TestCfg_ConcurrentReadMainCfg runs ReadMainCfg concurrently.
@@ -174,6 +174,11 @@ func (cfg *Cfg) applyEnvVars() {
 		slog.Debug("use", "GI_LLAMA_EXE", exe)
 	}
 
+	if format := os.Getenv("GI_LOG_FORMAT"); format != "" {
+		cfg.LogFormat = format
+		slog.Debug("use", "GI_LOG_FORMAT", format)
+	}
+
 	// TODO add GI_LLAMA_ARGS_xxxxxx
 }
 
@@ -214,6 +219,8 @@ func (cfg *Cfg) trimParamValues() {
 	cfg.Origins = strings.TrimSpace(cfg.Origins)
 	cfg.Origins = strings.Trim(cfg.Origins, ",")
 
+	cfg.LogFormat = strings.ToLower(strings.TrimSpace(cfg.LogFormat))
+
 	cfg.Llama.Exe = strings.TrimSpace(cfg.Llama.Exe)
 	cfg.Llama.Verbose = strings.TrimSpace(cfg.Llama.Verbose)
 	cfg.Llama.Debug = strings.TrimSpace(cfg.Llama.Debug)
@@ -10,6 +10,7 @@ import (
 	"math"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 
@@ -22,8 +23,18 @@ import (
 const (
 	LlamaSwapYML    = "llama-swap.yml"
 	useModelPresets = true
+
+	// modelsPresetRouter is the model ID of `llama-server --models-preset models.ini`.
+	modelsPresetRouter = "use-models-preset"
+
+	// hfStartupTimeout is the startup timeout (seconds) of the models downloaded by llama-server -hf.
+	hfStartupTimeout = 2 * 3600
 )
 
+// runtimeHealthCheck probes /health every 30 seconds once llama-server is Ready,
+// a wedged llama-server is restarted after 3 probes without response within 10 seconds.
+var runtimeHealthCheck = config.ModelHealthCheck{Interval: 30, Timeout: 10, FailureThreshold: 3}
+
 // ReadSwapFromReader uses the LoadConfigFromReader() from llama-swap project.
 func (cfg *Cfg) ReadSwapFromReader(r io.Reader) error {
 	swap, err := config.LoadConfigFromReader(r)
@@ -66,11 +77,13 @@ func (cfg *Cfg) GenLlamaSwapYAML(verbose, debug bool) ([]byte, error) {
 		cfg.Swap.LogToStdout = config.LogToStdoutUpstream
 		cfg.Swap.LogTimeFormat = time.DateTime
 	}
+	cfg.Swap.LogFormat = cfg.LogFormat
 
-	// HealthCheckTimeout has some limitations:
-	// - "llama-server -hf model-name" is nice to ease deployment, but may take one or two hours for very large models (200GB+)
+	// HealthCheckTimeout is the default startup timeout:
 	// - very large models (480B) need minutes to initialize their tensors
-	// - startup time is different from runtime health check (TODO: different check during startup)
+	// - "llama-server -hf model-name" may take one or two hours for very large models (200GB+),
+	//   these models get their own startupTimeout (see addModelCfg)
+	// - once Ready, the runtime liveness probes use the healthCheck settings (see runtimeHealthCheck)
 	cfg.Swap.HealthCheckTimeout = 300 // 5 minutes to initialize 480B model
 	cfg.Swap.MetricsMaxInMemory = 500
 	cfg.Swap.StartPort = 5800
@@ -205,14 +218,46 @@ func (cfg *Cfg) setModelPresets() {
 		clear(cfg.Swap.Models)
 	}
 
-	cfg.Swap.Models["use-models-preset"] = &config.ModelConfig{
+	cfg.Swap.Models[modelsPresetRouter] = &config.ModelConfig{
 		Cmd:           "${cmd-common} --models-preset " + ModelsINI,
 		CheckEndpoint: "/health",
 		Proxy:         "http://localhost:${PORT}",
+		HealthCheck:   runtimeHealthCheck,
+		Unlisted:      true, // the presets are listed instead
+	}
+
+	// each preset of models.ini is a model loaded/unloaded through the router API,
+	// so /running, /api/models, TTLs, unload and metrics work per preset
+	info := cfg.getInfo()
+	presets := make([]string, 0, len(info))
+	for model := range info {
+		presets = append(presets, model)
+		if agentSmith {
+			presets = append(presets, model+plusA)
+		}
+	}
+	slices.Sort(presets)
+	for _, preset := range presets {
+		cfg.Swap.Models[preset] = &config.ModelConfig{
+			Router:      modelsPresetRouter,
+			HealthCheck: runtimeHealthCheck,
+			Unlisted:    strings.HasSuffix(preset, plusA),
+		}
+	}
+
+	// the router is never swapped out by its presets,
+	// the presets run concurrently within the limits of the router (--models-max)
+	cfg.Swap.Groups = map[string]config.GroupConfig{
+		"router":  {Members: []string{modelsPresetRouter}, Persistent: true},
+		"presets": {Members: presets, Swap: false, Exclusive: false},
 	}
 
 	// on startup, Goinfer automatically runs `llama-server --models-preset models.ini`
-	cfg.Swap.Hooks.OnStartup.Preload = []string{"use-models-preset"}
+	cfg.Swap.Hooks.OnStartup.Preload = []string{modelsPresetRouter}
+	if _, ok := info[cfg.DefaultModel]; ok {
+		// load-on-startup in models.ini: sync the state of the default preset
+		cfg.Swap.Hooks.OnStartup.Preload = append(cfg.Swap.Hooks.OnStartup.Preload, cfg.DefaultModel)
+	}
 }
 
 func (cfg *Cfg) setSwapModels() {
@@ -225,7 +270,7 @@ func (cfg *Cfg) setSwapModels() {
 		cfg.Swap.Models = make(map[string]*config.ModelConfig, 2*len(info)+9)
 	}
 
-	commonMC := config.ModelConfig{Proxy: "http://localhost:${PORT}", CheckEndpoint: "/health"}
+	commonMC := config.ModelConfig{Proxy: "http://localhost:${PORT}", CheckEndpoint: "/health", HealthCheck: runtimeHealthCheck}
 	fimMC := commonMC
 	goinferMC := commonMC
 	fimMC.Proxy = "http://localhost:8012" // the flag --fim-qwen-xxxx sets port=8012
@@ -273,11 +318,10 @@ func (cfg *Cfg) addModelCfg(model, cmd, flags string, mc *config.ModelConfig) {
 	nMC.Cmd = cmd
 	if flags != "" {
 		nMC.Cmd += " " + flags
-		if strings.Contains(flags, " -hf ") {
-			// -hf may download a model for a while
-			// but /health check will stop it,
-			// so better to disable /health check
-			nMC.CheckEndpoint = "none"
+		if hasHFFlag(flags) {
+			// -hf may download a model for a while:
+			// keep the /health check but wait much longer during startup
+			nMC.StartupTimeout = hfStartupTimeout
 		}
 	}
 
@@ -289,6 +333,16 @@ func (cfg *Cfg) addModelCfg(model, cmd, flags string, mc *config.ModelConfig) {
 	cfg.Swap.Models[model] = &nMC
 }
 
+// hasHFFlag reports whether the command line downloads the model from HuggingFace (-hf or --hf-repo).
+func hasHFFlag(flags string) bool {
+	for _, f := range strings.Fields(flags) {
+		if f == "-hf" || f == "--hf-repo" || strings.HasPrefix(f, "--hf-repo=") {
+			return true
+		}
+	}
+	return false
+}
+
 // Add the model settings within the llama-swap configuration.
 func merge(old, mc *config.ModelConfig, newFlags string) {
 	if reflect.DeepEqual(old.Cmd, mc.Cmd) {
@@ -306,8 +360,8 @@ func merge(old, mc *config.ModelConfig, newFlags string) {
 		return
 	}
 
-	oH := strings.Contains(old.Cmd, " -hf ")
-	nH := strings.Contains(newFlags, "-hf ")
+	oH := hasHFFlag(old.Cmd)
+	nH := hasHFFlag(newFlags)
 	oM := strings.Contains(old.Cmd, " -m ")
 	nM := strings.Contains(newFlags, "-m ")
 
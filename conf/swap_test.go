@@ -0,0 +1,29 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package conf
+
+import "testing"
+
+func Test_hasHFFlag(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"-hf ggml-org/gpt-oss-120b-GGUF", true},
+		{"${cmd-common} --ctx-size 0 --hf-repo ggml-org/gpt-oss-120b-GGUF", true},
+		{"--hf-repo=ggml-org/gpt-oss-120b-GGUF", true},
+		{"--foo-hf x -m model.gguf", false},
+		{"-m /models/hf/model.gguf", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			t.Parallel()
+			if got := hasHFFlag(tt.in); got != tt.want {
+				t.Errorf("hasHFFlag(%s) -> %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/lynxai-team/garcon/vv"
 	"github.com/lynxai-team/goinfer/proxy"
+	"github.com/lynxai-team/goinfer/proxy/config"
 
 	"github.com/lynxai-team/goinfer/conf"
 )
@@ -48,17 +49,22 @@ func getCfg() *conf.Cfg {
 		*updateModelsINI = true
 	}
 
+	level := slog.LevelWarn
 	switch {
 	case *debug:
-		slog.SetLogLoggerLevel(slog.LevelDebug)
+		level = slog.LevelDebug
 	case verbose:
-		slog.SetLogLoggerLevel(slog.LevelInfo)
-	default:
-		slog.SetLogLoggerLevel(slog.LevelWarn)
+		level = slog.LevelInfo
 	}
+	slog.SetLogLoggerLevel(level)
 
 	cfg := doGoinferINI(*debug, *writeAll, *run, *noAPIKey, *extra, *start)
 
+	if cfg.LogFormat == config.LogFormatJSON {
+		// same keys (time, level, msg) as the JSON lines of the proxy and upstream logs
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	}
+
 	if *writeAll || verbose {
 		cfg.Print()
 	}
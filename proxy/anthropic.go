@@ -0,0 +1,460 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// anthropicMessages serves /v1/messages: forwarded as is, or translated to /v1/chat/completions
+// when the model (or its peer) sets translateMessages.
+func (pm *ProxyManager) anthropicMessages(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		anthropicError(c, http.StatusBadRequest, "could not read request body")
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	requestedModel := gjson.GetBytes(body, "model").String()
+	if !pm.translateMessages(requestedModel) {
+		pm.ProxyInferenceHandler(c)
+		return
+	}
+
+	chat, err := anthropicToChat(body)
+	if err != nil {
+		anthropicError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	aw := &anthropicWriter{model: requestedModel, index: -1}
+	aw.translateWriter = newTranslateWriter(c.Writer, aw.event)
+	pm.proxyTranslated(c, "/v1/chat/completions", chat, &aw.translateWriter)
+	aw.finish()
+}
+
+// translateMessages reports whether the Anthropic requests to the model are translated.
+func (pm *ProxyManager) translateMessages(requestedModel string) bool {
+	if modelID, found := pm.cfg.Swap.RealModelName(requestedModel); found {
+		return pm.cfg.Swap.Models[modelID].TranslateMessages
+	}
+	if pm.peerProxy != nil && pm.peerProxy.HasPeerModel(requestedModel) {
+		return pm.cfg.Swap.Peers[pm.peerProxy.PeerID(requestedModel)].TranslateMessages
+	}
+	return false
+}
+
+// anthropicError sends an error in the format of the Anthropic API.
+func anthropicError(c *gin.Context, status int, message string) {
+	c.JSON(status, anthropicErrorBody(status, message))
+}
+
+func anthropicErrorBody(status int, message string) gin.H {
+	errType := "api_error"
+	switch status {
+	case http.StatusBadRequest:
+		errType = "invalid_request_error"
+	case http.StatusUnauthorized:
+		errType = "authentication_error"
+	case http.StatusForbidden:
+		errType = "permission_error"
+	case http.StatusNotFound:
+		errType = "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		errType = "request_too_large"
+	case http.StatusTooManyRequests:
+		errType = "rate_limit_error"
+	case http.StatusServiceUnavailable, 529:
+		errType = "overloaded_error"
+	}
+	return gin.H{"type": "error", "error": gin.H{"type": errType, "message": message}}
+}
+
+// anthropicToChat converts an Anthropic Messages request to an OpenAI chat completions request.
+func anthropicToChat(body []byte) ([]byte, error) {
+	if !gjson.ValidBytes(body) {
+		return nil, errors.New("invalid request body")
+	}
+	req := gjson.ParseBytes(body)
+
+	messages := []map[string]any{}
+	if system := anthropicText(req.Get("system")); system != "" {
+		messages = append(messages, map[string]any{"role": "system", "content": system})
+	}
+	for _, msg := range req.Get("messages").Array() {
+		converted, err := anthropicMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, converted...)
+	}
+
+	chat := map[string]any{"model": req.Get("model").String(), "messages": messages}
+	if v := req.Get("max_tokens"); v.Exists() {
+		chat["max_tokens"] = v.Int()
+	}
+	for _, key := range []string{"temperature", "top_p", "top_k"} {
+		if v := req.Get(key); v.Exists() {
+			chat[key] = v.Value()
+		}
+	}
+	if v := req.Get("stop_sequences"); v.IsArray() {
+		chat["stop"] = v.Value()
+	}
+	if v := req.Get("metadata.user_id"); v.Exists() {
+		chat["user"] = v.String()
+	}
+	if req.Get("stream").Bool() {
+		chat["stream"] = true
+		chat["stream_options"] = map[string]any{"include_usage": true}
+	}
+	switch req.Get("thinking.type").String() {
+	case "enabled":
+		chat["chat_template_kwargs"] = map[string]any{"enable_thinking": true}
+	case "disabled":
+		chat["chat_template_kwargs"] = map[string]any{"enable_thinking": false}
+	}
+
+	var tools []map[string]any
+	for _, tool := range req.Get("tools").Array() {
+		if t := tool.Get("type").String(); t != "" && t != "custom" {
+			return nil, fmt.Errorf("unsupported tool type %q", t)
+		}
+		parameters := json.RawMessage(`{"type":"object"}`)
+		if schema := tool.Get("input_schema"); schema.IsObject() {
+			parameters = json.RawMessage(schema.Raw)
+		}
+		function := map[string]any{"name": tool.Get("name").String(), "parameters": parameters}
+		if d := tool.Get("description"); d.Exists() {
+			function["description"] = d.String()
+		}
+		tools = append(tools, map[string]any{"type": "function", "function": function})
+	}
+	if tools != nil {
+		chat["tools"] = tools
+	}
+	if choice := req.Get("tool_choice"); choice.Exists() {
+		switch choice.Get("type").String() {
+		case "auto":
+			chat["tool_choice"] = "auto"
+		case "any":
+			chat["tool_choice"] = "required"
+		case "none":
+			chat["tool_choice"] = "none"
+		case "tool":
+			chat["tool_choice"] = map[string]any{"type": "function", "function": map[string]any{"name": choice.Get("name").String()}}
+		}
+		if choice.Get("disable_parallel_tool_use").Bool() {
+			chat["parallel_tool_calls"] = false
+		}
+	}
+
+	return json.Marshal(chat)
+}
+
+// anthropicMessage converts a message to chat messages: the tool results
+// are tool messages placed before the rest of the user content.
+func anthropicMessage(msg gjson.Result) ([]map[string]any, error) {
+	role := msg.Get("role").String()
+	content := msg.Get("content")
+	if !content.IsArray() {
+		return []map[string]any{{"role": role, "content": content.String()}}, nil
+	}
+
+	var messages []map[string]any
+	var parts []map[string]any
+	var text, thinking strings.Builder
+	var toolCalls []map[string]any
+	for _, block := range content.Array() {
+		switch t := block.Get("type").String(); t {
+		case "text":
+			text.WriteString(block.Get("text").String())
+			parts = append(parts, map[string]any{"type": "text", "text": block.Get("text").String()})
+		case "image":
+			url := block.Get("source.url").String()
+			if block.Get("source.type").String() == "base64" {
+				url = "data:" + block.Get("source.media_type").String() + ";base64," + block.Get("source.data").String()
+			}
+			parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}})
+		case "thinking":
+			thinking.WriteString(block.Get("thinking").String())
+		case "redacted_thinking":
+		case "tool_use":
+			arguments := block.Get("input").Raw
+			if arguments == "" {
+				arguments = "{}"
+			}
+			toolCalls = append(toolCalls, map[string]any{
+				"id":       block.Get("id").String(),
+				"type":     "function",
+				"function": map[string]any{"name": block.Get("name").String(), "arguments": arguments},
+			})
+		case "tool_result":
+			result := anthropicText(block.Get("content"))
+			if block.Get("is_error").Bool() {
+				result = "Error: " + result
+			}
+			messages = append(messages, map[string]any{"role": "tool", "tool_call_id": block.Get("tool_use_id").String(), "content": result})
+		default:
+			return nil, fmt.Errorf("unsupported content block type %q", t)
+		}
+	}
+
+	if role == "assistant" {
+		m := map[string]any{"role": role, "content": text.String()}
+		if thinking.Len() > 0 {
+			m["reasoning_content"] = thinking.String()
+		}
+		if toolCalls != nil {
+			m["tool_calls"] = toolCalls
+		}
+		return append(messages, m), nil
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0]["type"] == "text":
+		messages = append(messages, map[string]any{"role": role, "content": text.String()})
+	case len(parts) > 0:
+		messages = append(messages, map[string]any{"role": role, "content": parts})
+	}
+	return messages, nil
+}
+
+// anthropicText returns a string content, or the text of its text blocks.
+func anthropicText(content gjson.Result) string {
+	if !content.IsArray() {
+		return content.String()
+	}
+	var texts []string
+	for _, block := range content.Array() {
+		if block.Get("type").String() == "text" {
+			texts = append(texts, block.Get("text").String())
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// anthropicStopReason converts an OpenAI finish reason.
+func anthropicStopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls":
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
+
+// anthropicID derives the message ID from the chat completion ID.
+func anthropicID(id string) string {
+	return "msg_" + strings.TrimPrefix(id, "chatcmpl-")
+}
+
+// anthropicWriter translates the chat completions responses to the Anthropic format.
+// The stream is converted to content blocks: thinking, text and tool_use.
+type anthropicWriter struct {
+	translateWriter
+	model        string // as requested
+	finishReason string
+	blockType    string // of the open block, empty when none
+	toolIndex    int64  // OpenAI index of the open tool_use block
+	index        int    // of the last block
+	inputTokens  int64
+	outputTokens int64
+	started      bool // message_start sent
+	done         bool // message_stop sent
+}
+
+// event translates an SSE event of the upstream stream.
+func (aw *anthropicWriter) event(data []byte) {
+	if bytes.Equal(data, []byte("[DONE]")) {
+		aw.stop()
+		return
+	}
+	if aw.done || !gjson.ValidBytes(data) {
+		return
+	}
+
+	chunk := gjson.ParseBytes(data)
+	if e := chunk.Get("error"); e.Exists() {
+		aw.writeEvent("error", anthropicErrorBody(http.StatusInternalServerError, errorMessage(e)))
+		aw.done = true
+		return
+	}
+	if !aw.started {
+		aw.started = true
+		aw.writeEvent("message_start", gin.H{"type": "message_start", "message": gin.H{
+			"id":            anthropicID(chunk.Get("id").String()),
+			"type":          "message",
+			"role":          "assistant",
+			"model":         aw.model,
+			"content":       []any{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         gin.H{"input_tokens": 0, "output_tokens": 0},
+		}})
+	}
+	if usage := chunk.Get("usage"); usage.IsObject() {
+		aw.inputTokens = usage.Get("prompt_tokens").Int()
+		aw.outputTokens = usage.Get("completion_tokens").Int()
+	}
+
+	choice := chunk.Get("choices.0")
+	delta := choice.Get("delta")
+	if s := delta.Get("reasoning_content").String(); s != "" {
+		aw.block("thinking", 0, nil)
+		aw.delta(gin.H{"type": "thinking_delta", "thinking": s})
+	}
+	if s := delta.Get("content").String(); s != "" {
+		aw.block("text", 0, nil)
+		aw.delta(gin.H{"type": "text_delta", "text": s})
+	}
+	for _, tc := range delta.Get("tool_calls").Array() {
+		toolIndex := tc.Get("index").Int()
+		if aw.blockType != "tool_use" || aw.toolIndex != toolIndex || tc.Get("id").String() != "" {
+			aw.block("tool_use", toolIndex, gin.H{
+				"type":  "tool_use",
+				"id":    tc.Get("id").String(),
+				"name":  tc.Get("function.name").String(),
+				"input": gin.H{},
+			})
+		}
+		if args := tc.Get("function.arguments").String(); args != "" {
+			aw.delta(gin.H{"type": "input_json_delta", "partial_json": args})
+		}
+	}
+	if fr := choice.Get("finish_reason").String(); fr != "" {
+		aw.finishReason = fr
+	}
+}
+
+// block opens a content block of the given type, closing the previous one when it differs.
+func (aw *anthropicWriter) block(blockType string, toolIndex int64, contentBlock gin.H) {
+	if aw.blockType == blockType && contentBlock == nil {
+		return
+	}
+	aw.closeBlock()
+	if contentBlock == nil {
+		contentBlock = gin.H{"type": blockType, blockType: ""}
+		if blockType == "thinking" {
+			contentBlock["signature"] = ""
+		}
+	}
+	aw.index++
+	aw.blockType = blockType
+	aw.toolIndex = toolIndex
+	aw.writeEvent("content_block_start", gin.H{"type": "content_block_start", "index": aw.index, "content_block": contentBlock})
+}
+
+func (aw *anthropicWriter) closeBlock() {
+	if aw.blockType != "" {
+		aw.writeEvent("content_block_stop", gin.H{"type": "content_block_stop", "index": aw.index})
+		aw.blockType = ""
+	}
+}
+
+func (aw *anthropicWriter) delta(delta gin.H) {
+	aw.writeEvent("content_block_delta", gin.H{"type": "content_block_delta", "index": aw.index, "delta": delta})
+}
+
+// stop ends the stream with the stop reason and the usage.
+func (aw *anthropicWriter) stop() {
+	if aw.done || !aw.started {
+		return
+	}
+	aw.done = true
+	aw.closeBlock()
+	aw.writeEvent("message_delta", gin.H{
+		"type":  "message_delta",
+		"delta": gin.H{"stop_reason": anthropicStopReason(aw.finishReason), "stop_sequence": nil},
+		"usage": gin.H{"input_tokens": aw.inputTokens, "output_tokens": aw.outputTokens},
+	})
+	aw.writeEvent("message_stop", gin.H{"type": "message_stop"})
+}
+
+// writeEvent sends an SSE event to the client.
+func (aw *anthropicWriter) writeEvent(event string, data gin.H) {
+	if !aw.ResponseWriter.Written() {
+		aw.ResponseWriter.Header().Set("Cache-Control", "no-cache")
+		aw.writeHeader(http.StatusOK, "text/event-stream")
+	}
+	b, _ := json.Marshal(data)
+	fmt.Fprintf(aw.ResponseWriter, "event: %s\ndata: %s\n\n", event, b)
+	aw.ResponseWriter.Flush()
+}
+
+// finish sends the translation of the buffered response, or ends the stream.
+func (aw *anthropicWriter) finish() {
+	if aw.sse {
+		aw.endStream()
+		aw.stop()
+		return
+	}
+
+	status := aw.Status()
+	body := aw.body.Bytes()
+	if status != http.StatusOK {
+		msg := strings.TrimSpace(string(body))
+		if gjson.ValidBytes(body) {
+			msg = errorMessage(gjson.GetBytes(body, "error"))
+		}
+		aw.writeJSON(status, anthropicErrorBody(status, msg))
+		return
+	}
+	if !gjson.ValidBytes(body) {
+		aw.writeJSON(http.StatusBadGateway, anthropicErrorBody(http.StatusBadGateway, "invalid upstream response: "+string(body)))
+		return
+	}
+
+	resp := gjson.ParseBytes(body)
+	message := resp.Get("choices.0.message")
+	content := []gin.H{}
+	if s := message.Get("reasoning_content").String(); s != "" {
+		content = append(content, gin.H{"type": "thinking", "thinking": s, "signature": ""})
+	}
+	if s := message.Get("content").String(); s != "" {
+		content = append(content, gin.H{"type": "text", "text": s})
+	}
+	for _, tc := range message.Get("tool_calls").Array() {
+		input := json.RawMessage(tc.Get("function.arguments").String())
+		if !json.Valid(input) {
+			input = json.RawMessage("{}")
+		}
+		content = append(content, gin.H{"type": "tool_use", "id": tc.Get("id").String(), "name": tc.Get("function.name").String(), "input": input})
+	}
+	aw.writeJSON(http.StatusOK, gin.H{
+		"id":            anthropicID(resp.Get("id").String()),
+		"type":          "message",
+		"role":          "assistant",
+		"model":         aw.model,
+		"content":       content,
+		"stop_reason":   anthropicStopReason(resp.Get("choices.0.finish_reason").String()),
+		"stop_sequence": nil,
+		"usage": gin.H{
+			"input_tokens":  resp.Get("usage.prompt_tokens").Int(),
+			"output_tokens": resp.Get("usage.completion_tokens").Int(),
+		},
+	})
+}
+
+func (aw *anthropicWriter) writeJSON(status int, resp gin.H) {
+	if aw.ResponseWriter.Written() { // the stream has started
+		aw.writeEvent("error", resp)
+		return
+	}
+	b, _ := json.Marshal(resp)
+	aw.writeResponse(status, "application/json", b)
+}
@@ -0,0 +1,186 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestAnthropic_ToChat(t *testing.T) {
+	body, err := anthropicToChat([]byte(`{
+		"model": "model1",
+		"max_tokens": 100,
+		"system": [{"type":"text","text":"be brief"}],
+		"messages": [
+			{"role":"user","content":[{"type":"text","text":"look"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBO"}}]},
+			{"role":"assistant","content":[{"type":"thinking","thinking":"hmm","signature":"x"},{"type":"text","text":"reading"},{"type":"tool_use","id":"tu_1","name":"read","input":{"path":"a"}}]},
+			{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu_1","content":[{"type":"text","text":"42"}]},{"type":"text","text":"and?"}]},
+			{"role":"assistant","content":"done"}
+		],
+		"tools": [{"name":"read","description":"read a file","input_schema":{"type":"object"}}],
+		"tool_choice": {"type":"any","disable_parallel_tool_use":true},
+		"stop_sequences": ["END"],
+		"temperature": 0.5,
+		"thinking": {"type":"enabled","budget_tokens":1024},
+		"metadata": {"user_id":"bob"},
+		"stream": true
+	}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"model": "model1",
+		"max_tokens": 100,
+		"messages": [
+			{"role":"system","content":"be brief"},
+			{"role":"user","content":[{"type":"text","text":"look"},{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBO"}}]},
+			{"role":"assistant","content":"reading","reasoning_content":"hmm","tool_calls":[{"id":"tu_1","type":"function","function":{"name":"read","arguments":"{\"path\":\"a\"}"}}]},
+			{"role":"tool","tool_call_id":"tu_1","content":"42"},
+			{"role":"user","content":"and?"},
+			{"role":"assistant","content":"done"}
+		],
+		"tools": [{"type":"function","function":{"name":"read","description":"read a file","parameters":{"type":"object"}}}],
+		"tool_choice": "required",
+		"parallel_tool_calls": false,
+		"stop": ["END"],
+		"temperature": 0.5,
+		"chat_template_kwargs": {"enable_thinking": true},
+		"user": "bob",
+		"stream": true,
+		"stream_options": {"include_usage": true}
+	}`, string(body))
+
+	_, err = anthropicToChat([]byte(`{"model":"m","messages":[{"role":"user","content":[{"type":"document"}]}]}`))
+	assert.EqualError(t, err, `unsupported content block type "document"`)
+	_, err = anthropicToChat([]byte(`{"model":"m","messages":[],"tools":[{"type":"web_search_20250305","name":"web_search"}]}`))
+	assert.EqualError(t, err, `unsupported tool type "web_search_20250305"`)
+}
+
+func TestProxyManager_AnthropicMessages(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]string{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received[r.URL.Path] = string(body)
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/v1/messages":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"type":"message","native":true}`))
+		case gjson.GetBytes(body, "max_tokens").Int() == 1:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":400,"message":"context too small","type":"invalid_request_error"}}`))
+		case gjson.GetBytes(body, "stream").Bool():
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{
+				`{"id":"chatcmpl-7","choices":[{"delta":{"reasoning_content":"hmm"}}]}`,
+				`{"id":"chatcmpl-7","choices":[{"delta":{"content":"Let me read"}}]}`,
+				`{"id":"chatcmpl-7","choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"read","arguments":"{\"pa"}}]}}]}`,
+				`{"id":"chatcmpl-7","choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":1}"}}]}}]}`,
+				`{"id":"chatcmpl-7","choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+				`{"id":"chatcmpl-7","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5}}`,
+				`[DONE]`,
+			} {
+				w.Write([]byte("data: " + chunk + "\n\n"))
+				w.(http.Flusher).Flush()
+			}
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"chatcmpl-8","choices":[{"message":{"content":"Hello","reasoning_content":"hmm","tool_calls":[{"id":"call_2","function":{"name":"ls","arguments":"{\"dir\":\"/\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":3}}`))
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": {Proxy: upstream.URL, CheckEndpoint: "/health", TranslateMessages: true},
+			"model2": {Proxy: upstream.URL, CheckEndpoint: "/health"},
+		},
+		LogLevel: "error",
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	post := func(body string) *TestResponseRecorder {
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body)))
+		return w
+	}
+
+	// forwarded as is
+	w := post(`{"model":"model2","max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"type":"message","native":true}`, w.Body.String())
+
+	// translated, not streamed
+	w = post(`{"model":"model1","max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{
+		"id": "msg_8",
+		"type": "message",
+		"role": "assistant",
+		"model": "model1",
+		"content": [
+			{"type":"thinking","thinking":"hmm","signature":""},
+			{"type":"text","text":"Hello"},
+			{"type":"tool_use","id":"call_2","name":"ls","input":{"dir":"/"}}
+		],
+		"stop_reason": "tool_use",
+		"stop_sequence": null,
+		"usage": {"input_tokens":10,"output_tokens":3}
+	}`, w.Body.String())
+	mu.Lock()
+	assert.JSONEq(t, `{"model":"model1","max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`, received["/v1/chat/completions"])
+	mu.Unlock()
+
+	// translated, streamed
+	w = post(`{"model":"model1","max_tokens":10,"stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	var events []string
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if data, found := strings.CutPrefix(line, "data: "); found {
+			events = append(events, data)
+		}
+	}
+	require.Len(t, events, 13, w.Body.String())
+	assert.JSONEq(t, `{"type":"message_start","message":{"id":"msg_7","type":"message","role":"assistant","model":"model1","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}}`, events[0])
+	assert.JSONEq(t, `{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":"","signature":""}}`, events[1])
+	assert.JSONEq(t, `{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hmm"}}`, events[2])
+	assert.JSONEq(t, `{"type":"content_block_stop","index":0}`, events[3])
+	assert.JSONEq(t, `{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`, events[4])
+	assert.JSONEq(t, `{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Let me read"}}`, events[5])
+	assert.JSONEq(t, `{"type":"content_block_stop","index":1}`, events[6])
+	assert.JSONEq(t, `{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"call_1","name":"read","input":{}}}`, events[7])
+	assert.JSONEq(t, `{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"pa"}}`, events[8])
+	assert.JSONEq(t, `{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"th\":1}"}}`, events[9])
+	assert.JSONEq(t, `{"type":"content_block_stop","index":2}`, events[10])
+	assert.Contains(t, w.Body.String(), "event: message_delta\n"+`data: {"delta":{"stop_reason":"tool_use","stop_sequence":null},"type":"message_delta","usage":{"input_tokens":12,"output_tokens":5}}`)
+	assert.Contains(t, w.Body.String(), "event: message_stop\n")
+
+	// upstream and request errors
+	w = post(`{"model":"model1","max_tokens":1,"messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"type":"error","error":{"type":"invalid_request_error","message":"context too small"}}`, w.Body.String())
+
+	w = post(`{"model":"model1","messages":[{"role":"user","content":[{"type":"document"}]}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_request_error", gjson.Get(w.Body.String(), "error.type").String())
+}
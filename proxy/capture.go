@@ -0,0 +1,572 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// captureIDHeader gives the capture of the response to the client, see /api/captures/<id>.
+const captureIDHeader = "X-Capture-ID"
+
+const redacted = "[REDACTED]"
+
+// redactedHeaders are never kept in the captures.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "X-Api-Key", "Cookie", "Set-Cookie"}
+
+// Capture is a request sent upstream, after the model name rewriting and the
+// parameters stripping, with the response received by the client.
+type Capture struct {
+	Time           time.Time          `json:"time"`
+	Assembled      *assembledResponse `json:"assembled,omitempty"` // streaming responses only
+	RequestID      string             `json:"request_id,omitempty"`
+	Model          string             `json:"model"`           // model ID
+	RequestedModel string             `json:"requested_model"` // as sent by the client (may be an alias)
+	Peer           string             `json:"peer,omitempty"`
+	Method         string             `json:"method"`
+	Path           string             `json:"path"`
+	Error          string             `json:"error,omitempty"` // the request failed before the response
+	Request        captureMessage     `json:"request"`
+	Response       captureMessage     `json:"response"`
+	ID             int                `json:"id"`
+	ReplayOf       int                `json:"replay_of,omitempty"` // ID of the replayed capture
+	DurationMs     int                `json:"duration_ms"`
+}
+
+// captureMessage is a request or a response, the body is truncated beyond captures.maxBodyKB.
+type captureMessage struct {
+	Header    http.Header `json:"header"`
+	Body      string      `json:"body"`
+	Status    int         `json:"status,omitempty"`
+	Size      int         `json:"size"` // before truncation
+	Truncated bool        `json:"truncated,omitempty"`
+	Redacted  bool        `json:"redacted,omitempty"` // of the body
+}
+
+// captureSummary is a Capture without headers and bodies, for /api/captures.
+type captureSummary struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Model      string    `json:"model"`
+	Path       string    `json:"path"`
+	Error      string    `json:"error,omitempty"`
+	ID         int       `json:"id"`
+	Status     int       `json:"status"`
+	DurationMs int       `json:"duration_ms"`
+}
+
+// captureStore keeps the last captures in memory.
+type captureStore struct {
+	models   map[string]bool // model IDs, nil captures all
+	fields   []string
+	patterns []*regexp.Regexp
+	captures []Capture
+	max      int
+	maxBody  int
+	nextID   int
+	mu       sync.RWMutex
+}
+
+// newCaptureStore returns nil when the captures are disabled.
+func newCaptureStore(cfg *config.Config) *captureStore {
+	cc := cfg.Captures
+	if !cc.Enabled {
+		return nil
+	}
+
+	cs := &captureStore{
+		fields:  cc.RedactFields,
+		max:     cc.MaxCaptures,
+		maxBody: cc.MaxBodyKB << 10,
+		nextID:  1,
+	}
+	if len(cc.Models) > 0 {
+		cs.models = make(map[string]bool, len(cc.Models))
+		for _, name := range cc.Models {
+			if modelID, found := cfg.RealModelName(name); found {
+				cs.models[modelID] = true
+			}
+		}
+	}
+	for _, pattern := range cc.RedactPatterns {
+		cs.patterns = append(cs.patterns, regexp.MustCompile(pattern)) // validated by LoadConfig
+	}
+	return cs
+}
+
+// enabled reports if the requests of the model are captured.
+func (cs *captureStore) enabled(modelID string) bool {
+	return cs != nil && (cs.models == nil || cs.models[modelID])
+}
+
+// wrap returns the handler capturing the request body and the response of next.
+func (cs *captureStore) wrap(requestedModel string, body []byte,
+	next func(modelID string, w http.ResponseWriter, r *http.Request) error,
+) func(modelID string, w http.ResponseWriter, r *http.Request) error {
+	return func(modelID string, w http.ResponseWriter, r *http.Request) error {
+		capture := Capture{
+			Time:           time.Now(),
+			RequestID:      requestIDFromContext(r.Context()),
+			Model:          modelID,
+			RequestedModel: requestedModel,
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			Request:        cs.message(r.Header, body),
+		}
+		capture.Peer, _ = r.Context().Value(proxyCtxKey("peer")).(string)
+		capture.ReplayOf, _ = r.Context().Value(proxyCtxKey("replayOf")).(int)
+
+		id := cs.reserveID()
+		w.Header().Set(captureIDHeader, strconv.Itoa(id))
+
+		cw := &captureWriter{ResponseWriter: w, maxBody: cs.maxBody}
+		err := next(modelID, cw, r)
+
+		capture.ID = id
+		capture.DurationMs = int(time.Since(capture.Time).Milliseconds())
+		if err != nil {
+			capture.Error = err.Error()
+		}
+		capture.Response = cs.message(w.Header(), cw.body.Bytes())
+		capture.Response.Status = cw.status
+		capture.Response.Size = cw.size
+		capture.Response.Truncated = cw.size > cw.body.Len()
+		if cw.sse != nil {
+			capture.Assembled = cw.sse.result(cs.redactText, cs.maxBody)
+		}
+		capture.Response.Header.Del(captureIDHeader)
+		cs.add(capture)
+		return err
+	}
+}
+
+func (cs *captureStore) reserveID() int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	id := cs.nextID
+	cs.nextID++
+	return id
+}
+
+func (cs *captureStore) add(capture Capture) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.captures = append(cs.captures, capture)
+	if len(cs.captures) > cs.max {
+		cs.captures = cs.captures[len(cs.captures)-cs.max:]
+	}
+}
+
+// get returns the capture, the concurrent requests may be added out of order.
+func (cs *captureStore) get(id int) (Capture, bool) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	i := slices.IndexFunc(cs.captures, func(c Capture) bool { return c.ID == id })
+	if i < 0 {
+		return Capture{}, false
+	}
+	return cs.captures[i], true
+}
+
+// list returns the summaries, newest first.
+func (cs *captureStore) list() []captureSummary {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	result := make([]captureSummary, 0, len(cs.captures))
+	for i := len(cs.captures) - 1; i >= 0; i-- {
+		c := &cs.captures[i]
+		result = append(result, captureSummary{
+			Time:       c.Time,
+			RequestID:  c.RequestID,
+			Model:      c.Model,
+			Path:       c.Path,
+			Error:      c.Error,
+			ID:         c.ID,
+			Status:     c.Response.Status,
+			DurationMs: c.DurationMs,
+		})
+	}
+	return result
+}
+
+func (cs *captureStore) clear() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.captures = nil
+}
+
+// message returns the redacted and truncated copy of the headers and the body.
+func (cs *captureStore) message(header http.Header, body []byte) captureMessage {
+	msg := captureMessage{Header: header.Clone(), Size: len(body)}
+	for _, name := range redactedHeaders {
+		if msg.Header.Get(name) != "" {
+			msg.Header.Set(name, redacted)
+		}
+	}
+
+	if encoding := header.Get("Content-Encoding"); encoding != "" {
+		if decoded, err := decompressBody(body, encoding); err == nil {
+			body = decoded
+		}
+	}
+	original := string(body)
+	if len(cs.fields) > 0 && gjson.ValidBytes(body) {
+		body = cs.redactFields(body)
+	}
+	text := cs.redactText(string(body))
+	msg.Redacted = text != original
+	if len(text) > cs.maxBody {
+		text = text[:cs.maxBody]
+		msg.Truncated = true
+	}
+	msg.Body = text
+	return msg
+}
+
+// redactFields replaces the values of the JSON paths (gjson syntax, e.g. messages.#.content).
+func (cs *captureStore) redactFields(body []byte) []byte {
+	for _, field := range cs.fields {
+		result := gjson.GetBytes(body, field)
+		if !result.Exists() {
+			continue
+		}
+		// the paths with # match several values, each one has its own path
+		paths := result.Paths(string(body))
+		if paths == nil {
+			paths = []string{field}
+		}
+		for _, path := range paths {
+			if redactedBody, err := sjson.SetBytes(body, path, redacted); err == nil {
+				body = redactedBody
+			}
+		}
+	}
+	return body
+}
+
+func (cs *captureStore) redactText(text string) string {
+	for _, re := range cs.patterns {
+		text = re.ReplaceAllString(text, redacted)
+	}
+	return text
+}
+
+// captureWriter copies the response sent to the client, up to maxBody bytes,
+// and reassembles the streamed chunks.
+type captureWriter struct {
+	http.ResponseWriter
+	body    bytes.Buffer
+	sse     *sseAssembler // text/event-stream responses, set on the first write
+	maxBody int
+	size    int
+	status  int
+}
+
+func (cw *captureWriter) WriteHeader(statusCode int) {
+	if cw.status == 0 {
+		cw.status = statusCode
+	}
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.size == 0 && cw.sse == nil && strings.Contains(cw.Header().Get("Content-Type"), "text/event-stream") &&
+		cw.Header().Get("Content-Encoding") == "" {
+		cw.sse = newSSEAssembler(cw.maxBody)
+	}
+
+	n, err := cw.ResponseWriter.Write(b)
+	cw.size += n
+	if room := cw.maxBody - cw.body.Len(); room > 0 {
+		cw.body.Write(b[:min(n, room)])
+	}
+	if cw.sse != nil {
+		cw.sse.Write(b[:n])
+	}
+	return n, err
+}
+
+func (cw *captureWriter) Flush() {
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection of the client.
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// assembledResponse is the message of a streaming response, rebuilt from its chunks.
+type assembledResponse struct {
+	Content          string              `json:"content,omitempty"`
+	ReasoningContent string              `json:"reasoning_content,omitempty"`
+	FinishReason     string              `json:"finish_reason,omitempty"`
+	ToolCalls        []assembledToolCall `json:"tool_calls,omitempty"`
+	Events           int                 `json:"events"` // SSE data payloads
+}
+
+type assembledToolCall struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+	Index     int    `json:"index"`
+}
+
+// sseAssembler concatenates the deltas of the OpenAI (chat, completions, responses),
+// llama-server and Anthropic streaming formats.
+type sseAssembler struct {
+	content   strings.Builder
+	reasoning strings.Builder
+	line      []byte
+	tools     []assembledToolCall
+	finish    string
+	maxLen    int // of the content and the reasoning
+	events    int
+}
+
+func newSSEAssembler(maxLen int) *sseAssembler {
+	return &sseAssembler{maxLen: maxLen}
+}
+
+// Write never fails: the response must not be broken by the capture.
+func (sa *sseAssembler) Write(p []byte) (int, error) {
+	sa.line = append(sa.line, p...)
+	start := 0
+	for {
+		i := bytes.IndexByte(sa.line[start:], '\n')
+		if i < 0 {
+			break
+		}
+		sa.parseLine(sa.line[start : start+i])
+		start += i + 1
+	}
+	sa.line = append(sa.line[:0], sa.line[start:]...)
+	if len(sa.line) > maxLogLine<<4 { // not an SSE stream
+		sa.line = sa.line[:0]
+	}
+	return len(p), nil
+}
+
+func (sa *sseAssembler) parseLine(line []byte) {
+	data, found := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !found {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) || !gjson.ValidBytes(data) {
+		return
+	}
+	sa.events++
+	event := gjson.ParseBytes(data)
+
+	switch event.Get("type").String() {
+	case "content_block_start": // Anthropic
+		if block := event.Get("content_block"); block.Get("type").String() == "tool_use" {
+			sa.tools = append(sa.tools, assembledToolCall{
+				Index: int(event.Get("index").Int()),
+				ID:    block.Get("id").String(),
+				Name:  block.Get("name").String(),
+			})
+		}
+		return
+	case "content_block_delta":
+		delta := event.Get("delta")
+		sa.appendText(&sa.content, delta.Get("text").String())
+		sa.appendText(&sa.reasoning, delta.Get("thinking").String())
+		if partial := delta.Get("partial_json"); partial.Exists() {
+			sa.tool(int(event.Get("index").Int())).Arguments += partial.String()
+		}
+		return
+	case "message_delta":
+		sa.setFinish(event.Get("delta.stop_reason"))
+		return
+	case "response.output_text.delta": // OpenAI responses
+		sa.appendText(&sa.content, event.Get("delta").String())
+		return
+	case "response.reasoning_text.delta":
+		sa.appendText(&sa.reasoning, event.Get("delta").String())
+		return
+	case "response.completed":
+		sa.setFinish(event.Get("response.status"))
+		return
+	}
+
+	// llama-server /completion
+	if content := event.Get("content"); content.Type == gjson.String {
+		sa.appendText(&sa.content, content.String())
+		if event.Get("stop").Bool() {
+			sa.setFinish(event.Get("stop_type"))
+		}
+		return
+	}
+
+	choice := event.Get("choices.0")
+	if !choice.Exists() {
+		return
+	}
+	sa.appendText(&sa.content, choice.Get("text").String()) // completions
+	delta := choice.Get("delta")
+	sa.appendText(&sa.content, delta.Get("content").String())
+	sa.appendText(&sa.reasoning, delta.Get("reasoning_content").String())
+	for _, call := range delta.Get("tool_calls").Array() {
+		tc := sa.tool(int(call.Get("index").Int()))
+		if id := call.Get("id").String(); id != "" {
+			tc.ID = id
+		}
+		if name := call.Get("function.name").String(); name != "" {
+			tc.Name = name
+		}
+		tc.Arguments += call.Get("function.arguments").String()
+	}
+	sa.setFinish(choice.Get("finish_reason"))
+}
+
+func (sa *sseAssembler) appendText(b *strings.Builder, text string) {
+	if room := sa.maxLen - b.Len(); room > 0 {
+		b.WriteString(text[:min(len(text), room)])
+	}
+}
+
+func (sa *sseAssembler) setFinish(reason gjson.Result) {
+	if reason.String() != "" {
+		sa.finish = reason.String()
+	}
+}
+
+// tool returns the tool call with the index, added if missing.
+func (sa *sseAssembler) tool(index int) *assembledToolCall {
+	for i := range sa.tools {
+		if sa.tools[i].Index == index {
+			return &sa.tools[i]
+		}
+	}
+	sa.tools = append(sa.tools, assembledToolCall{Index: index})
+	return &sa.tools[len(sa.tools)-1]
+}
+
+// result returns the assembled message, with the patterns redacted.
+func (sa *sseAssembler) result(redact func(string) string, maxLen int) *assembledResponse {
+	if len(sa.line) > 0 {
+		sa.parseLine(sa.line)
+		sa.line = sa.line[:0]
+	}
+	if sa.events == 0 {
+		return nil
+	}
+	ar := &assembledResponse{
+		Content:          redact(sa.content.String()),
+		ReasoningContent: redact(sa.reasoning.String()),
+		FinishReason:     sa.finish,
+		Events:           sa.events,
+	}
+	for _, tc := range sa.tools {
+		tc.Arguments = redact(tc.Arguments)
+		if len(tc.Arguments) > maxLen {
+			tc.Arguments = tc.Arguments[:maxLen]
+		}
+		ar.ToolCalls = append(ar.ToolCalls, tc)
+	}
+	return ar
+}
+
+// apiListCaptures returns the summaries of the captures, newest first.
+func (pm *ProxyManager) apiListCaptures(c *gin.Context) {
+	if pm.captures == nil {
+		pm.sendErrorResponse(c, http.StatusNotFound, "captures are disabled, see captures.enabled")
+		return
+	}
+	c.JSON(http.StatusOK, pm.captures.list())
+}
+
+func (pm *ProxyManager) apiDeleteCaptures(c *gin.Context) {
+	if pm.captures != nil {
+		pm.captures.clear()
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "ok"})
+}
+
+func (pm *ProxyManager) apiGetCapture(c *gin.Context) {
+	capture, ok := pm.findCapture(c)
+	if ok {
+		c.JSON(http.StatusOK, capture)
+	}
+}
+
+// apiReplayCapture re-sends the captured request to the same model, or to ?model=<model>.
+// The response is the one of the model, captured too (replay_of is the replayed capture).
+func (pm *ProxyManager) apiReplayCapture(c *gin.Context) {
+	capture, ok := pm.findCapture(c)
+	if !ok {
+		return
+	}
+	if capture.Request.Truncated {
+		pm.sendErrorResponse(c, http.StatusUnprocessableEntity, "the captured request body is truncated (see captures.maxBodyKB), it cannot be replayed")
+		return
+	}
+	if capture.Request.Redacted {
+		pm.sendErrorResponse(c, http.StatusUnprocessableEntity, "the captured request body is redacted (see captures.redactFields and redactPatterns), it cannot be replayed")
+		return
+	}
+
+	body, err := sjson.SetBytes([]byte(capture.Request.Body), "model", c.DefaultQuery("model", capture.RequestedModel))
+	if err != nil {
+		pm.sendErrorResponse(c, http.StatusUnprocessableEntity, "the captured request body is not a JSON object: "+err.Error())
+		return
+	}
+
+	requestID := requestIDFromContext(c.Request.Context())
+	req := c.Request.Clone(context.WithValue(c.Request.Context(), proxyCtxKey("replayOf"), capture.ID))
+	req.Method = capture.Method
+	req.URL.Path = capture.Path
+	req.URL.RawQuery = ""
+	req.Header = capture.Request.Header.Clone()
+	for _, name := range redactedHeaders {
+		req.Header.Del(name)
+	}
+	req.Header.Set(requestIDHeader, requestID)
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	pm.proxyLogger.ForRequest(req.Context()).Infof("Replaying capture %d to %s", capture.ID, gjson.GetBytes(body, "model").String())
+	c.Request = req
+	pm.ProxyInferenceHandler(c)
+}
+
+// findCapture returns the capture of the :id parameter, or sends the error.
+func (pm *ProxyManager) findCapture(c *gin.Context) (Capture, bool) {
+	if pm.captures == nil {
+		pm.sendErrorResponse(c, http.StatusNotFound, "captures are disabled, see captures.enabled")
+		return Capture{}, false
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		pm.sendErrorResponse(c, http.StatusBadRequest, "invalid capture id: "+c.Param("id"))
+		return Capture{}, false
+	}
+	capture, found := pm.captures.get(id)
+	if !found {
+		pm.sendErrorResponse(c, http.StatusNotFound, "capture not found (see captures.maxCaptures): "+c.Param("id"))
+		return Capture{}, false
+	}
+	return capture, true
+}
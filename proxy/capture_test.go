@@ -0,0 +1,231 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestCapture_SSEAssembler(t *testing.T) {
+	identity := func(s string) string { return s }
+
+	// OpenAI chat, split in the middle of a line
+	sa := newSSEAssembler(1024)
+	sa.Write([]byte(`data: {"choices":[{"delta":{"reasoning_content":"hmm"}}]}` + "\n\n" + `data: {"choices":[{"delta":{"content":"Hel`))
+	sa.Write([]byte(`lo"}}]}` + "\n\n"))
+	sa.Write([]byte(`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"read","arguments":"{\"pa"}}]}}]}` + "\n\n"))
+	sa.Write([]byte(`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":1}"}}]}}]}` + "\n\n"))
+	sa.Write([]byte(`data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}` + "\n\ndata: [DONE]\n\n"))
+	assert.Equal(t, &assembledResponse{
+		Content:          "Hello",
+		ReasoningContent: "hmm",
+		FinishReason:     "tool_calls",
+		ToolCalls:        []assembledToolCall{{ID: "call_1", Name: "read", Arguments: `{"path":1}`}},
+		Events:           5,
+	}, sa.result(identity, 1024))
+
+	// Anthropic
+	sa = newSSEAssembler(1024)
+	sa.Write([]byte("event: content_block_delta\n" + `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}` + "\n\n"))
+	sa.Write([]byte(`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"tu_1","name":"ls"}}` + "\n\n"))
+	sa.Write([]byte(`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{}"}}` + "\n\n"))
+	sa.Write([]byte(`data: {"type":"message_delta","delta":{"stop_reason":"tool_use"}}`)) // no final line feed
+	ar := sa.result(identity, 1024)
+	assert.Equal(t, "Hi", ar.Content)
+	assert.Equal(t, "tool_use", ar.FinishReason)
+	assert.Equal(t, []assembledToolCall{{Index: 1, ID: "tu_1", Name: "ls", Arguments: "{}"}}, ar.ToolCalls)
+
+	// llama-server /completion, content limited to maxLen
+	sa = newSSEAssembler(4)
+	sa.Write([]byte(`data: {"content":"abc"}` + "\n\n" + `data: {"content":"def","stop":true,"stop_type":"limit"}` + "\n\n"))
+	ar = sa.result(identity, 4)
+	assert.Equal(t, "abcd", ar.Content)
+	assert.Equal(t, "limit", ar.FinishReason)
+
+	assert.Nil(t, newSSEAssembler(10).result(identity, 10), "no event")
+}
+
+func TestCapture_Message(t *testing.T) {
+	cs := newCaptureStore(&config.Config{Captures: config.CapturesConfig{
+		Enabled:        true,
+		MaxCaptures:    10,
+		MaxBodyKB:      1,
+		RedactFields:   []string{"user", "messages.#.content", "missing"},
+		RedactPatterns: []string{`sk-[a-z0-9]+`},
+	}})
+	header := http.Header{"Authorization": {"Bearer sk-abc"}, "Content-Type": {"application/json"}}
+	msg := cs.message(header, []byte(`{"user":"bob","messages":[{"role":"user","content":"a"},{"role":"user","content":"b"}],"key":"sk-123"}`))
+	assert.Equal(t, `{"user":"[REDACTED]","messages":[{"role":"user","content":"[REDACTED]"},{"role":"user","content":"[REDACTED]"}],"key":"[REDACTED]"}`, msg.Body)
+	assert.Equal(t, redacted, msg.Header.Get("Authorization"))
+	assert.Equal(t, "Bearer sk-abc", header.Get("Authorization"), "the headers are copied")
+	assert.False(t, msg.Truncated)
+	assert.True(t, msg.Redacted)
+
+	msg = cs.message(http.Header{}, []byte(strings.Repeat("x", 2000)))
+	assert.Len(t, msg.Body, 1024)
+	assert.Equal(t, 2000, msg.Size)
+	assert.True(t, msg.Truncated)
+	assert.False(t, msg.Redacted)
+
+	assert.True(t, cs.enabled("any"))
+	assert.False(t, (*captureStore)(nil).enabled("any"))
+}
+
+func TestProxyManager_Captures(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(body))
+		mu.Unlock()
+		if gjson.GetBytes(body, "stream").Bool() {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(`data: {"choices":[{"delta":{"content":"Hello "}}]}` + "\n\n"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(`data: {"choices":[{"delta":{"content":"world"},"finish_reason":"stop"}]}` + "\n\ndata: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer upstream.Close()
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": {Proxy: upstream.URL, CheckEndpoint: "/health", UseModelName: "upstream-name", Filters: config.ModelFilters{StripParams: "temperature"}},
+			"model2": {Proxy: upstream.URL, CheckEndpoint: "/health"},
+			"model3": {Proxy: upstream.URL, CheckEndpoint: "/health"},
+		},
+		LogLevel: "error",
+		Captures: config.CapturesConfig{
+			Enabled:        true,
+			Models:         []string{"model1", "model2"},
+			MaxCaptures:    10,
+			MaxBodyKB:      1,
+			RedactFields:   []string{"user"},
+			RedactPatterns: []string{`sk-[a-z0-9]+`},
+		},
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	getCapture := func(id string) Capture {
+		t.Helper()
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/captures/"+id, http.NoBody))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var capture Capture
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &capture))
+		return capture
+	}
+
+	// streaming request, as sent upstream
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"model1","stream":true,"temperature":0.2,"user":"bob","messages":[{"role":"user","content":"my key is sk-abc123"}]}`))
+	req.Header.Set(requestIDHeader, "cap-1")
+	w := CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "1", w.Header().Get(captureIDHeader))
+
+	capture := getCapture("1")
+	assert.Equal(t, "cap-1", capture.RequestID)
+	assert.Equal(t, "model1", capture.Model)
+	assert.Equal(t, "/v1/chat/completions", capture.Path)
+	assert.Equal(t, `{"model":"upstream-name","stream":true,"user":"[REDACTED]","messages":[{"role":"user","content":"my key is [REDACTED]"}]}`, capture.Request.Body)
+	assert.Equal(t, http.StatusOK, capture.Response.Status)
+	assert.Contains(t, capture.Response.Body, `data: {"choices":[{"delta":{"content":"world"}`)
+	assert.Empty(t, capture.Response.Header.Get(captureIDHeader))
+	require.NotNil(t, capture.Assembled)
+	assert.Equal(t, "Hello world", capture.Assembled.Content)
+	assert.Equal(t, "stop", capture.Assembled.FinishReason)
+
+	assert.True(t, capture.Request.Redacted)
+
+	// a redacted request is not replayed
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/captures/1/replay", http.NoBody))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// replay to another model
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"model1","stream":true,"messages":[{"role":"user","content":"hi"}]}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "2", w.Header().Get(captureIDHeader))
+	assert.False(t, getCapture("2").Request.Redacted)
+
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/captures/2/replay?model=model2", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "world")
+	require.Equal(t, "3", w.Header().Get(captureIDHeader))
+	mu.Lock()
+	require.Len(t, received, 3)
+	assert.Equal(t, `{"model":"model2","stream":true,"messages":[{"role":"user","content":"hi"}]}`, received[2])
+	mu.Unlock()
+	replay := getCapture("3")
+	assert.Equal(t, 2, replay.ReplayOf)
+	assert.Equal(t, "model2", replay.Model)
+	assert.NotEqual(t, "cap-1", replay.RequestID)
+
+	// models not captured, truncated bodies
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"model3"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(captureIDHeader))
+
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"model2","prompt":"`+strings.Repeat("x", 2000)+`"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	truncated := getCapture(w.Header().Get(captureIDHeader))
+	assert.True(t, truncated.Request.Truncated)
+	assert.JSONEq(t, `{"choices":[{"message":{"content":"ok"}}]}`, truncated.Response.Body)
+	assert.Nil(t, truncated.Assembled)
+
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/captures/4/replay", http.NoBody))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// list, newest first
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/captures", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	var summaries []captureSummary
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summaries))
+	require.Len(t, summaries, 4)
+	assert.Equal(t, []int{4, 3, 2, 1}, []int{summaries[0].ID, summaries[1].ID, summaries[2].ID, summaries[3].ID})
+
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/captures", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/captures/1", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/captures/abc", http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
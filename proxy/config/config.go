@@ -5,6 +5,7 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"os"
 	"regexp"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -26,6 +28,9 @@ const (
 	LogToStdoutUpstream = "upstream"
 	LogToStdoutBoth     = "both"
 	LogToStdoutNone     = "none"
+
+	LogFormatText = "text"
+	LogFormatJSON = "json" // one JSON object per line
 )
 
 type MacroEntry struct {
@@ -117,6 +122,66 @@ type HookOnStartup struct {
 	Preload []string `yaml:"preload"`
 }
 
+// MetricsStoreConfig persists the token metrics in rotated JSONL files.
+type MetricsStoreConfig struct {
+	Dir       string `yaml:"dir"`       // disabled if empty
+	MaxSizeMB int    `yaml:"maxSizeMB"` // size of the current file before rotation
+	MaxFiles  int    `yaml:"maxFiles"`  // number of rotated files to keep, 0 keeps all
+}
+
+// LogFilesConfig writes the proxy logs and the output of each model in rotated files,
+// the rotated segments are gzip compressed.
+type LogFilesConfig struct {
+	Dir         string `yaml:"dir"`         // disabled if empty
+	MaxSizeMB   int    `yaml:"maxSizeMB"`   // size of the current segment before rotation
+	MaxAgeHours int    `yaml:"maxAgeHours"` // age of the current segment before rotation, 0 disables
+	MaxFiles    int    `yaml:"maxFiles"`    // number of rotated segments to keep per log, 0 keeps all
+}
+
+// CapturesConfig keeps the last requests sent upstream and their responses, see /api/captures.
+type CapturesConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Models         []string `yaml:"models"`         // captured models (IDs or aliases), empty captures all
+	MaxCaptures    int      `yaml:"maxCaptures"`    // captures kept in memory
+	MaxBodyKB      int      `yaml:"maxBodyKB"`      // bodies are truncated beyond this size
+	RedactFields   []string `yaml:"redactFields"`   // JSON paths of the bodies replaced by "[REDACTED]"
+	RedactPatterns []string `yaml:"redactPatterns"` // regular expressions replaced by "[REDACTED]"
+}
+
+// ResponsesConfig serves /v1/responses on top of /v1/chat/completions,
+// the responses are kept for previous_response_id and GET /v1/responses/:id.
+type ResponsesConfig struct {
+	Enabled      bool `yaml:"enabled"`      // false forwards /v1/responses as is
+	TTL          int  `yaml:"ttl"`          // seconds a stored response is kept
+	MaxResponses int  `yaml:"maxResponses"` // stored responses kept in memory
+}
+
+// ResponseCacheConfig replays the responses of the identical deterministic requests,
+// see the X-Response-Cache header.
+type ResponseCacheConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	TTL       int    `yaml:"ttl"`       // seconds a response is served from the cache
+	MaxSizeMB int    `yaml:"maxSizeMB"` // total size of the responses, the least recently used are evicted
+	Dir       string `yaml:"dir"`       // persisted across restarts, memory only if empty
+}
+
+// TracingConfig exports OpenTelemetry spans to an OTLP/HTTP collector (JSON encoding).
+type TracingConfig struct {
+	Endpoint    string            `yaml:"endpoint"`    // e.g. http://localhost:4318, disabled if empty
+	ServiceName string            `yaml:"serviceName"` // default: goinfer
+	Headers     map[string]string `yaml:"headers"`     // e.g. authentication of the collector
+}
+
+// APIKeyQuota names an API key in the usage metrics and limits its inference requests.
+// A zero limit means unlimited.
+type APIKeyQuota struct {
+	Name               string `yaml:"name"` // default: key-<hash of the key>
+	Key                string `yaml:"key"`
+	RequestsPerMinute  int    `yaml:"requestsPerMinute"`
+	TokensPerDay       int64  `yaml:"tokensPerDay"` // input + output tokens, reset at midnight
+	ConcurrentRequests int    `yaml:"concurrentRequests"`
+}
+
 type Config struct {
 	Models   map[string]*ModelConfig `yaml:"models"` /* key is model ID */
 	Profiles map[string][]string     `yaml:"profiles"`
@@ -130,9 +195,19 @@ type Config struct {
 	LogToStdout   string `yaml:"logToStdout"`
 	LogLevel      string `yaml:"logLevel"`
 	LogTimeFormat string `yaml:"logTimeFormat"`
+	LogFormat     string `yaml:"logFormat"`
 
 	RequiredAPIKeys []string `yaml:"apiKeys"`
 
+	// per-key name and limits of the inference requests
+	APIKeyQuotas []APIKeyQuota `yaml:"apiKeyQuotas"`
+
+	// OpenTelemetry tracing of the proxied requests
+	Tracing TracingConfig `yaml:"tracing"`
+
+	// bearer token required to scrape /metrics instead of the apiKeys
+	MetricsToken string `yaml:"metricsToken"`
+
 	// for key/value replacements in model's cmd, cmdStop, proxy, checkEndPoint
 	Macros MacroList `yaml:"macros"`
 
@@ -146,6 +221,24 @@ type Config struct {
 	MetricsMaxInMemory int  `yaml:"metricsMaxInMemory"`
 	LogRequests        bool `yaml:"logRequests"`
 
+	// token metrics history surviving restarts, see /api/usage
+	MetricsStore MetricsStoreConfig `yaml:"metricsStore"`
+
+	// proxy and model logs surviving the process stop, see /api/logfiles
+	LogFiles LogFilesConfig `yaml:"logFiles"`
+
+	// upstream requests and responses kept for debugging, see /api/captures
+	Captures CapturesConfig `yaml:"captures"`
+
+	// Responses API with server-side conversation state
+	Responses ResponsesConfig `yaml:"responses"`
+
+	// exact-match cache of the deterministic responses
+	ResponseCache ResponseCacheConfig `yaml:"responseCache"`
+
+	// request body fields keeping a session on the same replica (first non-empty), e.g. prompt_cache_key, user
+	StickyKeys []string `yaml:"stickyKeys"`
+
 	// send loading state in reasoning
 	SendLoadingState bool `yaml:"sendLoadingState"`
 
@@ -193,7 +286,13 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 		LogLevel:           "info",
 		LogTimeFormat:      "",
 		LogToStdout:        LogToStdoutProxy,
+		LogFormat:          LogFormatText,
 		MetricsMaxInMemory: 1000,
+		MetricsStore:       MetricsStoreConfig{MaxSizeMB: 10},
+		LogFiles:           LogFilesConfig{MaxSizeMB: 10},
+		Captures:           CapturesConfig{MaxCaptures: 100, MaxBodyKB: 256},
+		Responses:          ResponsesConfig{TTL: 3600, MaxResponses: 1000},
+		ResponseCache:      ResponseCacheConfig{TTL: 3600, MaxSizeMB: 100},
 	}
 	err = yaml.Unmarshal(data, cfg)
 	if err != nil {
@@ -215,6 +314,14 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 		return nil, errors.New("logToStdout must be one of: proxy, upstream, both, none")
 	}
 
+	switch cfg.LogFormat {
+	case "":
+		cfg.LogFormat = LogFormatText
+	case LogFormatText, LogFormatJSON:
+	default:
+		return nil, errors.New("logFormat must be one of: text, json")
+	}
+
 	// Populate the aliases map
 	cfg.aliases = make(map[string]string)
 	for modelName, modelConfig := range cfg.Models {
@@ -226,6 +333,10 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 		}
 	}
 
+	if err = cfg.validateFallbacks(); err != nil {
+		return nil, err
+	}
+
 	/* check macro constraint rules:
 
 	- name must fit the regex ^[a-zA-Z0-9_-]+$
@@ -255,6 +366,13 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 		modelConfig.Cmd = StripComments(modelConfig.Cmd)
 		modelConfig.CmdStop = StripComments(modelConfig.CmdStop)
 
+		if modelConfig.Router != "" {
+			if !modelConfig.IsExternal() {
+				return nil, fmt.Errorf("model %s: a model served by the router %s must not have a cmd", modelId, modelConfig.Router)
+			}
+			modelConfig.Proxy = "" // the proxy URL of the router is set by setRouterModels()
+		}
+
 		// validate model macros
 		for _, macro := range modelConfig.Macros {
 			err = validateMacro(macro.Name, macro.Value)
@@ -299,6 +417,10 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 			modelConfig.Proxy = strings.ReplaceAll(modelConfig.Proxy, macroSlug, macroStr)
 			modelConfig.CheckEndpoint = strings.ReplaceAll(modelConfig.CheckEndpoint, macroSlug, macroStr)
 			modelConfig.Filters.StripParams = strings.ReplaceAll(modelConfig.Filters.StripParams, macroSlug, macroStr)
+			for _, hook := range []*EndpointHook{&modelConfig.Hooks.OnLoad, &modelConfig.Hooks.OnUnload} {
+				hook.Path = strings.ReplaceAll(hook.Path, macroSlug, macroStr)
+				hook.Body = strings.ReplaceAll(hook.Body, macroSlug, macroStr)
+			}
 
 			// Substitute in metadata (recursive)
 			if len(modelConfig.Metadata) > 0 {
@@ -317,6 +439,9 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 		cmdHasPort := strings.Contains(modelConfig.Cmd, "${PORT}")
 		proxyHasPort := strings.Contains(modelConfig.Proxy, "${PORT}")
 		if cmdHasPort || proxyHasPort { // either has it
+			if modelConfig.IsExternal() {
+				return nil, fmt.Errorf("model %s: a model without cmd requires the proxy URL of the running server", modelId)
+			}
 			if !cmdHasPort && proxyHasPort { // but both don't have it
 				return nil, fmt.Errorf("model %s: proxy uses ${PORT} but cmd does not - ${PORT} is only available when used in cmd", modelId)
 			}
@@ -350,6 +475,8 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 			"proxy":               modelConfig.Proxy,
 			"checkEndpoint":       modelConfig.CheckEndpoint,
 			"filters.stripParams": modelConfig.Filters.StripParams,
+			"hooks.on_load":       modelConfig.Hooks.OnLoad.Path + modelConfig.Hooks.OnLoad.Body,
+			"hooks.on_unload":     modelConfig.Hooks.OnUnload.Path + modelConfig.Hooks.OnUnload.Body,
 		}
 
 		for fieldName, fieldValue := range fieldMap {
@@ -383,6 +510,11 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 			)
 		}
 
+		if modelConfig.StartupTimeout < 0 || modelConfig.HealthCheck.Interval < 0 ||
+			modelConfig.HealthCheck.Timeout < 0 || modelConfig.HealthCheck.FailureThreshold < 0 {
+			return nil, fmt.Errorf("model %s: startupTimeout and healthCheck values must not be negative", modelId)
+		}
+
 		// if sendLoadingState is nil, set it to the global config value
 		// see #366
 		if modelConfig.SendLoadingState == nil {
@@ -393,6 +525,10 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 		cfg.Models[modelId] = modelConfig
 	}
 
+	if err := cfg.setRouterModels(); err != nil {
+		return nil, err
+	}
+
 	cfg.AddDefaultGroupToConfig()
 	// check that members are all unique in the groups
 	memberUsage := make(map[string]string) // maps member to group it appears in
@@ -412,6 +548,9 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 			memberUsage[member] = groupID
 		}
 	}
+	if err := cfg.validateRouterGroups(memberUsage); err != nil {
+		return nil, err
+	}
 
 	// clean up hooks preload
 	if len(cfg.Hooks.OnStartup.Preload) > 0 {
@@ -429,6 +568,26 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 		cfg.Hooks.OnStartup.Preload = toPreload
 	}
 
+	// the quotas apply to the API keys, they do not add keys
+	names := make(map[string]bool, len(cfg.APIKeyQuotas))
+	for i, quota := range cfg.APIKeyQuotas {
+		if quota.Key == "" {
+			return nil, fmt.Errorf("apiKeyQuotas[%d]: missing key", i)
+		}
+		if quota.RequestsPerMinute < 0 || quota.TokensPerDay < 0 || quota.ConcurrentRequests < 0 {
+			return nil, fmt.Errorf("apiKeyQuotas[%d]: quotas must be positive or zero", i)
+		}
+		if quota.Name != "" {
+			if names[quota.Name] {
+				return nil, fmt.Errorf("apiKeyQuotas[%d]: duplicate name %s", i, quota.Name)
+			}
+			names[quota.Name] = true
+		}
+		if !slices.Contains(cfg.RequiredAPIKeys, quota.Key) {
+			return nil, fmt.Errorf("apiKeyQuotas[%d]: the key must be in apiKeys", i)
+		}
+	}
+
 	// check api keys validatity
 	for _, apikey := range cfg.RequiredAPIKeys {
 		if apikey == "" {
@@ -440,9 +599,161 @@ func LoadConfigFromReader(r io.Reader) (*Config, error) {
 		}
 	}
 
+	if strings.Contains(cfg.MetricsToken, " ") {
+		return nil, errors.New("metricsToken cannot contain spaces")
+	}
+
+	if cfg.Tracing.Endpoint != "" {
+		if u, err := url.Parse(cfg.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("tracing.endpoint must be a http(s) URL: %s", cfg.Tracing.Endpoint)
+		}
+		if cfg.Tracing.ServiceName == "" {
+			cfg.Tracing.ServiceName = "goinfer"
+		}
+	}
+
+	if cfg.MetricsStore.MaxSizeMB < 1 {
+		cfg.MetricsStore.MaxSizeMB = 10
+	}
+	if cfg.MetricsStore.MaxFiles < 0 {
+		return nil, errors.New("metricsStore.maxFiles must be positive or zero")
+	}
+
+	if cfg.LogFiles.MaxSizeMB < 1 {
+		cfg.LogFiles.MaxSizeMB = 10
+	}
+	if cfg.LogFiles.MaxAgeHours < 0 || cfg.LogFiles.MaxFiles < 0 {
+		return nil, errors.New("logFiles.maxAgeHours and logFiles.maxFiles must be positive or zero")
+	}
+
+	if cfg.Captures.MaxCaptures < 1 {
+		cfg.Captures.MaxCaptures = 100
+	}
+	if cfg.Captures.MaxBodyKB < 1 {
+		cfg.Captures.MaxBodyKB = 256
+	}
+	for _, model := range cfg.Captures.Models {
+		if _, found := cfg.RealModelName(model); !found {
+			return nil, fmt.Errorf("captures.models: unknown model %s", model)
+		}
+	}
+	for _, pattern := range cfg.Captures.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("captures.redactPatterns: invalid regular expression %q: %w", pattern, err)
+		}
+	}
+
+	if cfg.Responses.TTL < 1 {
+		cfg.Responses.TTL = 3600
+	}
+	if cfg.Responses.MaxResponses < 1 {
+		cfg.Responses.MaxResponses = 1000
+	}
+
+	if cfg.ResponseCache.TTL < 1 {
+		cfg.ResponseCache.TTL = 3600
+	}
+	if cfg.ResponseCache.MaxSizeMB < 1 {
+		cfg.ResponseCache.MaxSizeMB = 100
+	}
+
 	return cfg, nil
 }
 
+// validateFallbacks checks the fallbacks and the replicas are other local or peer models,
+// any name is accepted when a peer discovers its models.
+func (cfg *Config) validateFallbacks() error {
+	discover := false
+	peerModels := []string{}
+	for _, peer := range cfg.Peers {
+		discover = discover || peer.Discover
+		peerModels = append(peerModels, peer.ServedModels()...)
+	}
+	check := func(modelId, kind, name string) error {
+		realName, found := cfg.RealModelName(name)
+		switch {
+		case found && realName == modelId:
+			return fmt.Errorf("model %s: %s %s is the model itself", modelId, kind, name)
+		case found, slices.Contains(peerModels, name), discover && name != "":
+			return nil
+		default:
+			return fmt.Errorf("model %s: unknown %s %s", modelId, kind, name)
+		}
+	}
+	for modelId, modelConfig := range cfg.Models {
+		for _, fallback := range modelConfig.Fallbacks {
+			if err := check(modelId, "fallback", fallback); err != nil {
+				return err
+			}
+		}
+		for _, replica := range modelConfig.Replicas {
+			if err := check(modelId, "replica", replica); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setRouterModels completes the models served by a llama-server router (--models-preset):
+// the proxy URL of the router, the model name within the router and the load/unload hooks
+// of the router model-management API.
+func (cfg *Config) setRouterModels() error {
+	for modelId, modelConfig := range cfg.Models {
+		if modelConfig.Router == "" {
+			continue
+		}
+
+		router, found := cfg.Models[modelConfig.Router]
+		if !found {
+			return fmt.Errorf("model %s: router %s not found", modelId, modelConfig.Router)
+		}
+		if router.Router != "" {
+			return fmt.Errorf("model %s: router %s is itself served by a router", modelId, modelConfig.Router)
+		}
+
+		modelConfig.Proxy = router.Proxy
+		modelConfig.CheckEndpoint = "/models"
+		if modelConfig.UseModelName == "" {
+			modelConfig.UseModelName = modelId // the preset name
+		}
+
+		body, err := json.Marshal(map[string]string{"model": modelConfig.UseModelName})
+		if err != nil {
+			return fmt.Errorf("model %s: %w", modelId, err)
+		}
+		if modelConfig.Hooks.OnLoad.Path == "" {
+			modelConfig.Hooks.OnLoad = EndpointHook{Method: "POST", Path: "/models/load", Body: string(body)}
+		}
+		if modelConfig.Hooks.OnUnload.Path == "" {
+			modelConfig.Hooks.OnUnload = EndpointHook{Method: "POST", Path: "/models/unload", Body: string(body)}
+		}
+	}
+	return nil
+}
+
+// validateRouterGroups checks that a router is not stopped while its presets are in use:
+// in a persistent group, not swapped with its presets and without ttl.
+func (cfg *Config) validateRouterGroups(memberUsage map[string]string) error {
+	for modelId, modelConfig := range cfg.Models {
+		if modelConfig.Router == "" {
+			continue
+		}
+		routerGroupID := memberUsage[modelConfig.Router]
+		routerGroup := cfg.Groups[routerGroupID]
+		if !routerGroup.Persistent {
+			return fmt.Errorf("model %s: router %s must be in a persistent group", modelId, modelConfig.Router)
+		}
+		if routerGroup.Swap && memberUsage[modelId] == routerGroupID {
+			return fmt.Errorf("model %s: router %s must not be in the same swap group", modelId, modelConfig.Router)
+		}
+		if cfg.Models[modelConfig.Router].UnloadAfter > 0 {
+			return fmt.Errorf("router %s: ttl is not supported, set it on the models %s serves", modelConfig.Router, modelId)
+		}
+	}
+	return nil
+}
+
 // rewrites the yaml to include a default group with any orphaned models.
 func (cfg *Config) AddDefaultGroupToConfig() {
 	if cfg.Groups == nil {
@@ -163,6 +163,7 @@ groups:
 	expected := &Config{
 		LogLevel:      "info",
 		LogTimeFormat: "",
+		LogFormat:     LogFormatText,
 		LogToStdout:   LogToStdoutProxy,
 		StartPort:     5800,
 		Macros: MacroList{
@@ -212,6 +213,11 @@ groups:
 		},
 		HealthCheckTimeout: 15,
 		MetricsMaxInMemory: 1000,
+		MetricsStore:       MetricsStoreConfig{MaxSizeMB: 10},
+		LogFiles:           LogFilesConfig{MaxSizeMB: 10},
+		Captures:           CapturesConfig{MaxCaptures: 100, MaxBodyKB: 256},
+		Responses:          ResponsesConfig{TTL: 3600, MaxResponses: 1000},
+		ResponseCache:      ResponseCacheConfig{TTL: 3600, MaxSizeMB: 100},
 		Profiles: map[string][]string{
 			"test": {"model1", "model2"},
 		},
@@ -5,11 +5,13 @@
 package config
 
 import (
+	"fmt"
 	"slices"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfig_GroupMemberIsUnique(t *testing.T) {
@@ -811,3 +813,104 @@ func TestConfig_APIKeys_Invalid(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_APIKeyQuotas(t *testing.T) {
+	content := `
+apiKeys: ["sk-free", "sk-a"]
+apiKeyQuotas:
+  - name: team-a
+    key: sk-a
+    requestsPerMinute: 60
+    tokensPerDay: 1000000
+    concurrentRequests: 2
+  - key: sk-free
+    tokensPerDay: 1000
+`
+	cfg, err := LoadConfigFromReader(strings.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, APIKeyQuota{Name: "team-a", Key: "sk-a", RequestsPerMinute: 60, TokensPerDay: 1000000, ConcurrentRequests: 2}, cfg.APIKeyQuotas[0])
+
+	for content, expectedErr := range map[string]string{
+		`apiKeyQuotas: [{name: a}]`:                                                 "apiKeyQuotas[0]: missing key",
+		`apiKeyQuotas: [{key: k, requestsPerMinute: -1}]`:                           "apiKeyQuotas[0]: quotas must be positive or zero",
+		"apiKeys: [k1, k2]\napiKeyQuotas: [{name: a, key: k1}, {name: a, key: k2}]": "apiKeyQuotas[1]: duplicate name a",
+		`apiKeyQuotas: [{key: k}]`:                                                  "apiKeyQuotas[0]: the key must be in apiKeys",
+	} {
+		_, err := LoadConfigFromReader(strings.NewReader(content))
+		assert.EqualError(t, err, expectedErr)
+	}
+}
+
+func TestConfig_Captures(t *testing.T) {
+	content := `
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    aliases: [m1]
+captures:
+  enabled: true
+  models: [m1]
+  maxBodyKB: 0
+  redactFields: [user]
+  redactPatterns: ['sk-[a-z0-9]+']
+`
+	cfg, err := LoadConfigFromReader(strings.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, CapturesConfig{
+		Enabled:        true,
+		Models:         []string{"m1"},
+		MaxCaptures:    100,
+		MaxBodyKB:      256,
+		RedactFields:   []string{"user"},
+		RedactPatterns: []string{"sk-[a-z0-9]+"},
+	}, cfg.Captures)
+
+	for content, expectedErr := range map[string]string{
+		`captures: {models: [unknown]}`:     "captures.models: unknown model unknown",
+		`captures: {redactPatterns: ["("]}`: "captures.redactPatterns: invalid regular expression \"(\": error parsing regexp: missing closing ): `(`",
+	} {
+		_, err := LoadConfigFromReader(strings.NewReader(content))
+		assert.EqualError(t, err, expectedErr)
+	}
+}
+
+func TestConfig_Responses(t *testing.T) {
+	cfg, err := LoadConfigFromReader(strings.NewReader("responses: {enabled: true, ttl: 0, maxResponses: 5}"))
+	require.NoError(t, err)
+	assert.Equal(t, ResponsesConfig{Enabled: true, TTL: 3600, MaxResponses: 5}, cfg.Responses)
+}
+
+func TestConfig_ResponseCache(t *testing.T) {
+	cfg, err := LoadConfigFromReader(strings.NewReader("responseCache: {enabled: true, maxSizeMB: -1, dir: /tmp/cache}"))
+	require.NoError(t, err)
+	assert.Equal(t, ResponseCacheConfig{Enabled: true, TTL: 3600, MaxSizeMB: 100, Dir: "/tmp/cache"}, cfg.ResponseCache)
+}
+
+func TestConfig_Fallbacks(t *testing.T) {
+	const models = `
+models:
+  big:
+    cmd: llama-server --port ${PORT}
+    aliases: [large]
+    fallbacks: %s
+  small:
+    cmd: llama-server --port ${PORT}
+    aliases: [tiny]
+peers:
+  openrouter:
+    proxy: https://openrouter.ai/api
+    models: [r1]
+`
+	cfg, err := LoadConfigFromReader(strings.NewReader(fmt.Sprintf(models, "[tiny, r1]")))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tiny", "r1"}, cfg.Models["big"].Fallbacks)
+
+	_, err = LoadConfigFromReader(strings.NewReader(fmt.Sprintf(models, "[medium]")))
+	require.EqualError(t, err, "model big: unknown fallback medium")
+
+	_, err = LoadConfigFromReader(strings.NewReader(fmt.Sprintf(models, "[large]")))
+	require.EqualError(t, err, "model big: fallback large is the model itself")
+
+	_, err = LoadConfigFromReader(strings.NewReader(fmt.Sprintf(models, "[]\n    replicas: [big-gpu1]")))
+	require.EqualError(t, err, "model big: unknown replica big-gpu1")
+}
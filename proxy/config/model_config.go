@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"slices"
 	"strings"
+	"time"
 )
 
 type ModelConfig struct {
@@ -38,9 +39,42 @@ type ModelConfig struct {
 	// Model level macros take precedence over the global macros
 	Macros MacroList `yaml:"macros"`
 
+	// Runtime liveness probes while the process is Ready
+	HealthCheck ModelHealthCheck `yaml:"healthCheck"`
+
+	// HTTP requests sent to an external endpoint (model without cmd)
+	Hooks ModelHooks `yaml:"hooks"`
+
+	// Router is the model ID of a llama-server in router mode (--models-preset)
+	// serving this model: no cmd, the model is loaded/unloaded through the router API
+	Router string `yaml:"router"`
+
+	// Translate the Anthropic /v1/messages requests to /v1/chat/completions,
+	// for the engines without native Messages API
+	TranslateMessages bool `yaml:"translateMessages"`
+
+	// Models (local, peers) tried in order when this one fails before responding:
+	// start failure, health timeout, 5xx status, queue overflow
+	Fallbacks []string `yaml:"fallbacks"`
+
+	// Other models (local, peers) serving the same model: the requests go to the
+	// healthy replica (this model included) having the least in-flight requests
+	Replicas []string `yaml:"replicas"`
+
+	// llama-server KV cache slots kept per conversation, saved and restored across restarts
+	Slots SlotsConfig `yaml:"slots"`
+
+	// Concurrent requests with the same body and API key share one upstream call, its response
+	// (streamed or not) is sent to each of them
+	Dedupe bool `yaml:"dedupe"`
+
 	// Limit concurrency of HTTP requests to process
 	ConcurrencyLimit int `yaml:"concurrencyLimit"`
 
+	// Seconds to wait for the checkEndpoint during startup,
+	// overrides the global healthCheckTimeout when greater than zero
+	StartupTimeout int `yaml:"startupTimeout"`
+
 	UnloadAfter int  `yaml:"ttl"`
 	Unlisted    bool `yaml:"unlisted"`
 }
@@ -72,6 +106,10 @@ func (m *ModelConfig) UnmarshalYAML(unmarshal func(any) error) error {
 		return err
 	}
 
+	if defaults.Slots.SavePath != "" && defaults.Slots.Count < 1 {
+		return errors.New("slots.savePath requires slots.count")
+	}
+
 	*m = ModelConfig(defaults)
 	return nil
 }
@@ -80,6 +118,63 @@ func (m *ModelConfig) SanitizedCommand() ([]string, error) {
 	return SanitizeCommand(m.Cmd)
 }
 
+// IsExternal returns true when the model has no cmd: the proxy URL points to
+// an already running server (systemd unit, container...) that is never stopped.
+func (m *ModelConfig) IsExternal() bool {
+	return strings.TrimSpace(m.Cmd) == ""
+}
+
+// SlotsConfig sends the requests of a conversation (see Config.StickyKeys) to the same
+// llama-server slot (id_slot). With a SavePath, the slots used by conversations are saved
+// before the model is unloaded and restored once it is started again.
+type SlotsConfig struct {
+	Count     int    `yaml:"count"`     // slots of llama-server (--parallel), 0 disables the slot affinity
+	SavePath  string `yaml:"savePath"`  // the --slot-save-path of llama-server, empty disables save/restore
+	MaxDiskMB int    `yaml:"maxDiskMB"` // the oldest saved slots beyond are deleted, default 4096
+}
+
+// ModelHooks are called when an external model is loaded or unloaded,
+// e.g. the load/unload API of llama-server in router mode (--models-preset).
+type ModelHooks struct {
+	OnLoad   EndpointHook `yaml:"on_load"`
+	OnUnload EndpointHook `yaml:"on_unload"`
+}
+
+// EndpointHook is an HTTP request sent to the proxy URL. An empty Path disables the hook.
+type EndpointHook struct {
+	Method string `yaml:"method"` // default POST
+	Path   string `yaml:"path"`   // joined to the proxy URL
+	Body   string `yaml:"body"`   // sent as application/json
+}
+
+// ModelHealthCheck configures the periodic probes of the checkEndpoint
+// once the process is Ready. Startup uses its own timeout (startupTimeout).
+// A zero Interval disables the runtime probes.
+type ModelHealthCheck struct {
+	// seconds between two probes
+	Interval int `yaml:"interval"`
+	// seconds to wait for a probe response, default 5
+	Timeout int `yaml:"timeout"`
+	// consecutive failed probes before the process is stopped (restarted by the next request), default 3
+	FailureThreshold int `yaml:"failureThreshold"`
+}
+
+// ProbeTimeout returns the per-probe timeout with its default value.
+func (h ModelHealthCheck) ProbeTimeout() time.Duration {
+	if h.Timeout > 0 {
+		return time.Duration(h.Timeout) * time.Second
+	}
+	return 5 * time.Second
+}
+
+// Threshold returns the number of consecutive failures with its default value.
+func (h ModelHealthCheck) Threshold() int {
+	if h.FailureThreshold > 0 {
+		return h.FailureThreshold
+	}
+	return 3
+}
+
 // ModelFilters see issue #174.
 type ModelFilters struct {
 	StripParams string `yaml:"stripParams"`
@@ -7,6 +7,7 @@ package config
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -75,3 +76,178 @@ models:
 		assert.True(t, *cfg.Models["model2"].SendLoadingState)
 	}
 }
+
+func TestConfig_ModelHealthCheck(t *testing.T) {
+	content := `
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    startupTimeout: 7200
+    healthCheck:
+      interval: 10
+      timeout: 2
+      failureThreshold: 5
+  model2:
+    cmd: path/to/cmd --port ${PORT}
+`
+	cfg, err := LoadConfigFromReader(strings.NewReader(content))
+	assert.NoError(t, err)
+
+	model1 := cfg.Models["model1"]
+	assert.Equal(t, 7200, model1.StartupTimeout)
+	assert.Equal(t, 10, model1.HealthCheck.Interval)
+	assert.Equal(t, 2*time.Second, model1.HealthCheck.ProbeTimeout())
+	assert.Equal(t, 5, model1.HealthCheck.Threshold())
+
+	// runtime probes are disabled by default
+	model2 := cfg.Models["model2"]
+	assert.Equal(t, 0, model2.StartupTimeout)
+	assert.Equal(t, 0, model2.HealthCheck.Interval)
+	assert.Equal(t, 5*time.Second, model2.HealthCheck.ProbeTimeout())
+	assert.Equal(t, 3, model2.HealthCheck.Threshold())
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    healthCheck:
+      interval: -1
+`))
+	assert.ErrorContains(t, err, "must not be negative")
+}
+
+func TestConfig_ModelExternal(t *testing.T) {
+	content := `
+models:
+  external:
+    proxy: http://10.0.0.5:8080
+    hooks:
+      on_load:
+        path: /models/load
+        body: '{"model": "${MODEL_ID}"}'
+      on_unload:
+        path: /models/unload
+        body: '{"model": "${MODEL_ID}"}'
+  local:
+    cmd: path/to/cmd --port ${PORT}
+`
+	cfg, err := LoadConfigFromReader(strings.NewReader(content))
+	assert.NoError(t, err)
+
+	external := cfg.Models["external"]
+	assert.True(t, external.IsExternal())
+	assert.Equal(t, "/models/load", external.Hooks.OnLoad.Path)
+	assert.Equal(t, `{"model": "external"}`, external.Hooks.OnLoad.Body)
+	assert.Equal(t, `{"model": "external"}`, external.Hooks.OnUnload.Body)
+	assert.False(t, cfg.Models["local"].IsExternal())
+
+	// the default proxy URL uses the ${PORT} of the cmd
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  external:
+    checkEndpoint: /health
+`))
+	assert.ErrorContains(t, err, "requires the proxy URL")
+}
+
+func TestConfig_ModelRouter(t *testing.T) {
+	content := `
+startPort: 9000
+models:
+  router:
+    cmd: llama-server --port ${PORT} --models-preset models.ini
+  preset1:
+    router: router
+    ttl: 60
+  preset2:
+    router: router
+    useModelName: qwen
+groups:
+  routers:
+    persistent: true
+    members: [router]
+`
+	cfg, err := LoadConfigFromReader(strings.NewReader(content))
+	assert.NoError(t, err)
+
+	preset1 := cfg.Models["preset1"]
+	assert.Equal(t, "http://localhost:9000", preset1.Proxy)
+	assert.Equal(t, "preset1", preset1.UseModelName)
+	assert.Equal(t, "/models", preset1.CheckEndpoint)
+	assert.Equal(t, EndpointHook{Method: "POST", Path: "/models/load", Body: `{"model":"preset1"}`}, preset1.Hooks.OnLoad)
+	assert.Equal(t, EndpointHook{Method: "POST", Path: "/models/unload", Body: `{"model":"preset1"}`}, preset1.Hooks.OnUnload)
+	assert.Equal(t, `{"model":"qwen"}`, cfg.Models["preset2"].Hooks.OnLoad.Body)
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  preset1:
+    router: missing
+`))
+	assert.ErrorContains(t, err, "router missing not found")
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  router:
+    cmd: llama-server --port ${PORT}
+  preset1:
+    router: router
+    cmd: llama-server --port ${PORT}
+`))
+	assert.ErrorContains(t, err, "must not have a cmd")
+
+	// the router is not stopped by its presets
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  router:
+    cmd: llama-server --port ${PORT}
+  preset1:
+    router: router
+`))
+	assert.ErrorContains(t, err, "router router must be in a persistent group")
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  router:
+    cmd: llama-server --port ${PORT}
+  preset1:
+    router: router
+groups:
+  routers:
+    persistent: true
+    members: [router, preset1]
+`))
+	assert.ErrorContains(t, err, "must not be in the same swap group")
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  router:
+    cmd: llama-server --port ${PORT}
+    ttl: 300
+  preset1:
+    router: router
+groups:
+  routers:
+    persistent: true
+    members: [router]
+`))
+	assert.ErrorContains(t, err, "router router: ttl is not supported")
+}
+
+func TestConfig_ModelSlots(t *testing.T) {
+	cfg, err := LoadConfigFromReader(strings.NewReader(`
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT} --parallel 4 --slot-save-path /tmp/slots
+    slots: {count: 4, savePath: /tmp/slots, maxDiskMB: 512}
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, SlotsConfig{Count: 4, SavePath: "/tmp/slots", MaxDiskMB: 512}, cfg.Models["model1"].Slots)
+
+	_, err = LoadConfigFromReader(strings.NewReader(`
+models:
+  model1:
+    cmd: path/to/cmd --port ${PORT}
+    slots: {savePath: /tmp/slots}
+`))
+	assert.ErrorContains(t, err, "slots.savePath requires slots.count")
+}
@@ -8,6 +8,11 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 )
 
 type (
@@ -17,15 +22,74 @@ type (
 		ProxyURL *url.URL `yaml:"-"`
 		ApiKey   string   `yaml:"apiKey"`
 		Models   []string `yaml:"models"`
+
+		// served model name => model name sent to the peer (provider)
+		ModelNames map[string]string `yaml:"modelNames"`
+
+		// headers sent to the peer, ${apiKey} is replaced by the apiKey,
+		// default: Authorization: Bearer ${apiKey} and X-Api-Key: ${apiKey}
+		Headers map[string]string `yaml:"headers"`
+
+		// API keys allowed to use the (paid) models of the peer
+		Access PeerAccess `yaml:"access"`
+
+		// USD per million tokens by served model name,
+		// used when the response usage has no cost
+		Pricing map[string]ModelPricing `yaml:"pricing"`
+
+		// translate /v1/messages to /v1/chat/completions, see ModelConfig
+		TranslateMessages bool `yaml:"translateMessages"`
+
+		// add the models listed by the peer /v1/models, polled every health.interval
+		Discover bool `yaml:"discover"`
+
+		Health PeerHealth `yaml:"health"`
+	}
+
+	// PeerHealth polls the peer and opens its circuit after consecutive failures:
+	// the requests fail fast (503) and its models are hidden until a poll or a probe request succeeds.
+	PeerHealth struct {
+		Interval         int `yaml:"interval"`         // seconds between polls of /v1/models, 0 disables polling (default, 30 with discover)
+		FailureThreshold int `yaml:"failureThreshold"` // consecutive failures (polls or requests) opening the circuit, default 3
+		Cooldown         int `yaml:"cooldown"`         // seconds before a request probes an open circuit, default 30
+	}
+
+	// PeerAccess restricts the API keys using the models of a peer.
+	PeerAccess struct {
+		Models []string `yaml:"models"` // restricted models (served names), empty restricts all
+		Allow  []string `yaml:"allow"`  // key names (apiKeyQuotas) or identifiers (key-xxxxxxxx), empty allows all
+		Deny   []string `yaml:"deny"`
+	}
+
+	ModelPricing struct {
+		Input  float64 `yaml:"input"`  // USD per million input tokens
+		Output float64 `yaml:"output"` // USD per million output tokens
 	}
 )
 
+// envRegex matches ${env.NAME}: the provider keys can stay out of the config file.
+var envRegex = regexp.MustCompile(`\$\{env\.([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+func expandEnv(s string) (string, error) {
+	var err error
+	s = envRegex.ReplaceAllStringFunc(s, func(m string) string {
+		name := envRegex.FindStringSubmatch(m)[1]
+		value, found := os.LookupEnv(name)
+		if !found {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value
+	})
+	return s, err
+}
+
 func (c *PeerConfig) UnmarshalYAML(unmarshal func(any) error) error {
 	type rawPeerConfig PeerConfig
 	defaults := rawPeerConfig{
 		Proxy:  "",
 		ApiKey: "",
 		Models: []string{},
+		Health: PeerHealth{FailureThreshold: 3, Cooldown: 30},
 	}
 
 	if err := unmarshal(&defaults); err != nil {
@@ -45,10 +109,98 @@ func (c *PeerConfig) UnmarshalYAML(unmarshal func(any) error) error {
 	defaults.ProxyURL = parsedURL
 
 	// Validate models is not empty
-	if len(defaults.Models) == 0 {
+	if len(defaults.Models) == 0 && len(defaults.ModelNames) == 0 && !defaults.Discover {
 		return errors.New("peer models can not be empty")
 	}
 
-	*c = PeerConfig(defaults)
+	if defaults.Discover && defaults.Health.Interval <= 0 {
+		defaults.Health.Interval = 30
+	}
+	if defaults.Health.FailureThreshold < 1 {
+		defaults.Health.FailureThreshold = 3
+	}
+	if defaults.Health.Cooldown < 1 {
+		defaults.Health.Cooldown = 30
+	}
+
+	if defaults.ApiKey, err = expandEnv(defaults.ApiKey); err != nil {
+		return fmt.Errorf("peer apiKey: %w", err)
+	}
+	for name, value := range defaults.Headers {
+		if defaults.Headers[name], err = expandEnv(value); err != nil {
+			return fmt.Errorf("peer header %s: %w", name, err)
+		}
+	}
+
+	peer := PeerConfig(defaults)
+	served := peer.ServedModels()
+	for _, model := range defaults.Access.Models {
+		if !slices.Contains(served, model) {
+			return fmt.Errorf("peer access.models: unknown model %s", model)
+		}
+	}
+	for model := range defaults.Pricing {
+		if !slices.Contains(served, model) {
+			return fmt.Errorf("peer pricing: unknown model %s", model)
+		}
+	}
+
+	*c = peer
 	return nil
 }
+
+// ServedModels returns the models listed in models and modelNames, sorted.
+func (c PeerConfig) ServedModels() []string {
+	models := slices.Clone(c.Models)
+	for name := range c.ModelNames {
+		if !slices.Contains(models, name) {
+			models = append(models, name)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// UpstreamModelName returns the model name sent to the peer.
+func (c PeerConfig) UpstreamModelName(model string) string {
+	if name, found := c.ModelNames[model]; found && name != "" {
+		return name
+	}
+	return model
+}
+
+// AuthHeaders returns the headers injected in the requests to the peer.
+func (c PeerConfig) AuthHeaders() map[string]string {
+	if len(c.Headers) == 0 {
+		if c.ApiKey == "" {
+			return nil
+		}
+		return map[string]string{"Authorization": "Bearer " + c.ApiKey, "X-Api-Key": c.ApiKey}
+	}
+	headers := make(map[string]string, len(c.Headers))
+	for name, value := range c.Headers {
+		headers[name] = strings.ReplaceAll(value, "${apiKey}", c.ApiKey)
+	}
+	return headers
+}
+
+// KeyAllowed reports whether the API key (identifier, empty when no key is required) may use the model.
+func (c PeerConfig) KeyAllowed(model, keyID string) bool {
+	a := c.Access
+	if len(a.Models) > 0 && !slices.Contains(a.Models, model) {
+		return true
+	}
+	if slices.Contains(a.Deny, keyID) {
+		return false
+	}
+	return len(a.Allow) == 0 || slices.Contains(a.Allow, keyID)
+}
+
+// Cost returns the USD cost of the tokens from the pricing, zero if the model has none.
+func (c PeerConfig) Cost(model string, inputTokens, outputTokens int) float64 {
+	p, found := c.Pricing[model]
+	if !found {
+		return 0
+	}
+	return (float64(max(inputTokens, 0))*p.Input + float64(max(outputTokens, 0))*p.Output) / 1e6
+}
@@ -77,6 +77,52 @@ models: []
 `,
 			wantErr: "peer models can not be empty",
 		},
+		{
+			name: "model names only",
+			yaml: `
+proxy: https://openrouter.ai/api
+modelNames:
+  r1: deepseek/deepseek-r1
+`,
+			wantErr: "",
+		},
+		{
+			name: "discovered models only",
+			yaml: `
+proxy: http://192.168.1.23:8080
+discover: true
+`,
+			wantErr: "",
+		},
+		{
+			name: "access to an unknown model",
+			yaml: `
+proxy: http://localhost:8080
+models: [model_a]
+access:
+  models: [model_b]
+`,
+			wantErr: "peer access.models: unknown model model_b",
+		},
+		{
+			name: "pricing of an unknown model",
+			yaml: `
+proxy: http://localhost:8080
+models: [model_a]
+pricing:
+  model_b: {input: 1, output: 2}
+`,
+			wantErr: "peer pricing: unknown model model_b",
+		},
+		{
+			name: "unset environment variable",
+			yaml: `
+proxy: http://localhost:8080
+apiKey: ${env.GOINFER_TEST_UNSET_KEY}
+models: [model_a]
+`,
+			wantErr: "peer apiKey: environment variable GOINFER_TEST_UNSET_KEY is not set",
+		},
 	}
 
 	for _, tt := range tests {
@@ -129,6 +175,91 @@ models:
 	}
 }
 
+func TestPeerConfig_Health(t *testing.T) {
+	var config PeerConfig
+	if err := yaml.Unmarshal([]byte("proxy: http://peer:8080\nmodels: [a]\n"), &config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Health != (PeerHealth{FailureThreshold: 3, Cooldown: 30}) {
+		t.Errorf("unexpected defaults %+v", config.Health)
+	}
+
+	if err := yaml.Unmarshal([]byte("proxy: http://peer:8080\ndiscover: true\nhealth:\n  cooldown: 5\n"), &config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Health != (PeerHealth{Interval: 30, FailureThreshold: 3, Cooldown: 5}) {
+		t.Errorf("discover polls every 30s by default, got %+v", config.Health)
+	}
+}
+
+func TestPeerConfig_Provider(t *testing.T) {
+	t.Setenv("GOINFER_TEST_OPENROUTER_KEY", "sk-or-123")
+	yamlData := `
+proxy: https://openrouter.ai/api
+apiKey: ${env.GOINFER_TEST_OPENROUTER_KEY}
+headers:
+  Authorization: Bearer ${apiKey}
+  HTTP-Referer: https://example.org
+models: [free-model]
+modelNames:
+  r1: deepseek/deepseek-r1
+access:
+  models: [r1]
+  allow: [team-a, team-b]
+  deny: [team-b]
+pricing:
+  r1: {input: 0.5, output: 2}
+`
+	var config PeerConfig
+	if err := yaml.Unmarshal([]byte(yamlData), &config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := config.AuthHeaders(); len(got) != 2 || got["Authorization"] != "Bearer sk-or-123" || got["HTTP-Referer"] != "https://example.org" {
+		t.Errorf("unexpected headers %v", got)
+	}
+	if got := config.ServedModels(); len(got) != 2 || got[0] != "free-model" || got[1] != "r1" {
+		t.Errorf("unexpected served models %v", got)
+	}
+	if got := config.UpstreamModelName("r1"); got != "deepseek/deepseek-r1" {
+		t.Errorf("unexpected upstream name %q", got)
+	}
+	if got := config.UpstreamModelName("free-model"); got != "free-model" {
+		t.Errorf("unexpected upstream name %q", got)
+	}
+
+	for _, tt := range []struct {
+		model, key string
+		allowed    bool
+	}{
+		{"r1", "team-a", true},
+		{"r1", "team-b", false}, // denied
+		{"r1", "key-12345678", false},
+		{"r1", "", false}, // no API key required
+		{"free-model", "key-12345678", true},
+	} {
+		if got := config.KeyAllowed(tt.model, tt.key); got != tt.allowed {
+			t.Errorf("KeyAllowed(%q, %q) = %v, expected %v", tt.model, tt.key, got, tt.allowed)
+		}
+	}
+
+	if got := config.Cost("r1", 1000, 500); got != 0.0015 {
+		t.Errorf("unexpected cost %v", got)
+	}
+	if got := config.Cost("free-model", 1000, 500); got != 0 {
+		t.Errorf("unexpected cost %v", got)
+	}
+
+	// default headers
+	config = PeerConfig{ApiKey: "sk-peer"}
+	if got := config.AuthHeaders(); got["Authorization"] != "Bearer sk-peer" || got["X-Api-Key"] != "sk-peer" {
+		t.Errorf("unexpected default headers %v", got)
+	}
+	if got := (PeerConfig{}).AuthHeaders(); got != nil {
+		t.Errorf("unexpected headers without apiKey %v", got)
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && searchSubstring(s, substr)
 }
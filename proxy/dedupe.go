@@ -0,0 +1,219 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dedupeGroup shares one upstream call between the concurrent requests
+// having the same key, see ModelConfig.Dedupe.
+type dedupeGroup struct {
+	calls map[string]*dedupeCall
+	mu    sync.Mutex
+}
+
+func newDedupeGroup() *dedupeGroup {
+	return &dedupeGroup{calls: make(map[string]*dedupeCall)}
+}
+
+// do sends the response of the shared call to the client, starting the call with run if none is in flight.
+// The call runs detached from the clients: it is cancelled once all of them have left.
+func (g *dedupeGroup) do(c *gin.Context, key string, run func(c *gin.Context)) {
+	g.mu.Lock()
+	call, found := g.calls[key]
+	if !found {
+		ctx, cancel := context.WithCancel(context.WithoutCancel(c.Request.Context()))
+		call = &dedupeCall{header: make(http.Header), notify: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+
+		shared := c.Copy()
+		shared.Request = c.Request.Clone(ctx)
+		shared.Writer = call
+		go func() {
+			defer cancel()
+			run(shared)
+			call.finish()
+			g.forget(key, call)
+		}()
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	if call.send(c) {
+		g.mu.Lock()
+		call.waiters--
+		g.mu.Unlock()
+		return
+	}
+
+	// the client left
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	call.waiters--
+	if call.waiters == 0 {
+		call.cancel()
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+	}
+}
+
+func (g *dedupeGroup) forget(key string, call *dedupeCall) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
+
+// dedupeCall records the response of the shared call,
+// the clients joining late get it from the start.
+type dedupeCall struct {
+	header  http.Header // of the shared call, copied into sent by WriteHeader
+	sent    http.Header
+	notify  chan struct{} // closed and replaced on each change
+	cancel  context.CancelFunc
+	chunks  [][]byte
+	size    int
+	status  int
+	waiters int // guarded by dedupeGroup.mu
+	done    bool
+	mu      sync.Mutex
+}
+
+// send writes the response to the client as it comes, it returns false if the client left before the end.
+func (call *dedupeCall) send(c *gin.Context) bool {
+	w := c.Writer
+	next := 0
+	for {
+		call.mu.Lock()
+		status, header, done, notify := call.status, call.sent, call.done, call.notify
+		chunks := call.chunks[next:]
+		call.mu.Unlock()
+
+		if status != 0 && next == 0 && !w.Written() {
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(status)
+		}
+		for _, b := range chunks {
+			w.Write(b)
+		}
+		next += len(chunks)
+		if len(chunks) > 0 {
+			w.Flush()
+		}
+		if done {
+			w.WriteHeaderNow()
+			return true
+		}
+
+		select {
+		case <-notify:
+		case <-c.Request.Context().Done():
+			return false
+		}
+	}
+}
+
+// changed wakes up the clients, the caller holds call.mu.
+func (call *dedupeCall) changed() {
+	close(call.notify)
+	call.notify = make(chan struct{})
+}
+
+func (call *dedupeCall) finish() {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+	if call.status == 0 {
+		call.status = http.StatusOK
+		call.sent = call.header.Clone()
+	}
+	call.done = true
+	call.changed()
+}
+
+// the gin.ResponseWriter of the shared call
+
+func (call *dedupeCall) Header() http.Header {
+	return call.header
+}
+
+func (call *dedupeCall) WriteHeader(statusCode int) {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+	if call.status != 0 {
+		return
+	}
+	call.status = statusCode
+	call.sent = call.header.Clone()
+	call.changed()
+}
+
+func (call *dedupeCall) WriteHeaderNow() {
+	call.WriteHeader(http.StatusOK)
+}
+
+func (call *dedupeCall) Write(b []byte) (int, error) {
+	call.WriteHeader(http.StatusOK)
+	call.mu.Lock()
+	defer call.mu.Unlock()
+	call.chunks = append(call.chunks, bytes.Clone(b))
+	call.size += len(b)
+	call.changed()
+	return len(b), nil
+}
+
+func (call *dedupeCall) WriteString(s string) (int, error) {
+	return call.Write([]byte(s))
+}
+
+func (call *dedupeCall) Status() int {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+	if call.status == 0 {
+		return http.StatusOK
+	}
+	return call.status
+}
+
+func (call *dedupeCall) Size() int {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+	if call.status == 0 {
+		return -1
+	}
+	return call.size
+}
+
+func (call *dedupeCall) Written() bool {
+	call.mu.Lock()
+	defer call.mu.Unlock()
+	return call.status != 0
+}
+
+func (call *dedupeCall) Flush() {} // each Write is sent to the clients
+
+func (call *dedupeCall) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijacking a shared request is not supported")
+}
+
+func (call *dedupeCall) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func (call *dedupeCall) Pusher() http.Pusher {
+	return nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyManager_Dedupe(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	upstreamCancelled := make(chan struct{}, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			return
+		}
+		calls.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"n\":1}\n\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+			w.Write([]byte("data: [DONE]\n\n"))
+		case <-r.Context().Done():
+			upstreamCancelled <- struct{}{}
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": {Proxy: upstream.URL, CheckEndpoint: "/health", Dedupe: true},
+		},
+		LogLevel: "error",
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	waiters := func() int {
+		proxy.dedupe.mu.Lock()
+		defer proxy.dedupe.mu.Unlock()
+		n := 0
+		for _, call := range proxy.dedupe.calls {
+			n += call.waiters
+		}
+		return n
+	}
+	post := func(ctx context.Context, body string) *TestResponseRecorder {
+		w := CreateTestResponseRecorder()
+		req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		proxy.ServeHTTP(w, req)
+		return w
+	}
+
+	// three identical requests (keys in any order), one upstream call, the first client leaves
+	ctx, cancel := context.WithCancel(t.Context())
+	var wg sync.WaitGroup
+	responses := make([]*TestResponseRecorder, 3)
+	for i, body := range []string{
+		`{"model":"model1","stream":true,"messages":[]}`,
+		`{"messages":[],"stream":true,"model":"model1"}`,
+		`{"model":"model1","stream":true,"messages":[]}`,
+	} {
+		reqCtx := t.Context()
+		if i == 0 {
+			reqCtx = ctx
+		}
+		wg.Go(func() { responses[i] = post(reqCtx, body) })
+		require.Eventually(t, func() bool { return waiters() == i+1 }, 5*time.Second, 10*time.Millisecond)
+	}
+	cancel()
+	require.Eventually(t, func() bool { return waiters() == 2 }, 5*time.Second, 10*time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for _, w := range responses[1:] {
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.Equal(t, "data: {\"n\":1}\n\ndata: [DONE]\n\n", w.Body.String())
+	}
+	assert.Empty(t, proxy.dedupe.calls)
+
+	// the shared call is cancelled when the last client leaves
+	release = make(chan struct{})
+	ctx, cancel = context.WithCancel(t.Context())
+	go post(ctx, `{"model":"model1","stream":true,"messages":[]}`)
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	select {
+	case <-upstreamCancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the upstream request was not cancelled")
+	}
+}
+
+func TestProxyManager_DedupePerKey(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			return
+		}
+		calls.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":10,"completion_tokens":5}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": {Proxy: upstream.URL, CheckEndpoint: "/health", Dedupe: true},
+		},
+		RequiredAPIKeys: []string{"sk-a", "sk-b"},
+		APIKeyQuotas:    []config.APIKeyQuota{{Name: "a", Key: "sk-a"}, {Name: "b", Key: "sk-b"}},
+		LogLevel:        "error",
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	// one shared call per key, the tokens of each key are counted
+	var wg sync.WaitGroup
+	for _, key := range []string{"sk-a", "sk-a", "sk-b"} {
+		wg.Go(func() {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"model1","messages":[]}`))
+			req.Header.Set("Authorization", "Bearer "+key)
+			w := CreateTestResponseRecorder()
+			proxy.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+	require.Eventually(t, func() bool {
+		proxy.dedupe.mu.Lock()
+		defer proxy.dedupe.mu.Unlock()
+		waiters := 0
+		for _, call := range proxy.dedupe.calls {
+			waiters += call.waiters
+		}
+		return waiters == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), calls.Load())
+	keys := []string{}
+	for _, tm := range proxy.metricsMonitor.getMetrics() {
+		keys = append(keys, tm.APIKey)
+	}
+	assert.ElementsMatch(t, []string{"a", "b"}, keys)
+}
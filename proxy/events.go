@@ -13,6 +13,7 @@ const (
 	LogDataEventID             = 0x04
 	TokenMetricsEventID        = 0x05
 	ModelPreloadedEventID      = 0x06
+	ModelLoadProgressEventID   = 0x07
 )
 
 type ProcessStateChangeEvent struct {
@@ -64,3 +65,13 @@ type ModelPreloadedEvent struct {
 func (e ModelPreloadedEvent) Type() uint32 {
 	return ModelPreloadedEventID
 }
+
+// ModelLoadProgressEvent is emitted when the startup stage or percentage of a process changes.
+type ModelLoadProgressEvent struct {
+	ProcessName string
+	Progress    LoadProgress
+}
+
+func (e ModelLoadProgressEvent) Type() uint32 {
+	return ModelLoadProgressEventID
+}
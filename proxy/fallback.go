@@ -0,0 +1,113 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// servedModelHeader names the model that served the request, the requested one or a fallback.
+const servedModelHeader = "X-Served-Model"
+
+// fallbacks returns the fallback models of the requested model, see ModelConfig.Fallbacks.
+func (pm *ProxyManager) fallbacks(ctx context.Context, requestedModel string) []string {
+	modelID, found := pm.realModelName(ctx, requestedModel)
+	if !found {
+		return nil
+	}
+	return pm.cfg.Swap.Models[modelID].Fallbacks
+}
+
+// fallbackStatus reports whether the next fallback is tried: start failure (502),
+// unhealthy or health timeout (502, 503), upstream errors (5xx) and queue overflow (429).
+func fallbackStatus(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// fallbackWriter holds the headers until the status is known: a failure before
+// any byte was sent to the client is discarded, unless it is the last model,
+// the other responses go through.
+type fallbackWriter struct {
+	gin.ResponseWriter // the client
+	header             http.Header
+	model              string
+	last               bool
+	status             int
+	failed             bool
+}
+
+func newFallbackWriter(client gin.ResponseWriter, model string, last bool) *fallbackWriter {
+	return &fallbackWriter{ResponseWriter: client, header: make(http.Header), model: model, last: last}
+}
+
+func (fw *fallbackWriter) Header() http.Header {
+	if fw.status != 0 && !fw.failed {
+		return fw.ResponseWriter.Header()
+	}
+	return fw.header
+}
+
+func (fw *fallbackWriter) WriteHeader(statusCode int) {
+	if fw.status != 0 {
+		return
+	}
+	fw.status = statusCode
+	if !fw.last && fallbackStatus(statusCode) {
+		fw.failed = true
+		return
+	}
+	header := fw.ResponseWriter.Header()
+	for name, values := range fw.header {
+		header[name] = values
+	}
+	header.Set(servedModelHeader, fw.model)
+	fw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (fw *fallbackWriter) WriteHeaderNow() {
+	fw.WriteHeader(http.StatusOK)
+	if !fw.failed {
+		fw.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (fw *fallbackWriter) Status() int {
+	if fw.status == 0 {
+		return http.StatusOK
+	}
+	return fw.status
+}
+
+func (fw *fallbackWriter) Written() bool {
+	return fw.status != 0
+}
+
+func (fw *fallbackWriter) Size() int {
+	if fw.failed {
+		return 0
+	}
+	return fw.ResponseWriter.Size()
+}
+
+func (fw *fallbackWriter) WriteString(s string) (int, error) {
+	return fw.Write([]byte(s))
+}
+
+func (fw *fallbackWriter) Write(b []byte) (int, error) {
+	fw.WriteHeader(http.StatusOK)
+	if fw.failed {
+		return len(b), nil
+	}
+	return fw.ResponseWriter.Write(b)
+}
+
+func (fw *fallbackWriter) Flush() {
+	if fw.status != 0 && !fw.failed {
+		fw.ResponseWriter.Flush()
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestFallbackWriter(t *testing.T) {
+	w := CreateTestResponseRecorder()
+	c, _ := gin.CreateTestContext(w)
+	fw := newFallbackWriter(c.Writer, "model1", false)
+	fw.Header().Set("Content-Type", "text/plain")
+	http.Error(fw, "unable to start process", http.StatusBadGateway)
+	fw.Flush()
+	assert.True(t, fw.failed)
+	assert.False(t, c.Writer.Written(), "nothing sent to the client")
+	assert.Empty(t, w.Header().Get("Content-Type"))
+
+	fw = newFallbackWriter(c.Writer, "model2", false)
+	fw.Header().Set("Content-Type", "application/json")
+	fw.Write([]byte(`{}`))
+	assert.False(t, fw.failed)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "model2", w.Header().Get(servedModelHeader))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{}`, w.Body.String())
+}
+
+func TestProxyManager_Fallbacks(t *testing.T) {
+	var mu sync.Mutex
+	var served []string
+	upstream := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/chat/completions" {
+				return
+			}
+			io.ReadAll(r.Body)
+			mu.Lock()
+			served = append(served, name)
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"from":"` + name + `"}`))
+		}))
+	}
+	failing := upstream("failing", http.StatusInternalServerError)
+	defer failing.Close()
+	working := upstream("working", http.StatusOK)
+	defer working.Close()
+	rejecting := upstream("rejecting", http.StatusBadRequest)
+	defer rejecting.Close()
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"broken":    {Cmd: "nonexistent-command", Proxy: working.URL, CheckEndpoint: "/health", Fallbacks: []string{"failing", "working"}},
+			"failing":   {Proxy: failing.URL, CheckEndpoint: "/health", Fallbacks: []string{"working"}},
+			"working":   {Proxy: working.URL, CheckEndpoint: "/health"},
+			"rejecting": {Proxy: rejecting.URL, CheckEndpoint: "/health", Fallbacks: []string{"working"}},
+		},
+		LogLevel: "error",
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	post := func(model string) *TestResponseRecorder {
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+model+`"}`)))
+		return w
+	}
+
+	// start failure, then 5xx: the fallbacks are followed in order, the fallbacks of a fallback are not
+	w := post("broken")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "working", w.Header().Get(servedModelHeader))
+	assert.Equal(t, "working", gjson.Get(w.Body.String(), "from").String())
+	mu.Lock()
+	assert.Equal(t, []string{"failing", "working"}, served)
+	mu.Unlock()
+
+	// the last model answers whatever the status
+	w = post("failing")
+	assert.Equal(t, http.StatusOK, w.Code)
+	cfg.Swap.Models["failing"].Fallbacks = nil
+	w = post("failing")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "failing", w.Header().Get(servedModelHeader))
+
+	// client errors are not retried
+	w = post("rejecting")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "rejecting", w.Header().Get(servedModelHeader))
+	assert.Equal(t, `{"from":"rejecting"}`, w.Body.String())
+}
+
+func TestProxyManager_FallbackPeer(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]http.Header{}
+	upstream := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/chat/completions" {
+				return
+			}
+			io.ReadAll(r.Body)
+			mu.Lock()
+			received[name] = r.Header.Clone()
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"from":"` + name + `"}`))
+		}))
+	}
+	failing := upstream("failing", http.StatusInternalServerError)
+	defer failing.Close()
+	provider := upstream("provider", http.StatusServiceUnavailable)
+	defer provider.Close()
+	backup := upstream("backup", http.StatusOK)
+	defer backup.Close()
+	providerURL, _ := url.Parse(provider.URL)
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"primary": {Proxy: failing.URL, CheckEndpoint: "/health", Fallbacks: []string{"paid", "backup"}},
+			"backup":  {Proxy: backup.URL, CheckEndpoint: "/health"},
+		},
+		Peers: config.PeerDictionaryConfig{
+			"provider": {
+				Proxy:    provider.URL,
+				ProxyURL: providerURL,
+				ApiKey:   "sk-provider",
+				Headers:  map[string]string{"Authorization": "Bearer ${apiKey}", "X-Title": "goinfer"},
+				Models:   []string{"paid"},
+			},
+		},
+		LogLevel: "error",
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"primary"}`))
+	req.Header.Set("X-Api-Key", "sk-client")
+	w := CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "backup", w.Header().Get(servedModelHeader))
+
+	// the provider gets its own credentials only, the next fallback does not get them
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 3)
+	assert.Equal(t, "Bearer sk-provider", received["provider"].Get("Authorization"))
+	assert.Empty(t, received["provider"].Get("X-Api-Key"))
+	assert.Empty(t, received["backup"].Get("Authorization"))
+	assert.Empty(t, received["backup"].Get("X-Title"))
+	assert.Equal(t, "sk-client", received["backup"].Get("X-Api-Key"))
+
+	// the local fallback is not recorded under the failed peer
+	metrics := proxy.metricsMonitor.getMetrics()
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "backup", metrics[0].Model)
+	assert.Empty(t, metrics[0].Peer)
+}
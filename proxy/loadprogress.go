@@ -0,0 +1,192 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// LoadStage is a step of the llama-server startup.
+type LoadStage string
+
+const (
+	LoadStageDownloading LoadStage = "downloading" // -hf download
+	LoadStageLoading     LoadStage = "loading"     // reading the GGUF metadata
+	LoadStageTensors     LoadStage = "tensors"     // loading the tensors (dots progress bar)
+	LoadStageContext     LoadStage = "context"     // allocating the context and KV cache
+	LoadStageWarmup      LoadStage = "warmup"      // warmup run
+	LoadStageReady       LoadStage = "ready"       // llama-server is listening
+)
+
+// LoadProgress is the last stage parsed from the upstream output.
+// Percent is -1 when the stage does not report any percentage.
+type LoadProgress struct {
+	Stage   LoadStage `json:"stage"`
+	Percent int       `json:"percent"`
+}
+
+// String returns a human readable progress, used by the SSE loading messages.
+func (lp LoadProgress) String() string {
+	var label string
+	switch lp.Stage {
+	case LoadStageDownloading:
+		label = "Downloading model"
+	case LoadStageLoading:
+		label = "Reading model metadata"
+	case LoadStageTensors:
+		label = "Loading tensors"
+	case LoadStageContext:
+		label = "Allocating context"
+	case LoadStageWarmup:
+		label = "Warming up"
+	case LoadStageReady:
+		label = "Model loaded"
+	default:
+		return ""
+	}
+	if lp.Percent < 0 {
+		return label + "..."
+	}
+	return fmt.Sprintf("%s: %d%%", label, lp.Percent)
+}
+
+var percentRegex = regexp.MustCompile(`(\d{1,3})(?:\.\d+)?\s?%`)
+
+// loadProgressParser is an io.Writer receiving the llama-server output.
+// It extracts the startup stages and their percentages,
+// and calls onProgress each time the stage or the percentage changes.
+type loadProgressParser struct {
+	onProgress func(LoadProgress)
+	line       []byte
+	progress   LoadProgress
+	dots       int  // llama.cpp prints one dot per percent while loading the tensors
+	dotsOnly   bool // the current line only contains dots
+	mu         sync.RWMutex
+}
+
+func newLoadProgressParser(onProgress func(LoadProgress)) *loadProgressParser {
+	return &loadProgressParser{onProgress: onProgress, dotsOnly: true}
+}
+
+// Reset forgets the previous startup, called before starting the upstream command.
+func (lp *loadProgressParser) Reset() {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	lp.line = lp.line[:0]
+	lp.progress = LoadProgress{}
+	lp.dots = 0
+	lp.dotsOnly = true
+}
+
+// Progress returns the last parsed progress, Stage is empty before the first stage.
+func (lp *loadProgressParser) Progress() LoadProgress {
+	lp.mu.RLock()
+	defer lp.mu.RUnlock()
+	return lp.progress
+}
+
+// Write never fails: parsing issues must not break the upstream output.
+func (lp *loadProgressParser) Write(p []byte) (int, error) {
+	lp.mu.Lock()
+	var changes []LoadProgress
+	for _, b := range p {
+		if lp.progress.Stage == LoadStageReady {
+			break // nothing more to parse until Reset()
+		}
+
+		switch b {
+		case '\n', '\r': // download progress bars are refreshed using \r
+			if changed := lp.parseLine(bytes.TrimSpace(lp.line)); changed {
+				changes = append(changes, lp.progress)
+			}
+			lp.line = lp.line[:0]
+			lp.dotsOnly = true
+			continue
+		case '.':
+			if lp.dotsOnly && lp.progress.Stage == LoadStageTensors {
+				lp.dots++
+				if pct := min(lp.dots, 100); pct != lp.progress.Percent {
+					lp.progress.Percent = pct
+					changes = append(changes, lp.progress)
+				}
+			}
+		default:
+			lp.dotsOnly = false
+		}
+		lp.line = append(lp.line, b)
+	}
+	lp.mu.Unlock()
+
+	if lp.onProgress != nil {
+		for _, c := range changes {
+			lp.onProgress(c)
+		}
+	}
+	return len(p), nil
+}
+
+// parseLine updates the progress from a complete line, returns true if the progress changed.
+func (lp *loadProgressParser) parseLine(line []byte) bool {
+	if len(line) == 0 {
+		return false
+	}
+
+	next := lp.progress
+	switch {
+	case bytes.Contains(line, []byte("server is listening")),
+		bytes.Contains(line, []byte("model loaded")),
+		bytes.Contains(line, []byte("all slots are idle")):
+		next = LoadProgress{Stage: LoadStageReady, Percent: 100}
+	case bytes.Contains(line, []byte("warming up")):
+		next = LoadProgress{Stage: LoadStageWarmup, Percent: -1}
+	case bytes.HasPrefix(line, []byte("llama_context:")),
+		bytes.HasPrefix(line, []byte("llama_kv_cache")),
+		bytes.HasPrefix(line, []byte("llama_init_from_model:")):
+		if next.Stage != LoadStageContext {
+			next = LoadProgress{Stage: LoadStageContext, Percent: -1}
+		}
+	case bytes.HasPrefix(line, []byte("load_tensors:")),
+		bytes.Contains(line, []byte("loading model tensors")):
+		if next.Stage != LoadStageTensors {
+			next = LoadProgress{Stage: LoadStageTensors, Percent: 0}
+			lp.dots = 0
+		}
+	case bytes.HasPrefix(line, []byte("llama_model_loader:")),
+		bytes.HasPrefix(line, []byte("print_info:")),
+		bytes.Contains(line, []byte("load_model: loading model")):
+		if next.Stage == "" || next.Stage == LoadStageDownloading {
+			next = LoadProgress{Stage: LoadStageLoading, Percent: -1}
+		}
+	case bytes.Contains(bytes.ToLower(line), []byte("download")):
+		next = LoadProgress{Stage: LoadStageDownloading, Percent: parsePercent(line, 0)}
+	case next.Stage == LoadStageDownloading:
+		// progress bar lines do not contain the word "download"
+		next.Percent = parsePercent(line, next.Percent)
+	default:
+	}
+
+	if next == lp.progress {
+		return false
+	}
+	lp.progress = next
+	return true
+}
+
+// parsePercent returns the last percentage found in the line, or def if none.
+func parsePercent(line []byte, def int) int {
+	matches := percentRegex.FindAllSubmatch(line, -1)
+	if len(matches) == 0 {
+		return def
+	}
+	pct, err := strconv.Atoi(string(matches[len(matches)-1][1]))
+	if err != nil || pct > 100 {
+		return def
+	}
+	return pct
+}
@@ -0,0 +1,84 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadProgressParser_Stages(t *testing.T) {
+	var got []LoadProgress
+	lp := newLoadProgressParser(func(p LoadProgress) {
+		got = append(got, p)
+	})
+
+	output := "common_download_file_single_online: downloading from https://huggingface.co/x/y.gguf\n" +
+		"[====>     ]  40%\r[=========>]  95.5%\r[==========] 100%\n" +
+		"llama_model_loader: loaded meta data with 30 key-value pairs\n" +
+		"print_info: file format = GGUF V3 (latest)\n" +
+		"load_tensors: loading model tensors, this can take a while... (mmap = true)\n" +
+		"load_tensors: CPU_Mapped model buffer size =  4685.30 MiB\n" +
+		"..........\n" +
+		"llama_context: constructing llama_context\n" +
+		"llama_kv_cache: size = 512.00 MiB\n" +
+		"common_init_from_params: warming up the model with an empty run\n" +
+		"main: model loaded\n" +
+		"srv  update_slots: all slots are idle\n"
+
+	// split the writes in the middle of lines to check the line buffering
+	for i := 0; i < len(output); i += 7 {
+		_, err := lp.Write([]byte(output[i:min(i+7, len(output))]))
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, []LoadProgress{
+		{Stage: LoadStageDownloading, Percent: 0},
+		{Stage: LoadStageDownloading, Percent: 40},
+		{Stage: LoadStageDownloading, Percent: 95},
+		{Stage: LoadStageDownloading, Percent: 100},
+		{Stage: LoadStageLoading, Percent: -1},
+		{Stage: LoadStageTensors, Percent: 0},
+		{Stage: LoadStageTensors, Percent: 1},
+		{Stage: LoadStageTensors, Percent: 2},
+		{Stage: LoadStageTensors, Percent: 3},
+		{Stage: LoadStageTensors, Percent: 4},
+		{Stage: LoadStageTensors, Percent: 5},
+		{Stage: LoadStageTensors, Percent: 6},
+		{Stage: LoadStageTensors, Percent: 7},
+		{Stage: LoadStageTensors, Percent: 8},
+		{Stage: LoadStageTensors, Percent: 9},
+		{Stage: LoadStageTensors, Percent: 10},
+		{Stage: LoadStageContext, Percent: -1},
+		{Stage: LoadStageWarmup, Percent: -1},
+		{Stage: LoadStageReady, Percent: 100},
+	}, got)
+	assert.Equal(t, LoadProgress{Stage: LoadStageReady, Percent: 100}, lp.Progress())
+}
+
+func TestLoadProgressParser_Reset(t *testing.T) {
+	lp := newLoadProgressParser(nil)
+	assert.Equal(t, LoadProgress{}, lp.Progress())
+	assert.Empty(t, lp.Progress().String())
+
+	lp.Write([]byte("main: model loaded\n"))
+	assert.Equal(t, LoadStageReady, lp.Progress().Stage)
+
+	// output after ready is ignored until the next startup
+	lp.Write([]byte("llama_context: constructing llama_context\n"))
+	assert.Equal(t, LoadStageReady, lp.Progress().Stage)
+
+	lp.Reset()
+	assert.Equal(t, LoadProgress{}, lp.Progress())
+	lp.Write([]byte("load_tensors: loading model tensors\n....."))
+	assert.Equal(t, LoadProgress{Stage: LoadStageTensors, Percent: 5}, lp.Progress())
+	assert.Equal(t, "Loading tensors: 5%", lp.Progress().String())
+}
+
+func TestLoadProgress_String(t *testing.T) {
+	assert.Equal(t, "Downloading model: 42%", LoadProgress{Stage: LoadStageDownloading, Percent: 42}.String())
+	assert.Equal(t, "Warming up...", LoadProgress{Stage: LoadStageWarmup, Percent: -1}.String())
+}
@@ -0,0 +1,226 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/lynxai-team/goinfer/proxy/config"
+)
+
+// maxLogLine bounds a raw output line without newline (e.g. progress dots).
+const maxLogLine = 64 * 1024
+
+// logRecord is a line of the json log format,
+// time, level and msg are the keys of the slog JSON handler.
+type logRecord struct {
+	Time      time.Time `json:"time"`
+	Level     string    `json:"level"`
+	Msg       string    `json:"msg"`
+	Logger    string    `json:"logger,omitempty"` // prefix of the LogMonitor
+	Model     string    `json:"model,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// encode returns the JSON line, the HTML characters are not escaped to keep the messages readable.
+func (rec *logRecord) encode() []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(rec); err != nil {
+		return fmt.Appendf(nil, `{"level":"ERROR","msg":%q}`+"\n", err.Error())
+	}
+	return buf.Bytes()
+}
+
+// text returns the line of the text log format.
+func (rec *logRecord) text(timeFormat string) []byte {
+	var b []byte
+	if timeFormat != "" {
+		b = append(b, rec.Time.Format(timeFormat)...)
+		b = append(b, ' ')
+	}
+	if rec.Logger != "" {
+		b = fmt.Appendf(b, "[%s] ", rec.Logger)
+	}
+	b = fmt.Appendf(b, "[%s] ", rec.Level)
+	if rec.RequestID != "" {
+		b = append(b, requestIDTag(rec.RequestID)...)
+		b = append(b, ' ')
+	}
+	if rec.Model != "" {
+		b = fmt.Appendf(b, "<%s> ", rec.Model)
+	}
+	b = append(b, rec.Msg...)
+	return append(b, '\n')
+}
+
+// formatRecord is formatMessage in the json format.
+// The "<model> " prefix of the proxy messages becomes the model field.
+func (w *LogMonitor) formatRecord(level, requestID, msg string) []byte {
+	rec := logRecord{Time: time.Now(), Level: level, Logger: w.prefix, RequestID: requestID}
+	rec.Model, rec.Msg = splitModelTag(msg)
+	return rec.encode()
+}
+
+// splitModelTag extracts the model of the messages starting with "<model> ".
+func splitModelTag(msg string) (model, rest string) {
+	if !strings.HasPrefix(msg, "<") {
+		return "", msg
+	}
+	end := strings.Index(msg, "> ")
+	if end < 2 || strings.ContainsAny(msg[1:end], " <") {
+		return "", msg
+	}
+	return msg[1:end], msg[end+2:]
+}
+
+// LineWriter returns the writer of the raw output of the model command.
+// In json format, each output line becomes a record of the model.
+func (w *LogMonitor) LineWriter(model string) io.Writer {
+	if w.LogFormat() != config.LogFormatJSON {
+		return w
+	}
+	return &jsonLineWriter{lm: w, model: model}
+}
+
+// jsonLineWriter converts the raw output lines into JSON records,
+// exec.Cmd serializes the writes when Stdout and Stderr are the same writer.
+type jsonLineWriter struct {
+	lm    *LogMonitor
+	model string
+	line  []byte
+}
+
+func (jw *jsonLineWriter) Write(p []byte) (int, error) {
+	jw.line = append(jw.line, p...)
+	start := 0
+	for {
+		i := bytes.IndexByte(jw.line[start:], '\n')
+		if i < 0 {
+			break
+		}
+		jw.writeLine(jw.line[start : start+i])
+		start += i + 1
+	}
+	jw.line = append(jw.line[:0], jw.line[start:]...)
+	if len(jw.line) > maxLogLine {
+		jw.writeLine(jw.line)
+		jw.line = jw.line[:0]
+	}
+	return len(p), nil
+}
+
+func (jw *jsonLineWriter) writeLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	rec := logRecord{Time: time.Now(), Level: LevelInfo.String(), Model: jw.model, Msg: string(line)}
+	jw.lm.Write(rec.encode())
+}
+
+// logConverter converts the log lines to the requested format, for /logs and /logs/stream.
+// The lines already in that format are kept as is.
+type logConverter struct {
+	format     string // config.LogFormatText or config.LogFormatJSON
+	timeFormat string // of the text lines
+	pending    []byte // partial line of the previous chunk
+}
+
+// convert returns the complete lines of data in the format, a partial line waits for the next chunk.
+func (lc *logConverter) convert(data []byte) []byte {
+	lc.pending = append(lc.pending, data...)
+	var result []byte
+	start := 0
+	for {
+		i := bytes.IndexByte(lc.pending[start:], '\n')
+		if i < 0 {
+			break
+		}
+		result = append(result, lc.convertLine(lc.pending[start:start+i+1])...)
+		start += i + 1
+	}
+	lc.pending = append(lc.pending[:0], lc.pending[start:]...)
+	if len(lc.pending) > maxLogLine {
+		result = append(result, lc.convertLine(append(lc.pending, '\n'))...)
+		lc.pending = lc.pending[:0]
+	}
+	return result
+}
+
+func (lc *logConverter) convertLine(line []byte) []byte {
+	isJSON := bytes.HasPrefix(line, []byte("{"))
+	if lc.format == config.LogFormatJSON {
+		if isJSON {
+			return line
+		}
+		rec := parseTextLogLine(string(bytes.TrimRight(line, "\r\n")), lc.timeFormat)
+		return rec.encode()
+	}
+
+	if !isJSON {
+		return line
+	}
+	var rec logRecord
+	if err := json.Unmarshal(line, &rec); err != nil || rec.Level == "" {
+		return line
+	}
+	return rec.text(lc.timeFormat)
+}
+
+// parseTextLogLine is the best effort reverse of formatMessage,
+// the raw output lines (without level) are INFO records.
+func parseTextLogLine(line, timeFormat string) logRecord {
+	rec := logRecord{Time: time.Now(), Level: LevelInfo.String(), Msg: line}
+
+	levelStart, levelEnd := -1, -1
+	for _, level := range []LogLevel{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		tag := "[" + level.String() + "] "
+		if i := strings.Index(line, tag); i >= 0 && (levelStart < 0 || i < levelStart) {
+			levelStart, levelEnd = i, i+len(tag)
+			rec.Level = level.String()
+		}
+	}
+	if levelStart < 0 {
+		return rec
+	}
+
+	head := line[:levelStart]
+	if strings.HasSuffix(head, "] ") {
+		if i := strings.LastIndex(head, "["); i >= 0 {
+			rec.Logger = head[i+1 : len(head)-2]
+			head = head[:i]
+		}
+	}
+	if head = strings.TrimSpace(head); head != "" && timeFormat != "" {
+		if t, err := time.ParseInLocation(timeFormat, head, time.Local); err == nil {
+			rec.Time = t
+		}
+	}
+
+	msg := line[levelEnd:]
+	if strings.HasPrefix(msg, "[req=") {
+		if end := strings.Index(msg, "] "); end > 0 {
+			rec.RequestID = msg[len("[req="):end]
+			msg = msg[end+2:]
+		}
+	}
+	rec.Model, rec.Msg = splitModelTag(msg)
+	return rec
+}
+
+// requestIDMatch is the substring of the log lines of the request in the format.
+func requestIDMatch(format, requestID string) string {
+	if format == config.LogFormatJSON {
+		return `"request_id":"` + requestID + `"`
+	}
+	return requestIDTag(requestID)
+}
@@ -0,0 +1,149 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeLogRecords(t *testing.T, data []byte) []logRecord {
+	t.Helper()
+	var records []logRecord
+	for line := range bytes.Lines(data) {
+		var rec logRecord
+		require.NoError(t, json.Unmarshal(line, &rec), string(line))
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestLogFormat_JSONRecords(t *testing.T) {
+	lm := NewLogMonitorWriter(io.Discard)
+	lm.SetLogFormat(config.LogFormatJSON)
+	ctx := context.WithValue(t.Context(), proxyCtxKey("requestID"), "abc")
+
+	lm.Infof("<%s> Health check passed on %s", "author/model", "http://localhost/health?a=1&b=<2>")
+	lm.ForRequest(ctx).Warn("quota exceeded")
+	lm.Debug("below the level")
+
+	records := decodeLogRecords(t, lm.GetHistory())
+	require.Len(t, records, 2)
+	assert.Equal(t, "INFO", records[0].Level)
+	assert.Equal(t, "author/model", records[0].Model)
+	assert.Equal(t, "Health check passed on http://localhost/health?a=1&b=<2>", records[0].Msg)
+	assert.WithinDuration(t, time.Now(), records[0].Time, time.Minute)
+	assert.Equal(t, "WARN", records[1].Level)
+	assert.Equal(t, "abc", records[1].RequestID)
+	assert.Empty(t, records[1].Model)
+	assert.Contains(t, string(lm.GetHistory()), `"request_id":"abc"`, "see requestIDMatch")
+	assert.Contains(t, string(lm.GetHistory()), `&b=<2>`, "no HTML escaping")
+}
+
+func TestLogFormat_LineWriter(t *testing.T) {
+	lm := NewLogMonitorWriter(io.Discard)
+	assert.Same(t, lm, lm.LineWriter("model1"), "the text format keeps the raw output")
+
+	lm.SetLogFormat(config.LogFormatJSON)
+	w := lm.LineWriter("model1")
+	w.Write([]byte("main: loading model\r\nllama_model_load: "))
+	w.Write([]byte("done\n\n"))
+	w.Write([]byte("partial"))
+
+	records := decodeLogRecords(t, lm.GetHistory())
+	require.Len(t, records, 2)
+	assert.Equal(t, "model1", records[0].Model)
+	assert.Equal(t, "main: loading model", records[0].Msg)
+	assert.Equal(t, "llama_model_load: done", records[1].Msg)
+	assert.Equal(t, "INFO", records[1].Level)
+}
+
+func TestLogFormat_Converter(t *testing.T) {
+	// text -> json
+	lc := &logConverter{format: config.LogFormatJSON, timeFormat: time.DateTime}
+	out := lc.convert([]byte("2026-09-01 10:00:00 [WARN] [req=abc] <model1> slow\nraw llama-server "))
+	out = append(out, lc.convert([]byte("output\n"))...)
+	records := decodeLogRecords(t, out)
+	require.Len(t, records, 2)
+	assert.True(t, time.Date(2026, 9, 1, 10, 0, 0, 0, time.Local).Equal(records[0].Time))
+	assert.Equal(t, logRecord{Time: records[0].Time, Level: "WARN", Msg: "slow", Model: "model1", RequestID: "abc"}, records[0])
+	assert.Equal(t, "raw llama-server output", records[1].Msg)
+	assert.Equal(t, "INFO", records[1].Level)
+
+	// json -> text
+	lc = &logConverter{format: config.LogFormatText, timeFormat: time.DateTime}
+	out = lc.convert(append(records[0].encode(), "not json\n"...))
+	assert.Equal(t, "2026-09-01 10:00:00 [WARN] [req=abc] <model1> slow\nnot json\n", string(out))
+
+	rec := parseTextLogLine("[proxy] [ERROR] <a> b", "")
+	assert.Equal(t, "proxy", rec.Logger)
+	assert.Equal(t, "ERROR", rec.Level)
+	assert.Equal(t, "a", rec.Model)
+	assert.Equal(t, "b", rec.Msg)
+}
+
+func TestProxyManager_LogFormat(t *testing.T) {
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+		},
+		LogLevel:    "info",
+		LogToStdout: config.LogToStdoutBoth,
+		LogFormat:   config.LogFormatJSON,
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+	proxy.muxLogger.stdout = io.Discard // keep the test output clean
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"model1"}`))
+	req.Header.Set(requestIDHeader, "json-1")
+	w := CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// every line is a JSON object, the upstream lines have the model
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/logs", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	records := decodeLogRecords(t, w.Body.Bytes())
+	var upstream, request bool
+	for _, rec := range records {
+		upstream = upstream || (rec.Model == "model1" && rec.Msg == "POST /v1/chat/completions")
+		request = request || (rec.RequestID == "json-1" && strings.HasPrefix(rec.Msg, "Request "))
+	}
+	assert.True(t, upstream, "upstream marker")
+	assert.True(t, request, "access log")
+
+	// the lines of the request, in the text format
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/logs?format=text&request_id=json-1", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "[INFO] [req=json-1] <model1> POST /v1/chat/completions\n")
+	for line := range strings.Lines(w.Body.String()) {
+		assert.Contains(t, line, "[req=json-1]")
+	}
+
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/logs/stream?format=xml", http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/lynxai-team/goinfer/event"
+	"github.com/lynxai-team/goinfer/proxy/config"
 )
 
 // circularBuffer is a fixed-size circular byte buffer that overwrites
@@ -116,6 +117,12 @@ type LogMonitor struct {
 	// timestamps
 	timeFormat string
 
+	// config.LogFormatText or config.LogFormatJSON
+	format string
+
+	// durable copy of the log, optional
+	file *logFile
+
 	// logging levels
 	level LogLevel
 
@@ -135,6 +142,7 @@ func NewLogMonitorWriter(stdout io.Writer) *LogMonitor {
 		level:      LevelInfo,
 		prefix:     "",
 		timeFormat: "",
+		format:     config.LogFormatText,
 	}
 }
 
@@ -148,6 +156,12 @@ func (w *LogMonitor) Write(p []byte) (n int, err error) {
 		return n, err
 	}
 
+	if w.file != nil {
+		if _, err := w.file.Write(p); err != nil {
+			w.Errorf("Log file: %v", err) // once, see logFile.Write
+		}
+	}
+
 	w.bufferMu.Lock()
 	if w.buffer == nil {
 		w.buffer = newCircularBuffer(LogBufferSize)
@@ -171,6 +185,12 @@ func (w *LogMonitor) GetHistory() []byte {
 	return w.buffer.GetHistory()
 }
 
+// SetFile copies the log to the file, it must be called before the first Write.
+// Clear does not affect the file.
+func (w *LogMonitor) SetFile(file *logFile) {
+	w.file = file
+}
+
 // Clear releases the buffer memory, making it eligible for GC.
 // The buffer will be lazily re-allocated on the next Write.
 func (w *LogMonitor) Clear() {
@@ -207,7 +227,27 @@ func (w *LogMonitor) SetLogTimeFormat(timeFormat string) {
 	w.timeFormat = timeFormat
 }
 
-func (w *LogMonitor) formatMessage(level, msg string) []byte {
+// SetLogFormat sets the format of the log lines, the raw output written with Write is not formatted
+// (see LineWriter).
+func (w *LogMonitor) SetLogFormat(format string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.format = format
+}
+
+func (w *LogMonitor) LogFormat() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.format
+}
+
+func (w *LogMonitor) formatMessage(level, requestID, msg string) []byte {
+	if w.format == config.LogFormatJSON {
+		return w.formatRecord(level, requestID, msg)
+	}
+	if requestID != "" {
+		msg = requestIDTag(requestID) + " " + msg
+	}
 	prefix := ""
 	if w.prefix != "" {
 		prefix = fmt.Sprintf("[%s] ", w.prefix)
@@ -220,10 +260,14 @@ func (w *LogMonitor) formatMessage(level, msg string) []byte {
 }
 
 func (w *LogMonitor) log(level LogLevel, msg string) {
+	w.logRequest(level, "", msg)
+}
+
+func (w *LogMonitor) logRequest(level LogLevel, requestID, msg string) {
 	if level < w.level {
 		return
 	}
-	w.Write(w.formatMessage(level.String(), msg))
+	w.Write(w.formatMessage(level.String(), requestID, msg))
 }
 
 func (w *LogMonitor) Debug(msg string) {
@@ -272,3 +316,51 @@ func (l LogLevel) String() string {
 		return "UNKNOWN"
 	}
 }
+
+// RequestLogger tags the log lines with the X-Request-ID of the request being handled,
+// so they can be searched with /logs?request_id=<id>.
+type RequestLogger struct {
+	*LogMonitor
+	requestID string
+}
+
+// ForRequest returns a logger tagging the lines with the request ID of ctx, if any.
+func (w *LogMonitor) ForRequest(ctx context.Context) RequestLogger {
+	return RequestLogger{LogMonitor: w, requestID: requestIDFromContext(ctx)}
+}
+
+func (l RequestLogger) log(level LogLevel, msg string) {
+	l.LogMonitor.logRequest(level, l.requestID, msg)
+}
+
+func (l RequestLogger) Debug(msg string) {
+	l.log(LevelDebug, msg)
+}
+
+func (l RequestLogger) Info(msg string) {
+	l.log(LevelInfo, msg)
+}
+
+func (l RequestLogger) Warn(msg string) {
+	l.log(LevelWarn, msg)
+}
+
+func (l RequestLogger) Error(msg string) {
+	l.log(LevelError, msg)
+}
+
+func (l RequestLogger) Debugf(format string, args ...any) {
+	l.log(LevelDebug, fmt.Sprintf(format, args...))
+}
+
+func (l RequestLogger) Infof(format string, args ...any) {
+	l.log(LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (l RequestLogger) Warnf(format string, args ...any) {
+	l.log(LevelWarn, fmt.Sprintf(format, args...))
+}
+
+func (l RequestLogger) Errorf(format string, args ...any) {
+	l.log(LevelError, fmt.Sprintf(format, args...))
+}
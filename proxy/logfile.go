@@ -0,0 +1,343 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lynxai-team/goinfer/proxy/config"
+)
+
+const (
+	logCurrentFile   = "current.log"
+	logSegmentSuffix = ".log.gz"
+	logFailedSuffix  = "-failed" // segment ending with a failed start of the model
+	logRotateTime    = "20060102T150405.000"
+)
+
+// logFile writes a log in a directory: current.log is rotated into
+// gzip compressed segments when its size or age exceeds the limits.
+type logFile struct {
+	file     *os.File
+	now      func() time.Time
+	opened   time.Time // creation of the current segment
+	dir      string
+	size     int64
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+	failing  bool // an error is reported, until the next successful rotation
+	mu       sync.Mutex
+}
+
+func newLogFile(dir string, cfg config.LogFilesConfig) (*logFile, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the log directory: %w", err)
+	}
+
+	lf := &logFile{
+		now:      time.Now,
+		dir:      dir,
+		maxSize:  int64(cfg.MaxSizeMB) << 20,
+		maxAge:   time.Duration(cfg.MaxAgeHours) * time.Hour,
+		maxFiles: cfg.MaxFiles,
+	}
+	err = lf.open()
+	if err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+// logFileDir returns the directory of a log: "proxy" or a model ID
+// (the characters other than letters, digits, '.', '-' and '_' are replaced).
+func logFileDir(root, name string) string {
+	if name == "proxy" {
+		return filepath.Join(root, "proxy")
+	}
+	safe := []byte(name)
+	for i, c := range safe {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			safe[i] = '_'
+		}
+	}
+	if name == "." || name == ".." {
+		safe = []byte("_")
+	}
+	return filepath.Join(root, "models", string(safe))
+}
+
+func (lf *logFile) open() error {
+	f, err := os.OpenFile(filepath.Join(lf.dir, logCurrentFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("cannot open the log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	lf.file = f
+	lf.size = info.Size()
+	lf.opened = lf.now()
+	if lf.size > 0 {
+		lf.opened = info.ModTime() // continued after a restart
+	}
+	return nil
+}
+
+// Write appends p to the current segment, rotated first when full or too old.
+// An error is returned once, until the next successful rotation: the error of a write
+// would otherwise be logged in the same failing file again.
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	var rotateErr error
+	if lf.file != nil && lf.size > 0 && (lf.size+int64(len(p)) > lf.maxSize || (lf.maxAge > 0 && lf.now().Sub(lf.opened) > lf.maxAge)) {
+		rotateErr = lf.rotate("") // on failure, current.log goes on
+	}
+	if lf.file == nil {
+		return 0, lf.report(errors.Join(rotateErr, errors.New("log file is closed")))
+	}
+
+	n, err := lf.file.Write(p)
+	lf.size += int64(n)
+	return n, lf.report(errors.Join(rotateErr, err))
+}
+
+// report returns err unless an error was already reported.
+func (lf *logFile) report(err error) error {
+	if err == nil || lf.failing {
+		return nil
+	}
+	lf.failing = true
+	return err
+}
+
+// markFailed rotates the current segment, named with the failed suffix,
+// so the output of a failed start is kept apart from the next start.
+func (lf *logFile) markFailed() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.file == nil {
+		return errors.New("log file is closed")
+	}
+	return lf.rotate(logFailedSuffix)
+}
+
+// rotate compresses the current segment, removes the oldest segments and opens a new one.
+// On failure (e.g. disk full), current.log is reopened and the next rotation is tried
+// after another maxSize or maxAge.
+func (lf *logFile) rotate(suffix string) error {
+	err := lf.file.Close()
+	lf.file = nil
+	if err == nil {
+		err = lf.compress(suffix)
+	}
+	if openErr := lf.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	if err != nil {
+		lf.size = 0
+		lf.opened = lf.now()
+		return err
+	}
+	lf.failing = false
+	return nil
+}
+
+// compress moves current.log into a new segment and removes the oldest segments, current.log is closed.
+func (lf *logFile) compress(suffix string) error {
+	current := filepath.Join(lf.dir, logCurrentFile)
+	stamp := lf.now().Format(logRotateTime)
+	for i := 1; fileExists(filepath.Join(lf.dir, stamp+logSegmentSuffix)) ||
+		fileExists(filepath.Join(lf.dir, stamp+logFailedSuffix+logSegmentSuffix)); i++ {
+		stamp = lf.now().Format(logRotateTime) + "." + strconv.Itoa(i) // same millisecond
+	}
+	segment := filepath.Join(lf.dir, stamp+suffix+logSegmentSuffix)
+
+	err := gzipFile(current, segment)
+	if err != nil {
+		return fmt.Errorf("cannot rotate the log file: %w", err)
+	}
+	err = os.Remove(current)
+	if err != nil {
+		os.Remove(segment) // current.log goes on, not duplicated in the next segment
+		return fmt.Errorf("cannot rotate the log file: %w", err)
+	}
+
+	if lf.maxFiles > 0 {
+		segments, err := lf.segments()
+		if err != nil {
+			return err
+		}
+		for _, s := range segments[:max(len(segments)-lf.maxFiles, 0)] { // no current segment until open
+			os.Remove(filepath.Join(lf.dir, s.Name))
+		}
+	}
+	return nil
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// logSegment describes a segment of a logFile for /api/logfiles.
+type logSegment struct {
+	Time    time.Time `json:"time"` // rotation time, or last write of the current segment
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"` // compressed size of the rotated segments
+	Failed  bool      `json:"failed,omitempty"`
+	Current bool      `json:"current,omitempty"`
+}
+
+// segments returns the rotated segments, oldest first, followed by the current one.
+func (lf *logFile) segments() ([]logSegment, error) {
+	entries, err := os.ReadDir(lf.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []logSegment
+	var seqs []int // same millisecond counters
+	var current *logSegment
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		if name == logCurrentFile {
+			current = &logSegment{Time: info.ModTime(), Name: name, Size: info.Size(), Current: true}
+			continue
+		}
+		if !strings.HasSuffix(name, logSegmentSuffix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(name, logSegmentSuffix)
+		failed := strings.HasSuffix(stamp, logFailedSuffix)
+		stamp = strings.TrimSuffix(stamp, logFailedSuffix)
+		seq := 0
+		if i := strings.LastIndexByte(stamp, '.'); i > len(logRotateTime)-4 {
+			seq, _ = strconv.Atoi(stamp[i+1:])
+			stamp = stamp[:i]
+		}
+		rotatedAt, err := time.ParseInLocation(logRotateTime, stamp, time.Local)
+		if err != nil {
+			continue // not one of our files
+		}
+		segments = append(segments, logSegment{Time: rotatedAt, Name: name, Size: info.Size(), Failed: failed})
+		seqs = append(seqs, seq)
+	}
+
+	order := make([]int, len(segments))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		if c := segments[a].Time.Compare(segments[b].Time); c != 0 {
+			return c
+		}
+		return seqs[a] - seqs[b]
+	})
+	sorted := make([]logSegment, 0, len(segments)+1)
+	for _, i := range order {
+		sorted = append(sorted, segments[i])
+	}
+	segments = sorted
+	if current != nil {
+		segments = append(segments, *current)
+	}
+	return segments, nil
+}
+
+// lastFailed returns the most recent segment of a failed start.
+func (lf *logFile) lastFailed() (logSegment, bool) {
+	segments, err := lf.segments()
+	if err != nil {
+		return logSegment{}, false
+	}
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i].Failed {
+			return segments[i], true
+		}
+	}
+	return logSegment{}, false
+}
+
+// openSegment returns the uncompressed content of a segment listed by segments().
+func (lf *logFile) openSegment(name string) (io.ReadCloser, error) {
+	segments, err := lf.segments()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(segments, func(s logSegment) bool { return s.Name == name }) {
+		return nil, os.ErrNotExist // also prevents path traversal
+	}
+
+	f, err := os.Open(filepath.Join(lf.dir, name))
+	if err != nil || name == logCurrentFile {
+		return f, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, f}, nil
+}
+
+func (lf *logFile) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.file == nil {
+		return nil
+	}
+	err := lf.file.Close()
+	lf.file = nil
+	lf.failing = true // the writes after Close are not errors to report
+	return err
+}
@@ -0,0 +1,178 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readSegment(t *testing.T, lf *logFile, name string) string {
+	t.Helper()
+	rc, err := lf.openSegment(name)
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestLogFile_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	lf, err := newLogFile(dir, config.LogFilesConfig{MaxSizeMB: 1, MaxAgeHours: 1, MaxFiles: 2})
+	require.NoError(t, err)
+	defer lf.Close()
+	lf.maxSize = 20
+
+	now := time.Date(2026, 9, 1, 12, 0, 0, 0, time.Local)
+	lf.now = func() time.Time { return now }
+	lf.opened = now
+
+	// size rotation
+	lf.Write([]byte("0123456789\n"))
+	lf.Write([]byte("abcdefghij\n"))
+	segments, err := lf.segments()
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+	assert.Equal(t, "20260901T120000.000.log.gz", segments[0].Name)
+	assert.True(t, segments[1].Current)
+	assert.Equal(t, "0123456789\n", readSegment(t, lf, segments[0].Name), "compressed segment")
+	assert.Equal(t, "abcdefghij\n", readSegment(t, lf, logCurrentFile))
+
+	// age rotation
+	now = now.Add(2 * time.Hour)
+	lf.Write([]byte("later\n"))
+	assert.Equal(t, "later\n", readSegment(t, lf, logCurrentFile))
+
+	// failed start, in the same millisecond
+	lf.Write([]byte("error: oom\n"))
+	require.NoError(t, lf.markFailed())
+	segments, err = lf.segments()
+	require.NoError(t, err)
+	require.Len(t, segments, 3, "maxFiles keeps 2 rotated segments")
+	assert.Equal(t, "20260901T140000.000.log.gz", segments[0].Name)
+	assert.Equal(t, "20260901T140000.000.1-failed.log.gz", segments[1].Name)
+	assert.True(t, segments[1].Failed)
+
+	failed, found := lf.lastFailed()
+	require.True(t, found)
+	assert.Equal(t, "later\nerror: oom\n", readSegment(t, lf, failed.Name))
+
+	_, err = lf.openSegment("../" + filepath.Base(dir) + "/" + logCurrentFile)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLogFile_RotationFailure(t *testing.T) {
+	dir := t.TempDir()
+	lf, err := newLogFile(dir, config.LogFilesConfig{MaxSizeMB: 1})
+	require.NoError(t, err)
+	defer lf.Close()
+	lf.maxSize = 20
+
+	now := time.Date(2026, 9, 1, 12, 0, 0, 0, time.Local)
+	lf.now = func() time.Time { return now }
+	var stdout strings.Builder
+	logger := NewLogMonitorWriter(&stdout)
+	logger.SetFile(lf)
+
+	// the segment cannot be created: the log goes on in current.log, the error is logged once
+	segment := filepath.Join(dir, "20260901T120000.000.log.gz")
+	require.NoError(t, os.Symlink(filepath.Join(dir, "missing"), segment))
+	logger.Write([]byte("0123456789\n"))
+	logger.Write([]byte("abcdefghij\n"))
+	logger.Write([]byte("klmnopqrst\n"))
+	assert.Equal(t, 1, strings.Count(stdout.String(), "[ERROR] Log file: cannot rotate the log file"), stdout.String())
+	current := readSegment(t, lf, logCurrentFile)
+	assert.True(t, strings.HasPrefix(current, "0123456789\nabcdefghij\n[ERROR] Log file: cannot rotate the log file"), current)
+	assert.True(t, strings.HasSuffix(current, "klmnopqrst\n"), current)
+
+	// rotated again once the segment can be created
+	require.NoError(t, os.Remove(segment))
+	logger.Write([]byte("uvwxyz0123\n"))
+	assert.Equal(t, current, readSegment(t, lf, "20260901T120000.000.log.gz"))
+	assert.Equal(t, "uvwxyz0123\n", readSegment(t, lf, logCurrentFile))
+	assert.False(t, lf.failing)
+}
+
+func TestLogFile_Dir(t *testing.T) {
+	assert.Equal(t, filepath.Join("logs", "proxy"), logFileDir("logs", "proxy"))
+	assert.Equal(t, filepath.Join("logs", "models", "author_model-7B.Q4"), logFileDir("logs", "author/model-7B.Q4"))
+	assert.Equal(t, filepath.Join("logs", "models", "_"), logFileDir("logs", ".."))
+}
+
+func TestProxyManager_LogFiles(t *testing.T) {
+	port := getTestPort()
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+			"broken": {
+				Cmd:   simpleResponderPath + " --port " + strconv.Itoa(port) + " --no-such-flag",
+				Proxy: "http://127.0.0.1:" + strconv.Itoa(port),
+			},
+		},
+		LogLevel: "error",
+		LogFiles: config.LogFilesConfig{Dir: t.TempDir(), MaxSizeMB: 1},
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	// the output of the failed start is kept
+	w := CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"broken"}`)))
+	require.Equal(t, http.StatusBadGateway, w.Code)
+
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/logfiles/broken?segment=last-failed", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "flag provided but not defined: -no-such-flag")
+	assert.Contains(t, w.Body.String(), "<broken> start failed")
+
+	// the output survives the stop of the model
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"model1"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	proxy.StopProcesses(StopWaitForInflightRequest)
+	assert.Empty(t, proxy.processGroups[config.DEFAULT_GROUP_ID].processes["model1"].Logger().GetHistory())
+
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/logfiles/model1?segment=current.log", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<model1> POST /v1/chat/completions")
+
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/logfiles", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	var all map[string][]logSegment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &all))
+	assert.Contains(t, all, "proxy")
+	assert.Contains(t, all, "model1")
+	require.Contains(t, all, "broken")
+	require.Len(t, all["broken"], 2)
+	assert.True(t, all["broken"][0].Failed)
+
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/logfiles/model1?segment=last-failed", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/logfiles/unknown", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
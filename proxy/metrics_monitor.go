@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -18,6 +19,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/lynxai-team/goinfer/event"
+	"github.com/lynxai-team/goinfer/proxy/config"
 	"github.com/tidwall/gjson"
 )
 
@@ -25,6 +27,9 @@ import (
 type TokenMetrics struct {
 	Timestamp       time.Time `json:"timestamp"`
 	Model           string    `json:"model"`
+	APIKey          string    `json:"api_key,omitempty"`    // identifier of the API key, see apiKeyID()
+	Peer            string    `json:"peer,omitempty"`       // remote provider serving the model
+	RequestID       string    `json:"request_id,omitempty"` // X-Request-ID, also in the log lines
 	ID              int       `json:"id"`
 	CachedTokens    int       `json:"cache_tokens"`
 	InputTokens     int       `json:"input_tokens"`
@@ -32,6 +37,73 @@ type TokenMetrics struct {
 	PromptPerSecond float64   `json:"prompt_per_second"`
 	TokensPerSecond float64   `json:"tokens_per_second"`
 	DurationMs      int       `json:"duration_ms"`
+	QueueWaitMs     int       `json:"queue_wait_ms"`      // waiting for the process group (other model requests)
+	SwapWaitMs      int       `json:"swap_wait_ms"`       // waiting for the model to start
+	TTFTMs          int       `json:"ttft_ms"`            // time to the first byte of the upstream response, -1 if none
+	CostUSD         float64   `json:"cost_usd,omitempty"` // usage.cost returned by the provider, or the peer pricing
+}
+
+// requestTimings collects the phases of a proxied request,
+// shared with Process.ProxyRequest through the request context.
+type requestTimings struct {
+	begin     time.Time // wrapHandler
+	queued    time.Time // Process.ProxyRequest, once the process group lets the request in
+	ready     time.Time // the process is ready, the request is sent upstream
+	firstByte time.Time // first byte of the upstream response
+	mu        sync.Mutex
+}
+
+func requestTimingsFrom(r *http.Request) *requestTimings {
+	rt, _ := r.Context().Value(proxyCtxKey("timings")).(*requestTimings)
+	return rt
+}
+
+// markQueued is called once the process group lets the request in,
+// rt is nil when the metrics are not recorded.
+func (rt *requestTimings) markQueued() {
+	if rt == nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.queued = time.Now()
+}
+
+// markReady is called when the request is sent upstream.
+func (rt *requestTimings) markReady() {
+	if rt == nil {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.ready = time.Now()
+}
+
+// wroteFirstByte is called for each write to the client,
+// only the writes after the swap (i.e. not the loading messages) are upstream bytes.
+func (rt *requestTimings) wroteFirstByte() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.firstByte.IsZero() && !rt.ready.IsZero() {
+		rt.firstByte = time.Now()
+	}
+}
+
+func (rt *requestTimings) apply(tm *TokenMetrics) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	ms := func(from, to time.Time) int {
+		if from.IsZero() || to.IsZero() {
+			return 0
+		}
+		return int(to.Sub(from).Milliseconds())
+	}
+	tm.QueueWaitMs = ms(rt.begin, rt.queued)
+	tm.SwapWaitMs = ms(rt.queued, rt.ready)
+	tm.TTFTMs = -1
+	if !rt.firstByte.IsZero() {
+		tm.TTFTMs = ms(rt.begin, rt.firstByte)
+	}
 }
 
 // TokenMetricsEvent represents a token metrics event.
@@ -46,21 +118,46 @@ func (e TokenMetricsEvent) Type() uint32 {
 // metricsMonitor parses llama-server output for token statistics.
 type metricsMonitor struct {
 	logger     *LogMonitor
+	prometheus *prometheusMetrics // optional
+	store      *metricsStore      // optional
+	quotas     *quotaManager      // optional
+	peers      config.PeerDictionaryConfig
 	metrics    []TokenMetrics
 	maxMetrics int
-	nextID     int
-	mu         sync.RWMutex
+	// above this size the non streaming responses are not parsed
+	maxBodySize int
+	nextID      int
+	mu          sync.RWMutex
 }
 
 func newMetricsMonitor(logger *LogMonitor, maxMetrics int) *metricsMonitor {
 	mp := &metricsMonitor{
-		logger:     logger,
-		maxMetrics: maxMetrics,
+		logger:      logger,
+		maxMetrics:  maxMetrics,
+		maxBodySize: metricsMaxBodySize,
 	}
 
 	return mp
 }
 
+// setStore persists the next metrics in the store,
+// and restores the in-memory history from the previous runs.
+func (mp *metricsMonitor) setStore(store *metricsStore) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	mp.store = store
+	history, err := store.tail(mp.maxMetrics)
+	if err != nil {
+		mp.logger.Warnf("metrics: cannot read the history: %v", err)
+		return
+	}
+	mp.metrics = history
+	if len(history) > 0 {
+		mp.nextID = history[len(history)-1].ID + 1
+	}
+}
+
 // addMetrics adds a new metric to the collection and publishes an event.
 func (mp *metricsMonitor) addMetrics(metric TokenMetrics) {
 	mp.mu.Lock()
@@ -73,6 +170,17 @@ func (mp *metricsMonitor) addMetrics(metric TokenMetrics) {
 		mp.metrics = mp.metrics[len(mp.metrics)-mp.maxMetrics:]
 	}
 	event.Emit(TokenMetricsEvent{Metrics: metric})
+	if mp.prometheus != nil {
+		mp.prometheus.observeTokenMetrics(metric)
+	}
+	if mp.quotas != nil {
+		mp.quotas.addTokens(metric)
+	}
+	if mp.store != nil {
+		if err := mp.store.append(metric); err != nil {
+			mp.logger.Warnf("metrics: cannot persist: %v", err)
+		}
+	}
 }
 
 // getMetrics returns a copy of the current metrics.
@@ -101,7 +209,28 @@ func (mp *metricsMonitor) wrapHandler(
 	request *http.Request,
 	next func(modelID string, w http.ResponseWriter, r *http.Request) error,
 ) error {
+	rt := &requestTimings{begin: time.Now()}
+	request = request.WithContext(context.WithValue(request.Context(), proxyCtxKey("timings"), rt))
 	recorder := newBodyCopier(writer)
+	recorder.timings = rt
+	recorder.maxBodySize = mp.maxBodySize
+
+	// record completes the metrics with the request attributes
+	keyID, _ := request.Context().Value(proxyCtxKey("apiKey")).(string)
+	peerID, _ := request.Context().Value(proxyCtxKey("peer")).(string)
+	requestID := requestIDFromContext(request.Context())
+	log := mp.logger.ForRequest(request.Context())
+	record := func(tm TokenMetrics) {
+		tm.APIKey = keyID
+		tm.RequestID = requestID
+		tm.Peer = peerID
+		if peer, found := mp.peers[peerID]; found && tm.CostUSD == 0 {
+			tm.CostUSD = peer.Cost(tm.Model, tm.InputTokens, tm.OutputTokens)
+		}
+		rt.apply(&tm)
+		spanFromContext(request.Context()).setTokenMetrics(tm)
+		mp.addMetrics(tm)
+	}
 
 	// Filter Accept-Encoding to only include encodings we can decompress for metrics
 	if ae := request.Header.Get("Accept-Encoding"); ae != "" {
@@ -117,7 +246,7 @@ func (mp *metricsMonitor) wrapHandler(
 	// and we can only log errors but not send them to clients
 
 	if recorder.Status() != http.StatusOK {
-		mp.logger.Warnf("metrics skipped, HTTP status=%d, path=%s", recorder.Status(), request.URL.Path)
+		log.Warnf("metrics skipped, HTTP status=%d, path=%s", recorder.Status(), request.URL.Path)
 		return nil
 	}
 
@@ -128,27 +257,45 @@ func (mp *metricsMonitor) wrapHandler(
 		DurationMs: int(time.Since(recorder.StartTime()).Milliseconds()),
 	}
 
-	body := recorder.body.Bytes()
-	if len(body) == 0 {
-		mp.logger.Warn("metrics: empty body, recording minimal metrics")
-		mp.addMetrics(tm)
+	if recorder.Size() <= 0 {
+		log.Warn("metrics: empty body, recording minimal metrics")
+		record(tm)
+		return nil
+	}
+
+	// SSE events parsed while streaming
+	if recorder.sse != nil {
+		if parsed, err := recorder.sse.metrics(modelID, recorder.StartTime()); err != nil {
+			log.Warnf("error processing streaming response: %v, path=%s, recording minimal metrics", err, request.URL.Path)
+		} else {
+			tm = parsed
+		}
+		record(tm)
+		return nil
+	}
+
+	if recorder.truncated {
+		log.Warnf("metrics: response larger than %d bytes, path=%s, recording minimal metrics", recorder.maxBodySize, request.URL.Path)
+		record(tm)
 		return nil
 	}
 
 	// Decompress if needed
+	body := recorder.body.Bytes()
 	if encoding := recorder.Header().Get("Content-Encoding"); encoding != "" {
 		var err error
 		body, err = decompressBody(body, encoding)
 		if err != nil {
-			mp.logger.Warnf("metrics: decompression failed: %v, path=%s, recording minimal metrics", err, request.URL.Path)
-			mp.addMetrics(tm)
+			log.Warnf("metrics: decompression failed: %v, path=%s, recording minimal metrics", err, request.URL.Path)
+			record(tm)
 			return nil
 		}
 	}
 
 	if strings.Contains(recorder.Header().Get("Content-Type"), "text/event-stream") {
+		// compressed stream
 		if parsed, err := processStreamingResponse(modelID, recorder.StartTime(), body); err != nil {
-			mp.logger.Warnf("error processing streaming response: %v, path=%s, recording minimal metrics", err, request.URL.Path)
+			log.Warnf("error processing streaming response: %v, path=%s, recording minimal metrics", err, request.URL.Path)
 		} else {
 			tm = parsed
 		}
@@ -160,70 +307,100 @@ func (mp *metricsMonitor) wrapHandler(
 
 			if usage.Exists() || timings.Exists() {
 				if parsedMetrics, err := parseMetrics(modelID, recorder.StartTime(), usage, timings); err != nil {
-					mp.logger.Warnf("error parsing metrics: %v, path=%s, recording minimal metrics", err, request.URL.Path)
+					log.Warnf("error parsing metrics: %v, path=%s, recording minimal metrics", err, request.URL.Path)
 				} else {
 					tm = parsedMetrics
 				}
 			}
 		} else {
-			mp.logger.Warnf("metrics: invalid JSON in response body path=%s, recording minimal metrics", request.URL.Path)
+			log.Warnf("metrics: invalid JSON in response body path=%s, recording minimal metrics", request.URL.Path)
 		}
 	}
 
-	mp.addMetrics(tm)
+	record(tm)
 	return nil
 }
 
 func processStreamingResponse(modelID string, start time.Time, body []byte) (TokenMetrics, error) {
-	// Iterate **backwards** through the body looking for the data payload with
-	// usage data. This avoids allocating a slice of all lines via bytes.Split.
-
-	// Start from the end of the body and scan backwards for newlines
-	pos := len(body)
-	for pos > 0 {
-		// Find the previous newline (or start of body)
-		lineStart := bytes.LastIndexByte(body[:pos], '\n')
-		if lineStart == -1 {
-			lineStart = 0
-		} else {
-			lineStart++ // Move past the newline
-		}
+	sp := newSSEMetricsParser(len(body))
+	sp.Write(body)
+	return sp.metrics(modelID, start)
+}
 
-		line := bytes.TrimSpace(body[lineStart:pos])
-		pos = lineStart - 1 // Move position before the newline for next iteration
+// sseMetricsParser inspects the SSE events passing through,
+// and only keeps the last data payload containing usage or timings.
+type sseMetricsParser struct {
+	line    []byte // current line
+	skip    bool   // the current line exceeds maxLine
+	maxLine int
+	last    []byte // last payload with usage or timings
+}
 
-		if len(line) == 0 {
-			continue
-		}
+func newSSEMetricsParser(maxLine int) *sseMetricsParser {
+	return &sseMetricsParser{maxLine: maxLine}
+}
 
-		// SSE payload always follows "data:"
-		prefix := []byte("data:")
-		if !bytes.HasPrefix(line, prefix) {
-			continue
+// Write never fails: parsing issues must not break the response.
+func (sp *sseMetricsParser) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		chunk := p
+		if i >= 0 {
+			chunk = p[:i]
 		}
-		data := bytes.TrimSpace(line[len(prefix):])
 
-		if len(data) == 0 {
-			continue
+		if !sp.skip {
+			if len(sp.line)+len(chunk) > sp.maxLine {
+				sp.skip = true
+				sp.line = sp.line[:0]
+			} else {
+				sp.line = append(sp.line, chunk...)
+			}
 		}
 
-		if bytes.Equal(data, []byte("[DONE]")) {
-			// [DONE] line itself contains nothing of interest.
-			continue
+		if i < 0 {
+			break
+		}
+		if !sp.skip {
+			sp.parseLine(sp.line)
 		}
+		sp.line = sp.line[:0]
+		sp.skip = false
+		p = p[i+1:]
+	}
+	return n, nil
+}
 
-		if gjson.ValidBytes(data) {
-			parsed := gjson.ParseBytes(data)
-			usage := parsed.Get("usage")
-			timings := parsed.Get("timings")
+func (sp *sseMetricsParser) parseLine(line []byte) {
+	// SSE payload always follows "data:"
+	data, found := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !found {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) || !gjson.ValidBytes(data) {
+		return
+	}
 
-			if usage.Exists() || timings.Exists() {
-				return parseMetrics(modelID, start, usage, timings)
-			}
-		}
+	parsed := gjson.ParseBytes(data)
+	if parsed.Get("usage").Exists() || parsed.Get("timings").Exists() {
+		sp.last = append(sp.last[:0], data...)
 	}
+}
 
-	return TokenMetrics{}, errors.New("no valid JSON data found in stream")
+// metrics parses the last payload with usage or timings,
+// including the last line when the stream does not end with a line feed.
+func (sp *sseMetricsParser) metrics(modelID string, start time.Time) (TokenMetrics, error) {
+	if len(sp.line) > 0 && !sp.skip {
+		sp.parseLine(sp.line)
+		sp.line = sp.line[:0]
+	}
+	if sp.last == nil {
+		return TokenMetrics{}, errors.New("no valid JSON data found in stream")
+	}
+	parsed := gjson.ParseBytes(sp.last)
+	return parseMetrics(modelID, start, parsed.Get("usage"), parsed.Get("timings"))
 }
 
 func parseMetrics(modelID string, start time.Time, usage, timings gjson.Result) (TokenMetrics, error) {
@@ -231,6 +408,7 @@ func parseMetrics(modelID string, start time.Time, usage, timings gjson.Result)
 	cachedTokens := -1 // unknown or missing data
 	outputTokens := 0
 	inputTokens := 0
+	costUSD := 0.0
 
 	// timings data
 	tokensPerSecond := -1.0
@@ -256,6 +434,9 @@ func parseMetrics(modelID string, start time.Time, usage, timings gjson.Result)
 		if ct := usage.Get("cache_read_input_tokens"); ct.Exists() {
 			cachedTokens = int(ct.Int())
 		}
+
+		// OpenRouter
+		costUSD = usage.Get("cost").Float()
 	}
 
 	// use llama-server's timing data for tok/sec and duration as it is more accurate
@@ -280,6 +461,7 @@ func parseMetrics(modelID string, start time.Time, usage, timings gjson.Result)
 		PromptPerSecond: promptPerSecond,
 		TokensPerSecond: tokensPerSecond,
 		DurationMs:      durationMs,
+		CostUSD:         costUSD,
 	}, nil
 }
 
@@ -302,31 +484,59 @@ func decompressBody(body []byte, encoding string) ([]byte, error) {
 	}
 }
 
-// responseBodyCopier records the response body and writes to the original response writer
-// while also capturing it in a buffer for later processing.
+// metricsMaxBodySize caps the non streaming responses kept for the metrics,
+// larger responses (e.g. big embeddings batches) record minimal metrics.
+const metricsMaxBodySize = 4 << 20
+
+// responseBodyCopier writes to the original response writer and inspects the body for the metrics:
+// the SSE events are parsed while streaming, the other responses are buffered up to maxBodySize.
 type responseBodyCopier struct {
 	gin.ResponseWriter
-	body  *bytes.Buffer
-	tee   io.Writer
-	start time.Time
+	body        *bytes.Buffer
+	sse         *sseMetricsParser // text/event-stream responses, set on the first write
+	timings     *requestTimings   // optional
+	start       time.Time
+	maxBodySize int
+	truncated   bool // the body exceeded maxBodySize
 }
 
 func newBodyCopier(w gin.ResponseWriter) *responseBodyCopier {
-	bodyBuffer := &bytes.Buffer{}
 	return &responseBodyCopier{
 		ResponseWriter: w,
-		body:           bodyBuffer,
-		tee:            io.MultiWriter(w, bodyBuffer),
+		body:           &bytes.Buffer{},
+		maxBodySize:    metricsMaxBodySize,
 	}
 }
 
 func (w *responseBodyCopier) Write(b []byte) (int, error) {
 	if w.start.IsZero() {
 		w.start = time.Now()
+		// compressed streams are buffered, then decompressed
+		if strings.Contains(w.Header().Get("Content-Type"), "text/event-stream") && w.Header().Get("Content-Encoding") == "" {
+			w.sse = newSSEMetricsParser(w.maxBodySize)
+		}
+	}
+	if w.timings != nil {
+		w.timings.wroteFirstByte()
 	}
 
-	// Single write operation that writes to both the response and buffer
-	return w.tee.Write(b)
+	n, err := w.ResponseWriter.Write(b)
+	switch {
+	case w.sse != nil:
+		w.sse.Write(b[:n])
+	case w.truncated:
+	case w.body.Len()+n > w.maxBodySize:
+		w.truncated = true
+		w.body = &bytes.Buffer{} // release the memory
+	default:
+		w.body.Write(b[:n])
+	}
+	return n, err
+}
+
+// WriteString is also implemented by gin.ResponseWriter, it must not bypass Write.
+func (w *responseBodyCopier) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
 }
 
 func (w *responseBodyCopier) WriteHeader(statusCode int) {
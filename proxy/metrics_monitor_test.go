@@ -11,13 +11,17 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lynxai-team/goinfer/conf"
 	"github.com/lynxai-team/goinfer/event"
+	"github.com/lynxai-team/goinfer/proxy/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMetricsMonitor_AddMetrics(t *testing.T) {
@@ -832,3 +836,132 @@ func TestMetricsMonitor_WrapHandler_Compression(t *testing.T) {
 		assert.Equal(t, 100, metrics[0].OutputTokens)
 	})
 }
+
+func TestMetricsMonitor_RequestTimings(t *testing.T) {
+	begin := time.Now()
+	rt := &requestTimings{begin: begin}
+
+	// the loading messages are not upstream bytes
+	rt.wroteFirstByte()
+	assert.True(t, rt.firstByte.IsZero())
+
+	rt.queued = begin.Add(100 * time.Millisecond)
+	rt.ready = begin.Add(2100 * time.Millisecond)
+	rt.wroteFirstByte()
+	rt.firstByte = begin.Add(2500 * time.Millisecond)
+
+	var tm TokenMetrics
+	rt.apply(&tm)
+	assert.Equal(t, 100, tm.QueueWaitMs)
+	assert.Equal(t, 2000, tm.SwapWaitMs)
+	assert.Equal(t, 2500, tm.TTFTMs)
+
+	// no response body
+	var empty TokenMetrics
+	(&requestTimings{begin: begin}).apply(&empty)
+	assert.Equal(t, -1, empty.TTFTMs)
+
+	// called by Process.ProxyRequest even without metrics
+	var none *requestTimings
+	none.markQueued()
+	none.markReady()
+}
+
+func TestMetricsMonitor_RequestPhases(t *testing.T) {
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"phases-model": getTestSimpleResponderConfig("phases-model"),
+		},
+		LogLevel: "error",
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"phases-model","stream":true}`))
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	metrics := proxy.metricsMonitor.getMetrics()
+	require.Len(t, metrics, 2)
+	assert.Positive(t, metrics[0].SwapWaitMs, "the first request waits for the model to start")
+	assert.GreaterOrEqual(t, metrics[0].TTFTMs, metrics[0].SwapWaitMs)
+	assert.Zero(t, metrics[1].SwapWaitMs)
+	assert.GreaterOrEqual(t, metrics[1].TTFTMs, 0)
+}
+
+func TestMetricsMonitor_IncrementalSSE(t *testing.T) {
+	t.Run("parses the events split across writes without buffering the body", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		ginCtx, _ := gin.CreateTestContext(rec)
+		copier := newBodyCopier(ginCtx.Writer)
+		copier.Header().Set("Content-Type", "text/event-stream")
+
+		stream := `data: {"choices":[{"delta":{"content":"` + strings.Repeat("x", 1000) + `"}}]}` + "\n\n" +
+			`data: {"usage":{"prompt_tokens":7,"completion_tokens":3}}` + "\n\n" +
+			`data: {"choices":[],"timings":{"prompt_n":25,"predicted_n":10,"prompt_per_second":100,"predicted_per_second":50}}` + "\r\n\r\n" +
+			"data: [DONE]"
+		for i := 0; i < len(stream); i += 13 {
+			copier.Write([]byte(stream[i:min(i+13, len(stream))]))
+		}
+
+		assert.Equal(t, stream, rec.Body.String())
+		assert.Zero(t, copier.body.Len())
+		require.NotNil(t, copier.sse)
+		assert.Equal(t, "data: [DONE]", string(copier.sse.line), "only the current line is kept")
+
+		tm, err := copier.sse.metrics("m", time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 25, tm.InputTokens)
+		assert.Equal(t, 10, tm.OutputTokens)
+		assert.InDelta(t, 50, tm.TokensPerSecond, 0.001)
+	})
+
+	t.Run("skips the lines larger than the cap", func(t *testing.T) {
+		sp := newSSEMetricsParser(64)
+		sp.Write([]byte(`data: {"usage":{"prompt_tokens":1,"completion_tokens":2}}` + "\n"))
+		sp.Write([]byte(`data: {"usage":{"prompt_tokens":100,"completion_tokens":200},"pad":"` + strings.Repeat("x", 100) + "\"}\n"))
+		tm, err := sp.metrics("m", time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 1, tm.InputTokens)
+	})
+
+	t.Run("the last event without line feed is parsed", func(t *testing.T) {
+		sp := newSSEMetricsParser(1024)
+		sp.Write([]byte(`data: {"usage":{"prompt_tokens":4,"completion_tokens":5}}`))
+		tm, err := sp.metrics("m", time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 5, tm.OutputTokens)
+	})
+}
+
+func TestMetricsMonitor_MaxBodySize(t *testing.T) {
+	mm := newMetricsMonitor(testLogger, 10)
+	mm.maxBodySize = 100
+
+	nextHandler := func(modelID string, w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"data":"` + strings.Repeat("x", 200) + `",`))
+		w.Write([]byte(`"usage":{"prompt_tokens":100,"completion_tokens":50}}`))
+		return nil
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", http.NoBody)
+	rec := httptest.NewRecorder()
+	ginCtx, _ := gin.CreateTestContext(rec)
+
+	require.NoError(t, mm.wrapHandler("test-model", ginCtx.Writer, req, nextHandler))
+	assert.True(t, strings.HasSuffix(rec.Body.String(), `"completion_tokens":50}}`), "the client receives the whole response")
+
+	metrics := mm.getMetrics()
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "test-model", metrics[0].Model)
+	assert.Zero(t, metrics[0].InputTokens, "minimal metrics above the cap")
+}
@@ -0,0 +1,277 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metricsCurrentFile = "metrics.jsonl"
+	metricsFilePrefix  = "metrics-"
+	metricsFileSuffix  = ".jsonl"
+	metricsRotateTime  = "20060102T150405.000" // rotation time, the upper bound of the entries of the file
+)
+
+// metricsStore appends the token metrics to a JSONL file,
+// rotated when its size exceeds maxSize.
+type metricsStore struct {
+	file     *os.File
+	now      func() time.Time
+	dir      string
+	maxSize  int64
+	size     int64
+	maxFiles int
+	failing  bool // an error is reported, until the next successful rotation
+	mu       sync.Mutex
+}
+
+func newMetricsStore(dir string, maxSizeMB, maxFiles int) (*metricsStore, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the metrics directory: %w", err)
+	}
+
+	s := &metricsStore{
+		now:      time.Now,
+		dir:      dir,
+		maxSize:  int64(maxSizeMB) << 20,
+		maxFiles: maxFiles,
+	}
+	err = s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *metricsStore) open() error {
+	f, err := os.OpenFile(filepath.Join(s.dir, metricsCurrentFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("cannot open the metrics file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+// append writes one JSON line, and rotates the file when full.
+// An error is returned once, until the next successful rotation.
+func (s *metricsStore) append(tm TokenMetrics) error {
+	line, err := json.Marshal(tm)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rotateErr error
+	if s.file != nil && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		rotateErr = s.rotate() // on failure, metrics.jsonl goes on
+	}
+	if s.file == nil {
+		return s.report(errors.Join(rotateErr, errors.New("metrics store is closed")))
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return s.report(errors.Join(rotateErr, err))
+}
+
+// report returns err unless an error was already reported.
+func (s *metricsStore) report(err error) error {
+	if err == nil || s.failing {
+		return nil
+	}
+	s.failing = true
+	return err
+}
+
+// rotate renames the current file, removes the oldest files and opens a new one.
+// On failure, metrics.jsonl is reopened and the next rotation is tried after another maxSize.
+func (s *metricsStore) rotate() error {
+	err := s.file.Close()
+	s.file = nil
+	if err == nil {
+		err = s.rename()
+	}
+	if openErr := s.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	if err != nil {
+		s.size = 0
+		return err
+	}
+	s.failing = false
+	return nil
+}
+
+// rename moves the current file, closed, to a rotated file and removes the oldest ones.
+func (s *metricsStore) rename() error {
+	rotated := metricsFilePrefix + s.now().Format(metricsRotateTime) + metricsFileSuffix
+	err := os.Rename(filepath.Join(s.dir, metricsCurrentFile), filepath.Join(s.dir, rotated))
+	if err != nil {
+		return fmt.Errorf("cannot rotate the metrics file: %w", err)
+	}
+
+	if s.maxFiles > 0 {
+		files, err := s.rotatedFiles()
+		if err != nil {
+			return err
+		}
+		for len(files) > s.maxFiles {
+			os.Remove(files[0].path)
+			files = files[1:]
+		}
+	}
+	return nil
+}
+
+type metricsFile struct {
+	rotatedAt time.Time // zero for the current file
+	path      string
+}
+
+// rotatedFiles returns the rotated files, oldest first.
+func (s *metricsStore) rotatedFiles() ([]metricsFile, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []metricsFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, metricsFilePrefix) || !strings.HasSuffix(name, metricsFileSuffix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, metricsFilePrefix), metricsFileSuffix)
+		rotatedAt, err := time.ParseInLocation(metricsRotateTime, stamp, time.Local)
+		if err != nil {
+			continue // not one of our files
+		}
+		files = append(files, metricsFile{rotatedAt: rotatedAt, path: filepath.Join(s.dir, name)})
+	}
+
+	slices.SortFunc(files, func(a, b metricsFile) int { return a.rotatedAt.Compare(b.rotatedAt) })
+	return files, nil
+}
+
+// files returns the rotated files and the current one, oldest first.
+func (s *metricsStore) files() ([]metricsFile, error) {
+	files, err := s.rotatedFiles()
+	if err != nil {
+		return nil, err
+	}
+	return append(files, metricsFile{path: filepath.Join(s.dir, metricsCurrentFile)}), nil
+}
+
+// query calls fn for each stored metric in [from, to), oldest first.
+// A zero from or to means unbounded.
+func (s *metricsStore) query(from, to time.Time, fn func(TokenMetrics)) error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if !from.IsZero() && !f.rotatedAt.IsZero() && f.rotatedAt.Before(from) {
+			continue // all the entries of this file are older
+		}
+		err = readMetricsFile(f.path, func(tm TokenMetrics) bool {
+			if !from.IsZero() && tm.Timestamp.Before(from) {
+				return true
+			}
+			if !to.IsZero() && !tm.Timestamp.Before(to) {
+				return false // entries are appended in order
+			}
+			fn(tm)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tail returns the last n stored metrics, oldest first.
+func (s *metricsStore) tail(n int) ([]TokenMetrics, error) {
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []TokenMetrics
+	for i := len(files) - 1; i >= 0 && len(result) < n; i-- {
+		var metrics []TokenMetrics
+		err = readMetricsFile(files[i].path, func(tm TokenMetrics) bool {
+			metrics = append(metrics, tm)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		result = append(metrics, result...)
+	}
+
+	if len(result) > n {
+		result = result[len(result)-n:]
+	}
+	return result, nil
+}
+
+// readMetricsFile calls fn for each line until fn returns false,
+// invalid lines (e.g. truncated by a crash) are skipped.
+func readMetricsFile(path string, fn func(TokenMetrics) bool) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var tm TokenMetrics
+		if json.Unmarshal(scanner.Bytes(), &tm) != nil {
+			continue
+		}
+		if !fn(tm) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *metricsStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,113 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsStore_RotateAndQuery(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newMetricsStore(dir, 1, 2)
+	require.NoError(t, err)
+	store.maxSize = 300 // a couple of lines per file
+
+	start := time.Date(2026, 9, 1, 12, 0, 0, 0, time.Local)
+	for i := range 10 {
+		require.NoError(t, store.append(TokenMetrics{ID: i, Model: "m", Timestamp: start.Add(time.Duration(i) * time.Hour)}))
+		time.Sleep(2 * time.Millisecond) // distinct rotation file names
+	}
+
+	rotated, err := store.rotatedFiles()
+	require.NoError(t, err)
+	assert.Len(t, rotated, 2, "maxFiles removes the oldest rotated files")
+	assert.FileExists(t, filepath.Join(dir, metricsCurrentFile))
+
+	var ids []int
+	require.NoError(t, store.query(time.Time{}, time.Time{}, func(tm TokenMetrics) { ids = append(ids, tm.ID) }))
+	assert.Equal(t, 9, ids[len(ids)-1])
+	assert.Less(t, len(ids), 10, "the oldest entries were removed")
+
+	ids = nil
+	require.NoError(t, store.query(start.Add(7*time.Hour), start.Add(9*time.Hour), func(tm TokenMetrics) { ids = append(ids, tm.ID) }))
+	assert.Equal(t, []int{7, 8}, ids)
+
+	tail, err := store.tail(3)
+	require.NoError(t, err)
+	require.Len(t, tail, 3)
+	assert.Equal(t, 7, tail[0].ID)
+	assert.Equal(t, 9, tail[2].ID)
+	require.NoError(t, store.Close())
+}
+
+func TestMetricsStore_RotationFailure(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newMetricsStore(dir, 1, 0)
+	require.NoError(t, err)
+	defer store.Close()
+	store.maxSize = 150 // one line per file
+
+	now := time.Date(2026, 9, 1, 12, 0, 0, 0, time.Local)
+	store.now = func() time.Time { return now }
+	start := now
+
+	// the rotated file cannot be created: metrics.jsonl goes on, the error is returned once
+	rotated := filepath.Join(dir, metricsFilePrefix+"20260901T120000.000"+metricsFileSuffix)
+	require.NoError(t, os.Mkdir(rotated, 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(rotated, "busy"), nil, 0o600))
+	require.NoError(t, store.append(TokenMetrics{ID: 0, Model: "m", Timestamp: start}))
+	require.ErrorContains(t, store.append(TokenMetrics{ID: 1, Model: "m", Timestamp: start}), "cannot rotate the metrics file")
+	require.NoError(t, store.append(TokenMetrics{ID: 2, Model: "m", Timestamp: start}))
+
+	// rotated again once possible, nothing lost
+	now = now.Add(time.Second)
+	require.NoError(t, store.append(TokenMetrics{ID: 3, Model: "m", Timestamp: start}))
+	assert.False(t, store.failing)
+	files, err := store.rotatedFiles()
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	var ids []int
+	require.NoError(t, store.query(time.Time{}, time.Time{}, func(tm TokenMetrics) { ids = append(ids, tm.ID) }))
+	assert.Equal(t, []int{0, 1, 2, 3}, ids)
+}
+
+func TestMetricsStore_RestoreHistory(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newMetricsStore(dir, 10, 0)
+	require.NoError(t, err)
+	mm := newMetricsMonitor(testLogger, 10)
+	mm.setStore(store)
+	mm.addMetrics(TokenMetrics{Model: "a", InputTokens: 1})
+	mm.addMetrics(TokenMetrics{Model: "b", InputTokens: 2})
+	require.NoError(t, store.Close())
+
+	// a truncated line written by a crash is ignored
+	f, err := os.OpenFile(filepath.Join(dir, metricsCurrentFile), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"model":"trunc`)
+	require.NoError(t, err)
+	f.Close()
+
+	// restart
+	store, err = newMetricsStore(dir, 10, 0)
+	require.NoError(t, err)
+	defer store.Close()
+	mm = newMetricsMonitor(testLogger, 10)
+	mm.setStore(store)
+
+	metrics := mm.getMetrics()
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "b", metrics[1].Model)
+
+	mm.addMetrics(TokenMetrics{Model: "c"})
+	metrics = mm.getMetrics()
+	assert.Equal(t, 2, metrics[2].ID, "IDs continue after the restored history")
+}
@@ -0,0 +1,644 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/tidwall/gjson"
+)
+
+// The Ollama API is translated to the OpenAI and llama.cpp requests of ProxyInferenceHandler,
+// see https://github.com/ollama/ollama/blob/main/docs/api.md
+
+// ollamaKind is the Ollama endpoint of a request.
+type ollamaKind int
+
+const (
+	ollamaChat       ollamaKind = iota // /api/chat
+	ollamaGenerate                     // /api/generate
+	ollamaEmbed                        // /api/embed
+	ollamaEmbeddings                   // /api/embeddings (deprecated by Ollama)
+)
+
+// ollamaSamplingOptions are the Ollama options with the same name in llama-server.
+var ollamaSamplingOptions = []string{
+	"temperature", "top_p", "top_k", "min_p", "typical_p", "seed", "stop",
+	"presence_penalty", "frequency_penalty", "repeat_penalty", "repeat_last_n",
+	"mirostat", "mirostat_tau", "mirostat_eta",
+}
+
+type ollamaRequest struct {
+	Options   map[string]any  `json:"options"`
+	Stream    *bool           `json:"stream"` // default true
+	Think     *bool           `json:"think"`
+	Format    json.RawMessage `json:"format"`     // "json" or a JSON schema
+	Tools     json.RawMessage `json:"tools"`      // same format as OpenAI
+	KeepAlive json.RawMessage `json:"keep_alive"` // 0 unloads the model
+	Input     json.RawMessage `json:"input"`      // /api/embed: string or array of strings
+	Model     string          `json:"model"`
+	Prompt    string          `json:"prompt"`
+	Suffix    string          `json:"suffix"`
+	System    string          `json:"system"`
+	Messages  []ollamaMessage `json:"messages"`
+	Images    []string        `json:"images"`
+	Raw       bool            `json:"raw"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"` // a JSON object, a string in OpenAI
+	} `json:"function"`
+}
+
+// ollamaNotSupported answers the model management operations of Ollama.
+func (pm *ProxyManager) ollamaNotSupported(c *gin.Context) {
+	operation := strings.TrimPrefix(c.FullPath(), "/api/")
+	c.JSON(http.StatusNotImplemented, gin.H{
+		"error": operation + " is not supported: Goinfer serves the models of its configuration, see llama-swap.yml",
+	})
+}
+
+func (pm *ProxyManager) ollamaChat(c *gin.Context)       { pm.ollamaProxy(c, ollamaChat) }
+func (pm *ProxyManager) ollamaGenerate(c *gin.Context)   { pm.ollamaProxy(c, ollamaGenerate) }
+func (pm *ProxyManager) ollamaEmbed(c *gin.Context)      { pm.ollamaProxy(c, ollamaEmbed) }
+func (pm *ProxyManager) ollamaEmbeddings(c *gin.Context) { pm.ollamaProxy(c, ollamaEmbeddings) }
+
+// ollamaProxy translates the Ollama request, proxies it with ProxyInferenceHandler
+// and translates the response.
+func (pm *ProxyManager) ollamaProxy(c *gin.Context, kind ollamaKind) {
+	var req ollamaRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	if req.Model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+	model, found := pm.ollamaModelName(req.Model)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", req.Model)})
+		return
+	}
+
+	// an empty request loads or unloads the model
+	if (kind == ollamaChat && len(req.Messages) == 0) || (kind == ollamaGenerate && req.Prompt == "" && len(req.Images) == 0) {
+		pm.ollamaLoad(c, kind, req, model)
+		return
+	}
+
+	stream := (req.Stream == nil || *req.Stream) && (kind == ollamaChat || kind == ollamaGenerate)
+	path, body, err := ollamaUpstreamRequest(kind, req, model, stream)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ow := &ollamaWriter{model: req.Model, start: time.Now(), kind: kind, stream: stream}
+	ow.translateWriter = newTranslateWriter(c.Writer, ow.event)
+	pm.proxyTranslated(c, path, body, &ow.translateWriter)
+	ow.finish()
+}
+
+// ollamaModelName returns the model ID, or the peer model, of an Ollama model name:
+// the Ollama clients may add the default ":latest" tag.
+func (pm *ProxyManager) ollamaModelName(name string) (string, bool) {
+	for _, candidate := range []string{name, strings.TrimSuffix(name, ":latest")} {
+		if modelID, found := pm.cfg.Swap.RealModelName(candidate); found {
+			return modelID, true
+		}
+		if pm.peerProxy != nil && pm.peerProxy.HasPeerModel(candidate) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// ollamaLoad starts the model, or stops it with keep_alive 0.
+func (pm *ProxyManager) ollamaLoad(c *gin.Context, kind ollamaKind, req ollamaRequest, model string) {
+	reason := "load"
+	if processGroup := pm.findGroupByModelName(model); processGroup != nil {
+		if ka := strings.Trim(string(req.KeepAlive), `"`); ka == "0" || ka == "0s" {
+			reason = "unload"
+			if err := processGroup.StopProcess(model, StopImmediately); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		} else {
+			processGroup, err := pm.swapProcessGroup(c.Request.Context(), model)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			r, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, "/", http.NoBody)
+			if err := processGroup.ProxyRequest(model, &DiscardWriter{}, r); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	resp := gin.H{"model": req.Model, "created_at": ollamaTime(time.Now()), "done": true, "done_reason": reason}
+	if kind == ollamaChat {
+		resp["message"] = gin.H{"role": "assistant", "content": ""}
+	} else {
+		resp["response"] = ""
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ollamaUpstreamRequest returns the path and the body of the llama-server request:
+// /v1/chat/completions, /completion for the raw prompts, /infill with a suffix, /v1/embeddings.
+func ollamaUpstreamRequest(kind ollamaKind, req ollamaRequest, model string, stream bool) (string, []byte, error) {
+	body := map[string]any{"model": model}
+	path := "/v1/chat/completions"
+	maxTokens := "max_tokens"
+
+	switch kind {
+	case ollamaEmbed, ollamaEmbeddings:
+		input := any(req.Prompt)
+		if kind == ollamaEmbed {
+			if err := json.Unmarshal(req.Input, &input); err != nil {
+				return "", nil, fmt.Errorf("invalid input: %w", err)
+			}
+		}
+		body["input"] = input
+		b, err := json.Marshal(body)
+		return "/v1/embeddings", b, err
+
+	case ollamaGenerate:
+		switch {
+		case req.Suffix != "":
+			path, maxTokens = "/infill", "n_predict"
+			body["input_prefix"] = req.Prompt
+			body["input_suffix"] = req.Suffix
+			body["prompt"] = ""
+		case req.Raw:
+			path, maxTokens = "/completion", "n_predict"
+			body["prompt"] = req.Prompt
+		default:
+			var messages []ollamaMessage
+			if req.System != "" {
+				messages = append(messages, ollamaMessage{Role: "system", Content: req.System})
+			}
+			req.Messages = append(messages, ollamaMessage{Role: "user", Content: req.Prompt, Images: req.Images})
+		}
+	}
+
+	if path == "/v1/chat/completions" {
+		messages, err := ollamaMessages(req.Messages)
+		if err != nil {
+			return "", nil, err
+		}
+		body["messages"] = messages
+		if len(req.Tools) > 0 && string(req.Tools) != "null" {
+			body["tools"] = req.Tools
+		}
+		if req.Think != nil {
+			body["chat_template_kwargs"] = map[string]any{"enable_thinking": *req.Think}
+		}
+		if stream {
+			body["stream_options"] = map[string]any{"include_usage": true}
+		}
+	}
+
+	switch format := json.RawMessage(bytes.TrimSpace(req.Format)); {
+	case len(format) == 0 || string(format) == "null" || string(format) == `""`:
+	case string(format) == `"json"`:
+		body["response_format"] = map[string]any{"type": "json_object"}
+	case format[0] == '{':
+		if path == "/v1/chat/completions" {
+			body["response_format"] = map[string]any{"type": "json_schema", "json_schema": map[string]any{"name": "format", "schema": format}}
+		} else {
+			body["json_schema"] = format
+		}
+	default:
+		return "", nil, fmt.Errorf("invalid format: %s", format)
+	}
+
+	for _, name := range ollamaSamplingOptions {
+		if value, ok := req.Options[name]; ok {
+			body[name] = value
+		}
+	}
+	if n, ok := req.Options["num_predict"].(float64); ok && n > 0 {
+		body[maxTokens] = int(n)
+	}
+	body["stream"] = stream
+
+	b, err := json.Marshal(body)
+	return path, b, err
+}
+
+// ollamaMessages returns the OpenAI chat messages,
+// the tool results are linked to the previous tool calls in their order.
+func ollamaMessages(messages []ollamaMessage) ([]map[string]any, error) {
+	result := make([]map[string]any, 0, len(messages))
+	var pendingCalls []string // IDs of the tool calls without result
+	for i, msg := range messages {
+		m := map[string]any{"role": msg.Role, "content": msg.Content}
+		if len(msg.Images) > 0 {
+			parts := []any{map[string]any{"type": "text", "text": msg.Content}}
+			for _, image := range msg.Images {
+				parts = append(parts, map[string]any{
+					"type":      "image_url",
+					"image_url": map[string]any{"url": "data:" + imageMimeType(image) + ";base64," + image},
+				})
+			}
+			m["content"] = parts
+		}
+		if msg.Thinking != "" {
+			m["reasoning_content"] = msg.Thinking
+		}
+
+		var calls []any
+		for j, tc := range msg.ToolCalls {
+			arguments := string(tc.Function.Arguments)
+			if arguments == "" || arguments == "null" {
+				arguments = "{}"
+			}
+			if arguments[0] == '"' { // already encoded
+				if err := json.Unmarshal(tc.Function.Arguments, &arguments); err != nil {
+					return nil, fmt.Errorf("messages[%d]: invalid tool call arguments: %w", i, err)
+				}
+			}
+			id := "call_" + strconv.Itoa(i) + "_" + strconv.Itoa(j)
+			pendingCalls = append(pendingCalls, id)
+			calls = append(calls, map[string]any{
+				"id":       id,
+				"type":     "function",
+				"function": map[string]any{"name": tc.Function.Name, "arguments": arguments},
+			})
+		}
+		if len(calls) > 0 {
+			m["tool_calls"] = calls
+		}
+
+		if msg.Role == "tool" && len(pendingCalls) > 0 {
+			m["tool_call_id"] = pendingCalls[0]
+			pendingCalls = pendingCalls[1:]
+		}
+		if msg.ToolName != "" {
+			m["name"] = msg.ToolName
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// imageMimeType detects the type of a base64 encoded image (Ollama sends the bare data).
+func imageMimeType(data string) string {
+	switch {
+	case strings.HasPrefix(data, "/9j/"):
+		return "image/jpeg"
+	case strings.HasPrefix(data, "R0lGOD"):
+		return "image/gif"
+	case strings.HasPrefix(data, "UklGR"):
+		return "image/webp"
+	default:
+		return "image/png"
+	}
+}
+
+func ollamaTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// ollamaWriter translates the OpenAI and llama.cpp responses to the Ollama format:
+// NDJSON lines when streaming, a JSON object otherwise.
+type ollamaWriter struct {
+	translateWriter
+	start        time.Time
+	usage        gjson.Result
+	timings      gjson.Result
+	model        string // as requested
+	finishReason string
+	tools        []assembledToolCall
+	kind         ollamaKind
+	stream       bool // NDJSON for the client
+	done         bool // final line sent
+}
+
+// event translates an SSE event of the upstream stream.
+func (ow *ollamaWriter) event(data []byte) {
+	if bytes.Equal(data, []byte("[DONE]")) {
+		ow.writeFinal("", "")
+		return
+	}
+	if ow.done || !gjson.ValidBytes(data) {
+		return
+	}
+
+	event := gjson.ParseBytes(data)
+	if e := event.Get("error"); e.Exists() {
+		ow.writeLine(gin.H{"error": errorMessage(e)})
+		ow.done = true
+		return
+	}
+
+	content, thinking := ow.parse(event, "delta")
+	if content != "" || thinking != "" {
+		ow.writeLine(ow.message(content, thinking, false))
+	}
+}
+
+// parse returns the content and the reasoning of a chunk (delta) or a response (message),
+// and keeps the tool calls, the finish reason, the usage and the timings.
+func (ow *ollamaWriter) parse(result gjson.Result, messageKey string) (content, thinking string) {
+	if u := result.Get("usage"); u.IsObject() {
+		ow.usage = u
+	}
+	if t := result.Get("timings"); t.IsObject() {
+		ow.timings = t
+	}
+
+	// llama-server /completion and /infill
+	if c := result.Get("content"); c.Type == gjson.String {
+		if result.Get("stop").Bool() {
+			ow.finishReason = result.Get("stop_type").String()
+		}
+		return c.String(), ""
+	}
+
+	choice := result.Get("choices.0")
+	if reason := choice.Get("finish_reason").String(); reason != "" {
+		ow.finishReason = reason
+	}
+	msg := choice.Get(messageKey)
+	for _, call := range msg.Get("tool_calls").Array() {
+		index := int(call.Get("index").Int())
+		i := len(ow.tools)
+		for j := range ow.tools {
+			if ow.tools[j].Index == index {
+				i = j
+			}
+		}
+		if i == len(ow.tools) {
+			ow.tools = append(ow.tools, assembledToolCall{Index: index})
+		}
+		if name := call.Get("function.name").String(); name != "" {
+			ow.tools[i].Name = name
+		}
+		ow.tools[i].Arguments += call.Get("function.arguments").String()
+	}
+	return msg.Get("content").String() + choice.Get("text").String(), msg.Get("reasoning_content").String()
+}
+
+// message returns a chat or generate response line.
+func (ow *ollamaWriter) message(content, thinking string, final bool) gin.H {
+	line := gin.H{"model": ow.model, "created_at": ollamaTime(time.Now()), "done": final}
+	if ow.kind == ollamaChat {
+		msg := gin.H{"role": "assistant", "content": content}
+		if thinking != "" {
+			msg["thinking"] = thinking
+		}
+		if final && len(ow.tools) > 0 {
+			calls := make([]gin.H, 0, len(ow.tools))
+			for _, tc := range ow.tools {
+				arguments := json.RawMessage(tc.Arguments)
+				if !json.Valid(arguments) {
+					arguments, _ = json.Marshal(tc.Arguments)
+				}
+				calls = append(calls, gin.H{"function": gin.H{"name": tc.Name, "arguments": arguments}})
+			}
+			msg["tool_calls"] = calls
+		}
+		line["message"] = msg
+	} else {
+		line["response"] = content
+		if thinking != "" {
+			line["thinking"] = thinking
+		}
+	}
+
+	if final {
+		line["done_reason"] = "stop"
+		if ow.finishReason == "length" || ow.finishReason == "limit" {
+			line["done_reason"] = "length"
+		}
+		line["total_duration"] = time.Since(ow.start).Nanoseconds()
+		promptTokens, outputTokens := ow.usage.Get("prompt_tokens").Int(), ow.usage.Get("completion_tokens").Int()
+		if ow.timings.Exists() {
+			promptTokens, outputTokens = ow.timings.Get("prompt_n").Int(), ow.timings.Get("predicted_n").Int()
+			line["prompt_eval_duration"] = int64(ow.timings.Get("prompt_ms").Float() * 1e6)
+			line["eval_duration"] = int64(ow.timings.Get("predicted_ms").Float() * 1e6)
+		}
+		line["prompt_eval_count"] = promptTokens
+		line["eval_count"] = outputTokens
+	}
+	return line
+}
+
+// writeFinal sends the done line, once.
+func (ow *ollamaWriter) writeFinal(content, thinking string) {
+	if ow.done {
+		return
+	}
+	ow.done = true
+	ow.writeLine(ow.message(content, thinking, true))
+}
+
+// writeLine sends a NDJSON line to the client.
+func (ow *ollamaWriter) writeLine(line gin.H) {
+	if !ow.ResponseWriter.Written() {
+		ow.writeHeader(http.StatusOK, "application/x-ndjson")
+	}
+	b, _ := json.Marshal(line)
+	ow.ResponseWriter.Write(append(b, '\n'))
+	ow.ResponseWriter.Flush()
+}
+
+// finish sends the translation of the buffered response, or ends the stream.
+func (ow *ollamaWriter) finish() {
+	if ow.sse {
+		ow.endStream()
+		ow.writeFinal("", "")
+		return
+	}
+
+	status := ow.Status()
+	body := ow.body.Bytes()
+	if status != http.StatusOK {
+		msg := strings.TrimSpace(string(body))
+		if gjson.ValidBytes(body) {
+			msg = errorMessage(gjson.GetBytes(body, "error"))
+		}
+		ow.writeJSON(status, gin.H{"error": msg})
+		return
+	}
+	if !gjson.ValidBytes(body) {
+		ow.writeJSON(http.StatusBadGateway, gin.H{"error": "invalid upstream response: " + string(body)})
+		return
+	}
+	parsed := gjson.ParseBytes(body)
+
+	switch ow.kind {
+	case ollamaEmbed:
+		var embeddings []json.RawMessage
+		for _, d := range parsed.Get("data").Array() {
+			embeddings = append(embeddings, json.RawMessage(d.Get("embedding").Raw))
+		}
+		ow.writeJSON(http.StatusOK, gin.H{
+			"model":             ow.model,
+			"embeddings":        embeddings,
+			"total_duration":    time.Since(ow.start).Nanoseconds(),
+			"prompt_eval_count": parsed.Get("usage.prompt_tokens").Int(),
+		})
+	case ollamaEmbeddings:
+		ow.writeJSON(http.StatusOK, gin.H{"embedding": json.RawMessage(parsed.Get("data.0.embedding").Raw)})
+	default:
+		content, thinking := ow.parse(parsed, "message")
+		if ow.stream {
+			ow.writeFinal(content, thinking)
+			return
+		}
+		ow.done = true
+		ow.writeJSON(http.StatusOK, ow.message(content, thinking, true))
+	}
+}
+
+func (ow *ollamaWriter) writeJSON(status int, resp gin.H) {
+	if ow.ResponseWriter.Written() { // the stream has started
+		ow.writeLine(resp)
+		return
+	}
+	b, _ := json.Marshal(resp)
+	ow.writeResponse(status, "application/json; charset=utf-8", b)
+}
+
+// errorMessage returns the message of an OpenAI error object, or the error string.
+func errorMessage(e gjson.Result) string {
+	if msg := e.Get("message"); msg.Exists() {
+		return msg.String()
+	}
+	return e.String()
+}
+
+// ollamaTags lists the configured models, see /api/tags.
+func (pm *ProxyManager) ollamaTags(c *gin.Context) {
+	models := []gin.H{}
+	for modelID, modelConfig := range pm.cfg.Swap.Models {
+		if !modelConfig.Unlisted {
+			models = append(models, ollamaModelInfo(modelID, modelConfig))
+		}
+	}
+	if pm.peerProxy != nil {
+		for _, modelIDs := range pm.peerProxy.PeerModels() {
+			for _, modelID := range modelIDs {
+				models = append(models, ollamaModelInfo(modelID, &config.ModelConfig{}))
+			}
+		}
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i]["name"].(string) < models[j]["name"].(string) })
+	c.JSON(http.StatusOK, gin.H{"models": models})
+}
+
+// ollamaPS lists the running models, see /api/ps.
+func (pm *ProxyManager) ollamaPS(c *gin.Context) {
+	models := []gin.H{}
+	for _, processGroup := range pm.processGroups {
+		for modelID, process := range processGroup.processes {
+			if process.CurrentState() != StateReady {
+				continue
+			}
+			info := ollamaModelInfo(modelID, process.config)
+			info["size_vram"] = 0
+			if process.config.UnloadAfter > 0 {
+				ttl := time.Duration(process.config.UnloadAfter) * time.Second
+				info["expires_at"] = ollamaTime(process.getLastRequestHandled().Add(ttl))
+			}
+			delete(info, "modified_at")
+			models = append(models, info)
+		}
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i]["name"].(string) < models[j]["name"].(string) })
+	c.JSON(http.StatusOK, gin.H{"models": models})
+}
+
+// ollamaShow describes a model, see /api/show.
+func (pm *ProxyManager) ollamaShow(c *gin.Context) {
+	var req struct {
+		Model string `json:"model"`
+		Name  string `json:"name"` // before Ollama 0.4
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	name := cmp.Or(req.Model, req.Name)
+	modelID, found := pm.ollamaModelName(name)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", name)})
+		return
+	}
+	modelConfig, ok := pm.cfg.Swap.Models[modelID]
+	if !ok {
+		modelConfig = &config.ModelConfig{} // peer model
+	}
+
+	capabilities := []string{"completion"}
+	if caps, ok := modelConfig.Metadata["capabilities"].([]any); ok {
+		capabilities = capabilities[:0]
+		for _, capability := range caps {
+			capabilities = append(capabilities, fmt.Sprint(capability))
+		}
+	}
+	info := ollamaModelInfo(modelID, modelConfig)
+	c.JSON(http.StatusOK, gin.H{
+		"modelfile":    "",
+		"parameters":   "",
+		"template":     "",
+		"details":      info["details"],
+		"model_info":   gin.H{"general.description": modelConfig.Description},
+		"capabilities": capabilities,
+		"modified_at":  info["modified_at"],
+	})
+}
+
+// ollamaModelInfo returns the Ollama description of a model,
+// the details are read from the metadata (family, parameter_size, quantization_level).
+func ollamaModelInfo(modelID string, modelConfig *config.ModelConfig) gin.H {
+	detail := func(key string) string {
+		value, _ := modelConfig.Metadata[key].(string)
+		return value
+	}
+	digest := sha256.Sum256([]byte(modelID))
+	return gin.H{
+		"name":        modelID,
+		"model":       modelID,
+		"modified_at": ollamaTime(time.Now()),
+		"size":        0,
+		"digest":      hex.EncodeToString(digest[:]),
+		"details": gin.H{
+			"format":             "gguf",
+			"family":             detail("family"),
+			"parameter_size":     detail("parameter_size"),
+			"quantization_level": detail("quantization_level"),
+		},
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestOllama_UpstreamRequest(t *testing.T) {
+	req := ollamaRequest{
+		Model: "m",
+		Messages: []ollamaMessage{
+			{Role: "user", Content: "look", Images: []string{"/9j/AAAA"}},
+			{Role: "assistant", ToolCalls: []ollamaToolCall{{}}},
+			{Role: "tool", Content: "42", ToolName: "answer"},
+		},
+		Options: map[string]any{"temperature": 0.5, "num_predict": 100.0, "num_ctx": 4096.0},
+		Format:  json.RawMessage(`{"type":"object"}`),
+		Think:   new(bool),
+	}
+	req.Messages[1].ToolCalls[0].Function.Name = "answer"
+	req.Messages[1].ToolCalls[0].Function.Arguments = json.RawMessage(`{"q":1}`)
+
+	path, body, err := ollamaUpstreamRequest(ollamaChat, req, "model1", true)
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/chat/completions", path)
+	assert.JSONEq(t, `{
+		"model": "model1",
+		"messages": [
+			{"role":"user","content":[{"type":"text","text":"look"},{"type":"image_url","image_url":{"url":"data:image/jpeg;base64,/9j/AAAA"}}]},
+			{"role":"assistant","content":"","tool_calls":[{"id":"call_1_0","type":"function","function":{"name":"answer","arguments":"{\"q\":1}"}}]},
+			{"role":"tool","content":"42","tool_call_id":"call_1_0","name":"answer"}
+		],
+		"temperature": 0.5,
+		"max_tokens": 100,
+		"response_format": {"type":"json_schema","json_schema":{"name":"format","schema":{"type":"object"}}},
+		"chat_template_kwargs": {"enable_thinking": false},
+		"stream_options": {"include_usage": true},
+		"stream": true
+	}`, string(body))
+
+	// fill in the middle
+	path, body, err = ollamaUpstreamRequest(ollamaGenerate, ollamaRequest{Prompt: "def f(", Suffix: "):", Options: map[string]any{"num_predict": 8.0}}, "model1", false)
+	require.NoError(t, err)
+	assert.Equal(t, "/infill", path)
+	assert.JSONEq(t, `{"model":"model1","input_prefix":"def f(","input_suffix":"):","prompt":"","n_predict":8,"stream":false}`, string(body))
+
+	path, body, err = ollamaUpstreamRequest(ollamaGenerate, ollamaRequest{Prompt: "hi", System: "be brief", Format: json.RawMessage(`"json"`)}, "model1", false)
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/chat/completions", path)
+	assert.JSONEq(t, `{"model":"model1","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}],"response_format":{"type":"json_object"},"stream":false}`, string(body))
+
+	_, _, err = ollamaUpstreamRequest(ollamaGenerate, ollamaRequest{Prompt: "hi", Format: json.RawMessage(`"xml"`)}, "model1", false)
+	assert.EqualError(t, err, `invalid format: "xml"`)
+}
+
+func TestProxyManager_Ollama(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]string{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received[r.URL.Path] = string(body)
+		mu.Unlock()
+		stream := gjson.GetBytes(body, "stream").Bool()
+
+		switch {
+		case r.URL.Path == "/v1/chat/completions" && gjson.GetBytes(body, "messages.0.content").String() == "fail":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":400,"message":"context too long"}}`))
+		case r.URL.Path == "/v1/chat/completions" && stream:
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{
+				`{"choices":[{"delta":{"reasoning_content":"hmm"}}]}`,
+				`{"choices":[{"delta":{"content":"Hello "}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"c1","function":{"name":"get","arguments":"{\"a\":"}}]}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]},"finish_reason":"tool_calls"}]}`,
+				`{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":7}}`,
+				`[DONE]`,
+			} {
+				w.Write([]byte("data: " + chunk + "\n\n"))
+				w.(http.Flusher).Flush()
+			}
+		case r.URL.Path == "/v1/chat/completions":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"choices":[{"message":{"content":"Bonjour","reasoning_content":"fr"},"finish_reason":"length"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`))
+		case r.URL.Path == "/infill":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"content":"x, y","stop":true,"stop_type":"eos","timings":{"prompt_n":9,"prompt_ms":2,"predicted_n":4,"predicted_ms":8}}`))
+		case r.URL.Path == "/v1/embeddings":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"data":[{"embedding":[0.1,0.2]},{"embedding":[0.3,0.4]}],"usage":{"prompt_tokens":4}}`))
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": {
+				Proxy: upstream.URL, CheckEndpoint: "/health", UnloadAfter: 300,
+				Metadata: map[string]any{"family": "qwen2", "capabilities": []any{"completion", "tools"}},
+			},
+			"hidden": {Proxy: upstream.URL, CheckEndpoint: "/health", Unlisted: true},
+		},
+		LogLevel: "error",
+		Captures: config.CapturesConfig{Enabled: true, MaxCaptures: 10, MaxBodyKB: 64},
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	post := func(path, body string) *TestResponseRecorder {
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return w
+	}
+
+	// streamed chat, the default
+	w := post("/api/chat", `{"model":"model1:latest","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.NotEmpty(t, w.Header().Get(captureIDHeader))
+	var lines []map[string]any
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line), scanner.Text())
+		lines = append(lines, line)
+	}
+	require.Len(t, lines, 3)
+	assert.Equal(t, map[string]any{"role": "assistant", "content": "", "thinking": "hmm"}, lines[0]["message"])
+	assert.Equal(t, "Hello ", lines[1]["message"].(map[string]any)["content"])
+	assert.Equal(t, false, lines[1]["done"])
+	assert.Equal(t, "model1:latest", lines[1]["model"])
+	final := lines[2]
+	assert.Equal(t, true, final["done"])
+	assert.Equal(t, "stop", final["done_reason"])
+	assert.InDelta(t, 5, final["prompt_eval_count"], 0)
+	assert.InDelta(t, 7, final["eval_count"], 0)
+	assert.Equal(t, []any{map[string]any{"function": map[string]any{"name": "get", "arguments": map[string]any{"a": 1.0}}}},
+		final["message"].(map[string]any)["tool_calls"])
+	mu.Lock()
+	assert.Equal(t, "model1", gjson.Get(received["/v1/chat/completions"], "model").String())
+	assert.True(t, gjson.Get(received["/v1/chat/completions"], "stream_options.include_usage").Bool())
+	mu.Unlock()
+
+	// not streamed
+	w = post("/api/chat", `{"model":"model1","stream":false,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	resp := gjson.Parse(w.Body.String())
+	assert.Equal(t, "Bonjour", resp.Get("message.content").String())
+	assert.Equal(t, "fr", resp.Get("message.thinking").String())
+	assert.Equal(t, "length", resp.Get("done_reason").String())
+	assert.Equal(t, int64(1), resp.Get("eval_count").Int())
+
+	// fill in the middle with llama-server /infill
+	w = post("/api/generate", `{"model":"model1","prompt":"f(","suffix":")","stream":false}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	resp = gjson.Parse(w.Body.String())
+	assert.Equal(t, "x, y", resp.Get("response").String())
+	assert.Equal(t, int64(9), resp.Get("prompt_eval_count").Int())
+	assert.Equal(t, int64(8000000), resp.Get("eval_duration").Int())
+
+	w = post("/api/embed", `{"model":"model1","input":["a","b"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `[[0.1,0.2],[0.3,0.4]]`, gjson.Get(w.Body.String(), "embeddings").Raw)
+	w = post("/api/embeddings", `{"model":"model1","prompt":"a"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"embedding":[0.1,0.2]}`, w.Body.String())
+
+	// errors
+	w = post("/api/chat", `{"model":"model1","messages":[{"role":"user","content":"fail"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"context too long"}`, w.Body.String())
+	w = post("/api/generate", `{"model":"unknown","prompt":"hi"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"model 'unknown' not found"}`, w.Body.String())
+	w = post("/api/pull", `{"model":"llama3"}`)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+	assert.Contains(t, gjson.Get(w.Body.String(), "error").String(), "pull is not supported")
+
+	// models
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tags", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `["model1"]`, gjson.Get(w.Body.String(), "models.#.name").Raw)
+	assert.Equal(t, "qwen2", gjson.Get(w.Body.String(), "models.0.details.family").String())
+
+	w = post("/api/show", `{"model":"model1"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `["completion","tools"]`, gjson.Get(w.Body.String(), "capabilities").Raw)
+
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/ps", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `["model1"]`, gjson.Get(w.Body.String(), "models.#.name").Raw)
+	assert.NotEmpty(t, gjson.Get(w.Body.String(), "models.0.expires_at").String())
+
+	// an empty request unloads the model with keep_alive 0
+	w = post("/api/generate", `{"model":"model1","keep_alive":0}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "unload", gjson.Get(w.Body.String(), "done_reason").String())
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/ps", http.NoBody))
+	assert.JSONEq(t, `{"models":[]}`, w.Body.String())
+
+	w = post("/api/chat", `{"model":"model1","messages":[]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "load", gjson.Get(w.Body.String(), "done_reason").String())
+	assert.Equal(t, StateReady, proxy.processGroups[config.DEFAULT_GROUP_ID].processes["model1"].CurrentState())
+}
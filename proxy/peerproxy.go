@@ -5,32 +5,59 @@
 package proxy
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"runtime"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/tidwall/gjson"
 )
 
+// clientCredentialHeaders are not forwarded to the peers, see PeerConfig.AuthHeaders.
+var clientCredentialHeaders = []string{"Authorization", "X-Api-Key", "Proxy-Authorization"}
+
 type peerProxyMember struct {
 	peerID       string
 	reverseProxy *httputil.ReverseProxy
-	apiKey       string
+	headers      map[string]string // auth headers, see PeerConfig.AuthHeaders
+	health       *circuitBreaker
+	discovered   []string // models listed by the peer /v1/models, see PeerConfig.Discover
+	inFlight     atomic.Int32
 }
 
 type PeerProxy struct {
 	peers    config.PeerDictionaryConfig
-	proxyMap map[string]*peerProxyMember
+	peerIDs  []string // sorted: the first peer listing a model serves it
+	members  map[string]*peerProxyMember
+	client   *http.Client // polls /v1/models
+	logger   *LogMonitor
+	mu       sync.RWMutex
+	proxyMap map[string][]*peerProxyMember // the peers serving each model, sorted by ID
 }
 
-func NewPeerProxy(peers config.PeerDictionaryConfig, proxyLogger *LogMonitor) (*PeerProxy, error) {
-	proxyMap := make(map[string]*peerProxyMember)
+// PeerStatus is the health of a peer, see /api/peers.
+type PeerStatus struct {
+	ID        string   `json:"id"`
+	Healthy   bool     `json:"healthy"`
+	Failures  int      `json:"failures"`
+	LastError string   `json:"lastError,omitempty"`
+	Models    []string `json:"models"`
+}
 
+func NewPeerProxy(peers config.PeerDictionaryConfig, proxyLogger *LogMonitor) (*PeerProxy, error) {
 	// Sort peer IDs for consistent iteration order
 	peerIDs := make([]string, 0, len(peers))
 	for peerID := range peers {
@@ -53,12 +80,30 @@ func NewPeerProxy(peers config.PeerDictionaryConfig, proxyLogger *LogMonitor) (*
 		IdleConnTimeout:       90 * time.Second,
 	}
 
+	p := &PeerProxy{
+		peers:   peers,
+		peerIDs: peerIDs,
+		members: make(map[string]*peerProxyMember, len(peers)),
+		client:  &http.Client{Transport: peerTransport, Timeout: 10 * time.Second},
+		logger:  proxyLogger,
+	}
+
 	for _, peerID := range peerIDs {
 		peer := peers[peerID]
 		// Create reverse proxy for this peer
 		reverseProxy := httputil.NewSingleHostReverseProxy(peer.ProxyURL)
 		reverseProxy.Transport = peerTransport
 
+		pp := &peerProxyMember{
+			peerID:       peerID,
+			reverseProxy: reverseProxy,
+			headers:      peer.AuthHeaders(),
+			health: &circuitBreaker{
+				threshold: cmp.Or(peer.Health.FailureThreshold, 3),
+				cooldown:  time.Duration(cmp.Or(peer.Health.Cooldown, 30)) * time.Second,
+			},
+		}
+
 		// Wrap Director to set Host header for remote hosts (not localhost)
 		originalDirector := reverseProxy.Director
 		reverseProxy.Director = func(req *http.Request) {
@@ -68,6 +113,12 @@ func NewPeerProxy(peers config.PeerDictionaryConfig, proxyLogger *LogMonitor) (*
 		}
 
 		reverseProxy.ModifyResponse = func(resp *http.Response) error {
+			switch resp.StatusCode {
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				p.recordFailure(pp, fmt.Errorf("HTTP %d", resp.StatusCode))
+			default:
+				p.recordSuccess(pp)
+			}
 			if strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "text/event-stream") {
 				resp.Header.Set("X-Accel-Buffering", "no")
 			}
@@ -75,7 +126,12 @@ func NewPeerProxy(peers config.PeerDictionaryConfig, proxyLogger *LogMonitor) (*
 		}
 
 		reverseProxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			proxyLogger.Warnf("peer %s: proxy error: %v", peerID, err)
+			if errors.Is(err, context.Canceled) {
+				pp.health.release()
+			} else {
+				p.recordFailure(pp, err)
+			}
+			proxyLogger.ForRequest(r.Context()).Warnf("peer %s: proxy error: %v", peerID, err)
 			errMsg := fmt.Sprintf("peer proxy error: %v", err)
 			if runtime.GOOS == "darwin" && strings.Contains(err.Error(), "connect: no route to host") {
 				errMsg += " (hint: on macOS, check System Settings > Privacy & Security > Local Network permissions)"
@@ -83,49 +139,290 @@ func NewPeerProxy(peers config.PeerDictionaryConfig, proxyLogger *LogMonitor) (*
 			http.Error(w, errMsg, http.StatusBadGateway)
 		}
 
-		pp := &peerProxyMember{
-			peerID:       peerID,
-			reverseProxy: reverseProxy,
-			apiKey:       peer.ApiKey,
-		}
+		p.members[peerID] = pp
+	}
+
+	p.mu.Lock()
+	p.rebuild()
+	p.mu.Unlock()
+	return p, nil
+}
 
-		// Map each model to this peer's proxy
-		for _, modelID := range peer.Models {
-			if _, found := proxyMap[modelID]; found {
-				proxyLogger.Warnf("peer %s: model %s already mapped to another peer, skipping", peerID, modelID)
-				continue
+// rebuild maps each model to its peers: the configured models and the discovered ones.
+// The caller holds p.mu.
+func (p *PeerProxy) rebuild() {
+	proxyMap := make(map[string][]*peerProxyMember)
+	for _, peerID := range p.peerIDs {
+		pp := p.members[peerID]
+		for _, modelID := range append(p.peers[peerID].ServedModels(), pp.discovered...) {
+			if !slices.Contains(proxyMap[modelID], pp) {
+				proxyMap[modelID] = append(proxyMap[modelID], pp)
 			}
-			proxyMap[modelID] = pp
 		}
 	}
+	p.proxyMap = proxyMap
+}
+
+func (p *PeerProxy) recordSuccess(pp *peerProxyMember) {
+	if pp.health.success() {
+		p.logger.Infof("peer %s: healthy again", pp.peerID)
+	}
+}
+
+func (p *PeerProxy) recordFailure(pp *peerProxyMember, err error) {
+	if pp.health.failure(err) {
+		p.logger.Warnf("peer %s: unhealthy after %d consecutive failures, last: %v", pp.peerID, pp.health.threshold, err)
+	}
+}
+
+// StartPolling polls /v1/models of the peers having a health interval, until ctx is done.
+func (p *PeerProxy) StartPolling(ctx context.Context) {
+	for _, peerID := range p.peerIDs {
+		interval := p.peers[peerID].Health.Interval
+		if interval <= 0 {
+			continue
+		}
+		go func() {
+			ticker := time.NewTicker(time.Duration(interval) * time.Second)
+			defer ticker.Stop()
+			for {
+				p.poll(ctx, peerID)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+}
+
+// poll checks the peer and updates its discovered models.
+func (p *PeerProxy) poll(ctx context.Context, peerID string) {
+	peer := p.peers[peerID]
+	pp := p.members[peerID]
+
+	models, err := p.fetchModels(ctx, peer, pp)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		p.logger.Debugf("peer %s: poll failed: %v", peerID, err)
+		p.recordFailure(pp, err)
+		return
+	}
+	p.recordSuccess(pp)
+
+	if !peer.Discover {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !slices.Equal(models, pp.discovered) {
+		p.logger.Infof("peer %s: discovered models %v", peerID, models)
+		pp.discovered = models
+		p.rebuild()
+	}
+}
+
+// fetchModels returns the sorted model IDs listed by the peer /v1/models.
+func (p *PeerProxy) fetchModels(ctx context.Context, peer config.PeerConfig, pp *peerProxyMember) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer.ProxyURL.JoinPath("v1", "models").String(), http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range pp.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-	return &PeerProxy{
-		peers:    peers,
-		proxyMap: proxyMap,
-	}, nil
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("/v1/models: HTTP " + strconv.Itoa(resp.StatusCode))
+	}
+	data := gjson.GetBytes(body, "data")
+	if !data.IsArray() {
+		return nil, errors.New("/v1/models: no data array")
+	}
+	models := []string{}
+	for _, m := range data.Array() {
+		if id := m.Get("id").String(); id != "" && !slices.Contains(models, id) {
+			models = append(models, id)
+		}
+	}
+	sort.Strings(models)
+	return models, nil
 }
 
 func (p *PeerProxy) HasPeerModel(modelID string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	_, found := p.proxyMap[modelID]
 	return found
 }
 
+// PeerID returns the ID of the first peer serving the model, empty if none.
+func (p *PeerProxy) PeerID(modelID string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if members := p.proxyMap[modelID]; len(members) > 0 {
+		return members[0].peerID
+	}
+	return ""
+}
+
+// Pick returns the ID of the peer serving the request: with a session, the same peer
+// while it is healthy, otherwise the healthy peer having the least in-flight requests.
+func (p *PeerProxy) Pick(modelID, session string) string {
+	p.mu.RLock()
+	members := p.proxyMap[modelID]
+	p.mu.RUnlock()
+	if len(members) == 0 {
+		return ""
+	}
+
+	ready := make([]*peerProxyMember, 0, len(members))
+	for _, pp := range members {
+		if pp.health.ready() {
+			ready = append(ready, pp)
+		}
+	}
+	if len(ready) == 0 {
+		return members[0].peerID
+	}
+	chosen := ready[0]
+	for _, pp := range ready[1:] {
+		if session != "" {
+			if rendezvousScore(session, pp.peerID) > rendezvousScore(session, chosen.peerID) {
+				chosen = pp
+			}
+		} else if pp.inFlight.Load() < chosen.inFlight.Load() {
+			chosen = pp
+		}
+	}
+	return chosen.peerID
+}
+
+// Healthy reports whether a healthy peer serves the model.
+func (p *PeerProxy) Healthy(modelID string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, pp := range p.proxyMap[modelID] {
+		if pp.health.healthy() {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *PeerProxy) ListPeers() config.PeerDictionaryConfig {
 	return p.peers
 }
 
+// PeerModels returns the sorted models of the healthy peers, each model under its first healthy peer.
+func (p *PeerProxy) PeerModels() map[string][]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	models := make(map[string][]string, len(p.members))
+	for modelID, members := range p.proxyMap {
+		for _, pp := range members {
+			if pp.health.healthy() {
+				models[pp.peerID] = append(models[pp.peerID], modelID)
+				break
+			}
+		}
+	}
+	for peerID := range models {
+		sort.Strings(models[peerID])
+	}
+	return models
+}
+
+// Status returns the health and the served models of the peers, sorted by ID.
+func (p *PeerProxy) Status() []PeerStatus {
+	p.mu.RLock()
+	served := make(map[string][]string, len(p.members))
+	for modelID, members := range p.proxyMap {
+		for _, pp := range members {
+			served[pp.peerID] = append(served[pp.peerID], modelID)
+		}
+	}
+	p.mu.RUnlock()
+
+	status := make([]PeerStatus, 0, len(p.peerIDs))
+	for _, peerID := range p.peerIDs {
+		h := p.members[peerID].health
+		h.mu.Lock()
+		s := PeerStatus{
+			ID:        peerID,
+			Healthy:   h.openedAt.IsZero(),
+			Failures:  h.failures,
+			LastError: h.lastError,
+			Models:    served[peerID],
+		}
+		h.mu.Unlock()
+		if s.Models == nil {
+			s.Models = []string{}
+		}
+		sort.Strings(s.Models)
+		status = append(status, s)
+	}
+	return status
+}
+
 func (p *PeerProxy) ProxyRequest(model_id string, writer http.ResponseWriter, request *http.Request) error {
-	pp, found := p.proxyMap[model_id]
-	if !found {
+	// the peer picked by ProxyInferenceHandler, or the one picked now
+	peerID, _ := request.Context().Value(proxyCtxKey("peer")).(string)
+	if peerID == "" {
+		peerID = p.Pick(model_id, "")
+	}
+	var pp *peerProxyMember
+	p.mu.RLock()
+	for _, member := range p.proxyMap[model_id] {
+		if member.peerID == peerID {
+			pp = member
+		}
+	}
+	p.mu.RUnlock()
+	if pp == nil {
 		return fmt.Errorf("no peer proxy found for model %s", model_id)
 	}
 
-	// Inject API key if configured for this peer
-	if pp.apiKey != "" {
-		request.Header.Set("Authorization", "Bearer "+pp.apiKey)
-		request.Header.Set("X-Api-Key", pp.apiKey)
+	// open circuit: fail fast instead of waiting for the peer timeouts
+	if !pp.health.allow() {
+		writer.Header().Set("Retry-After", strconv.Itoa(int(pp.health.cooldown.Seconds())))
+		http.Error(writer, fmt.Sprintf("peer %s is unavailable", pp.peerID), http.StatusServiceUnavailable)
+		return nil
 	}
 
-	pp.reverseProxy.ServeHTTP(writer, request)
+	// the provider credentials replace the client ones, on a copy: the next fallback reuses the request
+	request = request.Clone(request.Context())
+	for _, name := range clientCredentialHeaders {
+		request.Header.Del(name)
+	}
+	for name, value := range pp.headers {
+		request.Header.Set(name, value)
+	}
+
+	pp.inFlight.Add(1)
+	defer pp.inFlight.Add(-1)
+
+	// no process group nor model start for a peer: sent upstream right away
+	timings := requestTimingsFrom(request)
+	timings.markQueued()
+	timings.markReady()
+
+	ctx, span := startSpan(request.Context(), "peer "+model_id, spanKindClient)
+	span.setAttr("goinfer.peer", pp.peerID)
+	injectTraceparent(ctx, request.Header)
+	pp.reverseProxy.ServeHTTP(writer, request.WithContext(ctx))
+	span.finish(nil)
 	return nil
 }
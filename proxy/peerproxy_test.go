@@ -5,15 +5,21 @@
 package proxy
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/lynxai-team/goinfer/conf"
 	"github.com/lynxai-team/goinfer/proxy/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
 )
 
 func TestNewPeerProxy_EmptyPeers(t *testing.T) {
@@ -68,9 +74,9 @@ func TestNewPeerProxy_MultiplePeers(t *testing.T) {
 	assert.True(t, pm.HasPeerModel("model-d"))
 }
 
-func TestNewPeerProxy_DuplicateModelWarning(t *testing.T) {
-	// When the same model is in multiple peers, only the first (lexicographically by peer ID)
-	// should be mapped, and a warning should be logged
+func TestNewPeerProxy_DuplicateModel(t *testing.T) {
+	// When the same model is in multiple peers, the peers are replicas of the model,
+	// sorted by peer ID
 	proxyURL1, _ := url.Parse("http://peer1.example.com:8080")
 	proxyURL2, _ := url.Parse("http://peer2.example.com:8080")
 	peers := config.PeerDictionaryConfig{
@@ -88,9 +94,10 @@ func TestNewPeerProxy_DuplicateModelWarning(t *testing.T) {
 
 	pm, err := NewPeerProxy(peers, testLogger)
 	require.NoError(t, err)
-	// Should only have one entry for the duplicate model
 	assert.Len(t, pm.proxyMap, 1)
-	assert.True(t, pm.HasPeerModel("duplicate-model"))
+	require.Len(t, pm.proxyMap["duplicate-model"], 2)
+	assert.Equal(t, "alpha-peer", pm.PeerID("duplicate-model"))
+	assert.Equal(t, "beta-peer", pm.proxyMap["duplicate-model"][1].peerID)
 }
 
 func TestHasPeerModel(t *testing.T) {
@@ -270,3 +277,191 @@ func TestProxyRequest_SSEHeaderModification(t *testing.T) {
 	// The X-Accel-Buffering header should be set to "no" for SSE
 	assert.Equal(t, "no", w.Header().Get("X-Accel-Buffering"))
 }
+
+func TestProxyManager_PeerProvider(t *testing.T) {
+	var mu sync.Mutex
+	var received []*http.Request
+	var bodies []string
+	// local stand-in of a paid provider (OpenRouter)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, r)
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if gjson.GetBytes(body, "model").String() == "deepseek/deepseek-r1" {
+			w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":100,"completion_tokens":10,"cost":0.25}}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":1000,"completion_tokens":500}}`))
+	}))
+	defer provider.Close()
+	providerURL, _ := url.Parse(provider.URL)
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		RequiredAPIKeys:    []string{"sk-team", "sk-intern"},
+		APIKeyQuotas:       []config.APIKeyQuota{{Name: "team", Key: "sk-team"}, {Name: "intern", Key: "sk-intern"}},
+		Peers: config.PeerDictionaryConfig{
+			"openrouter": {
+				Proxy:      provider.URL,
+				ProxyURL:   providerURL,
+				ApiKey:     "sk-or-secret",
+				Headers:    map[string]string{"Authorization": "Bearer ${apiKey}", "X-Title": "goinfer"},
+				Models:     []string{"free-model"},
+				ModelNames: map[string]string{"r1": "deepseek/deepseek-r1"},
+				Access:     config.PeerAccess{Models: []string{"r1"}, Deny: []string{"intern"}},
+				Pricing:    map[string]config.ModelPricing{"free-model": {Input: 1, Output: 2}},
+			},
+		},
+		LogLevel: "error",
+	}
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	post := func(key, model string) *TestResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+model+`","messages":[]}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, req)
+		return w
+	}
+
+	// paid model: mapped name, provider key injected, client key not forwarded
+	w := post("sk-team", "r1")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	mu.Lock()
+	require.Len(t, received, 1)
+	assert.Equal(t, "Bearer sk-or-secret", received[0].Header.Get("Authorization"))
+	assert.Equal(t, "goinfer", received[0].Header.Get("X-Title"))
+	assert.Empty(t, received[0].Header.Get("X-Api-Key"))
+	assert.JSONEq(t, `{"model":"deepseek/deepseek-r1","messages":[]}`, bodies[0])
+	mu.Unlock()
+
+	// denied key
+	w = post("sk-intern", "r1")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "API key intern is not allowed to use r1")
+
+	// free model, any key, cost from the pricing
+	w = post("sk-intern", "free-model")
+	require.Equal(t, http.StatusOK, w.Code)
+	mu.Lock()
+	assert.Len(t, received, 2)
+	mu.Unlock()
+
+	// spend by provider
+	w = CreateTestResponseRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/usage?group_by=peer", http.NoBody)
+	req.Header.Set("Authorization", "Bearer sk-team")
+	proxy.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var report UsageReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	require.Len(t, report.Groups, 1)
+	assert.Equal(t, "openrouter", report.Groups[0].Key)
+	assert.Equal(t, 2, report.Groups[0].Requests)
+	assert.InDelta(t, 0.25+0.002, report.Groups[0].CostUSD, 1e-9)
+
+	// time to first byte of the peer responses
+	metrics := proxy.metricsMonitor.getMetrics()
+	require.Len(t, metrics, 2)
+	for _, tm := range metrics {
+		assert.Equal(t, "openrouter", tm.Peer)
+		assert.GreaterOrEqual(t, tm.TTFTMs, 0)
+		assert.Zero(t, tm.SwapWaitMs)
+	}
+
+	// listed under the served names
+	w = CreateTestResponseRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/v1/models", http.NoBody)
+	req.Header.Set("Authorization", "Bearer sk-team")
+	proxy.ServeHTTP(w, req)
+	assert.JSONEq(t, `["free-model","r1"]`, gjson.Get(w.Body.String(), "data.#.id").Raw)
+}
+
+func TestProxyManager_PeerDiscovery(t *testing.T) {
+	var mu sync.Mutex
+	models := `{"data":[{"id":"llama"},{"id":"qwen"}]}`
+	down := false
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/models" {
+			w.Write([]byte(models))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}]}`))
+	}))
+	defer peer.Close()
+	peerURL, _ := url.Parse(peer.URL)
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Peers: config.PeerDictionaryConfig{
+			"box": {
+				Proxy:    peer.URL,
+				ProxyURL: peerURL,
+				Models:   []string{"static"},
+				Discover: true,
+				Health:   config.PeerHealth{Interval: 1, FailureThreshold: 2, Cooldown: 60},
+			},
+		},
+		LogLevel: "error",
+	}
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	get := func(path string) *TestResponseRecorder {
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		return w
+	}
+	post := func(model string) *TestResponseRecorder {
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+model+`"}`)))
+		return w
+	}
+	listed := func() string { return gjson.Get(get("/v1/models").Body.String(), "data.#.id").Raw }
+
+	// discovered at the first poll
+	require.Eventually(t, func() bool { return listed() == `["llama","qwen","static"]` }, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, http.StatusOK, post("qwen").Code)
+
+	// the model map follows the peer
+	mu.Lock()
+	models = `{"data":[{"id":"llama"},{"id":"mistral"}]}`
+	mu.Unlock()
+	require.Eventually(t, func() bool { return listed() == `["llama","mistral","static"]` }, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, http.StatusBadRequest, post("qwen").Code, "no longer served")
+
+	// down: the circuit opens, the models are hidden, the requests fail fast
+	mu.Lock()
+	down = true
+	mu.Unlock()
+	assert.Equal(t, http.StatusServiceUnavailable, post("llama").Code)
+	require.Eventually(t, func() bool { return listed() == `[]` }, 5*time.Second, 20*time.Millisecond)
+	w := post("llama")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "peer box is unavailable")
+	assert.Equal(t, `[false]`, gjson.Get(get("/api/peers").Body.String(), "#.healthy").Raw)
+	assert.Equal(t, `["unhealthy","unhealthy","unhealthy"]`, gjson.Get(get("/api/models").Body.String(), "#.state").Raw)
+
+	// back: the next poll closes the circuit
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	require.Eventually(t, func() bool { return listed() == `["llama","mistral","static"]` }, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, http.StatusOK, post("llama").Code)
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"net/http"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/lynxai-team/goinfer/event"
 	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/tidwall/gjson"
 )
 
 type ProcessState string
@@ -34,6 +36,9 @@ const (
 	StateReady    ProcessState = ProcessState("ready")
 	StateStopping ProcessState = ProcessState("stopping")
 
+	// StateUnhealthy means the liveness probes failed, the process is drained before stopping.
+	StateUnhealthy ProcessState = ProcessState("unhealthy")
+
 	// StateShutdown means the process will not be restarted.
 	StateShutdown ProcessState = ProcessState("shutdown")
 )
@@ -45,6 +50,12 @@ const (
 	StopWaitForInflightRequest
 )
 
+// errRouterModelUnloaded is returned by the health check when the router has unloaded the model.
+var errRouterModelUnloaded = errors.New("model unloaded by the router")
+
+// hookTimeout limits the on_load/on_unload requests of an external model.
+const hookTimeout = 2 * time.Minute
+
 type Process struct {
 	lastRequestHandled        time.Time
 	config                    *config.ModelConfig
@@ -55,6 +66,10 @@ type Process struct {
 	cmdWaitChan               chan struct{}
 	processLogger             *LogMonitor
 	proxyLogger               *LogMonitor
+	loadProgress              *loadProgressParser
+	slots                     *slotCache // nil without slots.count
+	loadDuration              *histogram // startup until ready
+	swapDuration              *histogram // requests waiting for the startup
 	ID                        string
 	state                     ProcessState
 	inFlightRequests          sync.WaitGroup
@@ -62,11 +77,13 @@ type Process struct {
 	healthCheckLoopInterval   time.Duration
 	healthCheckTimeout        int
 	gracefulStopTimeout       time.Duration
+	unhealthyDrainTimeout     time.Duration
 	failedStartCount          int
 	lastRequestHandledMutex   sync.RWMutex
 	stateMutex                sync.RWMutex
 	cmdMutex                  sync.RWMutex
 	inFlightRequestsCount     atomic.Int32
+	queuedRequestsCount       atomic.Int32
 }
 
 func NewProcess(id string, healthCheckTimeout int, config *config.ModelConfig, processLogger, proxyLogger *LogMonitor) *Process {
@@ -93,6 +110,10 @@ func NewProcess(id string, healthCheckTimeout int, config *config.ModelConfig, p
 		}
 	}
 
+	loadProgress := newLoadProgressParser(func(lp LoadProgress) {
+		event.Emit(ModelLoadProgressEvent{ProcessName: id, Progress: lp})
+	})
+
 	return &Process{
 		ID:                      id,
 		config:                  config,
@@ -101,6 +122,10 @@ func NewProcess(id string, healthCheckTimeout int, config *config.ModelConfig, p
 		cancelUpstream:          nil,
 		processLogger:           processLogger,
 		proxyLogger:             proxyLogger,
+		loadProgress:            loadProgress,
+		slots:                   newSlotCache(id, config.Slots, proxyLogger),
+		loadDuration:            newHistogram(durationBuckets),
+		swapDuration:            newHistogram(durationBuckets),
 		healthCheckTimeout:      healthCheckTimeout,
 		healthCheckLoopInterval: 5 * time.Second, /* default, can not be set by user - used for testing */
 		state:                   StateStopped,
@@ -112,6 +137,9 @@ func NewProcess(id string, healthCheckTimeout int, config *config.ModelConfig, p
 		// stop timeout
 		gracefulStopTimeout: 10 * time.Second,
 		cmdWaitChan:         make(chan struct{}),
+
+		// max time to wait for in-flight requests before stopping an unhealthy process
+		unhealthyDrainTimeout: 30 * time.Second,
 	}
 }
 
@@ -120,6 +148,11 @@ func (p *Process) LogMonitor() *LogMonitor {
 	return p.processLogger
 }
 
+// LoadProgress returns the startup stage parsed from the upstream output.
+func (p *Process) LoadProgress() LoadProgress {
+	return p.loadProgress.Progress()
+}
+
 // setLastRequestHandled sets the last request handled time in a thread-safe manner.
 func (p *Process) setLastRequestHandled(t time.Time) {
 	p.lastRequestHandledMutex.Lock()
@@ -177,6 +210,8 @@ func isValidTransition(from, to ProcessState) bool {
 	case StateStarting:
 		return to == StateReady || to == StateStopping || to == StateStopped
 	case StateReady:
+		return to == StateStopping || to == StateUnhealthy
+	case StateUnhealthy:
 		return to == StateStopping
 	case StateStopping:
 		return to == StateStopped || to == StateShutdown
@@ -205,13 +240,26 @@ func (p *Process) forceState(newState ProcessState) {
 // it is a private method because starting is automatic but stopping can be called
 // at any time.
 func (p *Process) start() error {
+	return p.startTraced(context.Background())
+}
+
+// startTraced is start() recording its spans in the trace of ctx, if any.
+func (p *Process) startTraced(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "process start", spanKindInternal)
+	span.setAttr("goinfer.model", p.ID)
+	defer func() { span.finish(err) }()
+
 	if p.config.Proxy == "" {
 		return errors.New("can not start(), upstream proxy missing")
 	}
 
-	args, err := p.config.SanitizedCommand()
-	if err != nil {
-		return fmt.Errorf("unable to get sanitized command: %w", err)
+	var args []string
+	if !p.config.IsExternal() {
+		var err error
+		args, err = p.config.SanitizedCommand()
+		if err != nil {
+			return fmt.Errorf("unable to get sanitized command: %w", err)
+		}
 	}
 
 	if curState, err := p.swapState(StateStopped, StateStarting); err != nil {
@@ -235,11 +283,153 @@ func (p *Process) start() error {
 
 	// waitStarting.Add(1) is now called atomically in swapState() when transitioning to StateStarting
 	defer p.waitStarting.Done()
+	defer func() {
+		if err != nil {
+			p.logStartFailure(err)
+		}
+	}()
+	startTime := time.Now()
 	cmdContext, ctxCancelUpstream := context.WithCancel(context.Background())
 
+	if p.config.IsExternal() {
+		if err := p.adoptEndpoint(ctx, cmdContext, ctxCancelUpstream); err != nil {
+			return err
+		}
+	} else if err := p.startCommand(ctx, cmdContext, ctxCancelUpstream, args); err != nil {
+		return err
+	}
+
+	checkStartTime := time.Now()
+	maxDuration := time.Second * time.Duration(p.healthCheckTimeout)
+	if p.config.StartupTimeout > 0 {
+		// startup may be much longer than a runtime check: -hf downloads, huge models...
+		maxDuration = time.Second * time.Duration(p.config.StartupTimeout)
+	}
+	checkEndpoint := strings.TrimSpace(p.config.CheckEndpoint)
+
+	var healthURL string
+	// a "none" means don't check for health ... I could have picked a better word :facepalm:
+	if checkEndpoint != "none" {
+		proxyTo := p.config.Proxy
+		healthURL, err = url.JoinPath(proxyTo, checkEndpoint)
+		if err != nil {
+			return fmt.Errorf("failed to create health check URL proxy=%s and checkEndpoint=%s", proxyTo, checkEndpoint)
+		}
+
+		err = p.waitHealthy(ctx, healthURL, checkStartTime, maxDuration)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the conversations find their prompt cache again
+	if p.slots != nil {
+		p.slots.restore(ctx, p.config.Proxy)
+	}
+
+	if p.config.UnloadAfter > 0 {
+		// start a goroutine to check every second if
+		// the process should be stopped
+		go func() {
+			maxDuration := time.Duration(p.config.UnloadAfter) * time.Second
+
+			for range time.Tick(time.Second) {
+				if p.CurrentState() != StateReady {
+					return
+				}
+
+				// skip the TTL check if there are inflight requests
+				if p.inFlightRequestsCount.Load() != 0 {
+					continue
+				}
+
+				if time.Since(p.getLastRequestHandled()) > maxDuration {
+					p.proxyLogger.Infof("<%s> Unloading model, TTL of %ds reached", p.ID, p.config.UnloadAfter)
+					p.Stop()
+					return
+				}
+			}
+		}()
+	}
+
+	if curState, err := p.swapState(StateStarting, StateReady); err != nil {
+		return fmt.Errorf("failed to set Process state to ready: current state: %v, error: %w", curState, err)
+	}
+
+	p.failedStartCount = 0
+	p.loadDuration.observe(time.Since(startTime).Seconds())
+
+	if healthURL != "" && p.config.HealthCheck.Interval > 0 {
+		p.cmdMutex.RLock()
+		exited := p.cmdWaitChan
+		p.cmdMutex.RUnlock()
+		go p.monitorLiveness(healthURL, exited)
+	}
+
+	return nil
+}
+
+// logStartFailure keeps the output of a failed start in its own log segment,
+// see /api/logfiles/<model>?segment=last-failed.
+func (p *Process) logStartFailure(err error) {
+	lf := p.processLogger.file
+	if lf == nil {
+		return
+	}
+	p.processLogger.Errorf("<%s> start failed: %v", p.ID, err)
+	if err := lf.markFailed(); err != nil {
+		p.proxyLogger.Warnf("<%s> cannot keep the log of the failed start: %v", p.ID, err)
+	}
+}
+
+// waitHealthy is the ready check loop of start().
+func (p *Process) waitHealthy(ctx context.Context, healthURL string, checkStartTime time.Time, maxDuration time.Duration) (err error) {
+	_, span := startSpan(ctx, "health check", spanKindClient)
+	span.setAttr("url.full", healthURL)
+	defer func() { span.finish(err) }()
+
+	for {
+		currentState := p.CurrentState()
+		if currentState != StateStarting {
+			if currentState == StateStopped {
+				return errors.New("upstream command exited prematurely but successfully")
+			}
+			return errors.New("health check interrupted due to shutdown")
+		}
+
+		if time.Since(checkStartTime) > maxDuration {
+			p.stopCommand()
+			return fmt.Errorf("health check timed out after %vs", maxDuration.Seconds())
+		}
+
+		// give a long time to respond to the health check endpoint
+		// after the connection is established. See issue: 276
+		err := p.checkHealthEndpoint(healthURL, 5*time.Second)
+		if err == nil {
+			p.proxyLogger.ForRequest(ctx).Infof("<%s> Health check passed on %s", p.ID, healthURL)
+			return nil
+		} else {
+			if strings.Contains(err.Error(), "connection refused") {
+				ttl := time.Until(checkStartTime.Add(maxDuration))
+				p.proxyLogger.ForRequest(ctx).Debugf("<%s> Connection refused on %s, giving up in %.0fs (normal during startup)", p.ID, healthURL, ttl.Seconds())
+			} else {
+				p.proxyLogger.ForRequest(ctx).Debugf("<%s> Health check error on %s, %v (normal during startup)", p.ID, healthURL, err)
+			}
+		}
+		<-time.After(p.healthCheckLoopInterval)
+	}
+}
+
+// startCommand runs the upstream command, the Process state is StateStarting.
+// ctx is the request triggering the start, if any, for the log lines.
+func (p *Process) startCommand(ctx context.Context, cmdContext context.Context, ctxCancelUpstream context.CancelFunc, args []string) error {
+	// parse the startup output (download, tensors, warmup...) into load progress events
+	p.loadProgress.Reset()
+	output := io.MultiWriter(p.processLogger.LineWriter(p.ID), p.loadProgress)
+
 	p.cmd = exec.CommandContext(cmdContext, args[0], args[1:]...)
-	p.cmd.Stdout = p.processLogger
-	p.cmd.Stderr = p.processLogger
+	p.cmd.Stdout = output
+	p.cmd.Stderr = output
 	p.cmd.Env = append(p.cmd.Environ(), p.config.Env...)
 	p.cmd.Cancel = p.cmdStopUpstreamProcess
 	p.cmd.WaitDelay = p.gracefulStopTimeout
@@ -252,14 +442,14 @@ func (p *Process) start() error {
 
 	p.failedStartCount++ // this will be reset to zero when the process has successfully started
 
-	p.proxyLogger.Infof("<%s> ------------ START COMMAND -------------", p.ID)
-	p.proxyLogger.Debugf("<%s> ENV: %v", p.ID, p.cmd.Environ())
+	p.proxyLogger.ForRequest(ctx).Infof("<%s> ------------ START COMMAND -------------", p.ID)
+	p.proxyLogger.ForRequest(ctx).Debugf("<%s> ENV: %v", p.ID, p.cmd.Environ())
 	if len(p.config.Env) > 0 {
-		p.proxyLogger.Infof("<%s> ENV: %v", p.ID, p.config.Env)
+		p.proxyLogger.ForRequest(ctx).Infof("<%s> ENV: %v", p.ID, p.config.Env)
 	}
-	p.proxyLogger.Infof("<%s> CMD: %v", p.ID, args)
-	p.proxyLogger.Infof("<%s> ----------------------------------------", p.ID)
-	err = p.cmd.Start()
+	p.proxyLogger.ForRequest(ctx).Infof("<%s> CMD: %v", p.ID, args)
+	p.proxyLogger.ForRequest(ctx).Infof("<%s> ----------------------------------------", p.ID)
+	err := p.cmd.Start()
 	// Set process state to failed
 	if err != nil {
 		if curState, swapErr := p.swapState(StateStarting, StateStopped); swapErr != nil {
@@ -282,81 +472,163 @@ func (p *Process) start() error {
 	//
 	// only in the third case will the process be considered Ready to accept
 	<-time.After(250 * time.Millisecond) // give process a bit of time to start
+	return nil
+}
 
-	checkStartTime := time.Now()
-	maxDuration := time.Second * time.Duration(p.healthCheckTimeout)
-	checkEndpoint := strings.TrimSpace(p.config.CheckEndpoint)
+// adoptEndpoint uses an already running server instead of starting a command.
+// The optional on_load hook is called first. Stopping the Process only cancels
+// cmdContext: the on_unload hook is called but the server keeps running.
+func (p *Process) adoptEndpoint(ctx context.Context, cmdContext context.Context, ctxCancelUpstream context.CancelFunc) error {
+	p.proxyLogger.ForRequest(ctx).Infof("<%s> ------------ ADOPT ENDPOINT -------------", p.ID)
+	p.proxyLogger.ForRequest(ctx).Infof("<%s> PROXY: %s (no cmd, never stopped)", p.ID, p.config.Proxy)
 
-	// a "none" means don't check for health ... I could have picked a better word :facepalm:
-	if checkEndpoint != "none" {
-		proxyTo := p.config.Proxy
-		healthURL, err := url.JoinPath(proxyTo, checkEndpoint)
-		if err != nil {
-			return fmt.Errorf("failed to create health check URL proxy=%s and checkEndpoint=%s", proxyTo, checkEndpoint)
+	p.failedStartCount++ // this will be reset to zero when the process has successfully started
+
+	onLoad := p.config.Hooks.OnLoad
+	if p.config.Router != "" {
+		// the router may have loaded the model by itself (load-on-startup, autoload)
+		if status, err := p.routerModelStatus(5 * time.Second); err == nil && (status == "loaded" || status == "loading") {
+			p.proxyLogger.ForRequest(ctx).Infof("<%s> Model already %s by the router %s", p.ID, status, p.config.Router)
+			onLoad = config.EndpointHook{}
 		}
+	}
 
-		// Ready Check loop
-		for {
-			currentState := p.CurrentState()
-			if currentState != StateStarting {
-				if currentState == StateStopped {
-					return errors.New("upstream command exited prematurely but successfully")
-				}
-				return errors.New("health check interrupted due to shutdown")
-			}
+	if err := p.callHook(onLoad); err != nil {
+		ctxCancelUpstream()
+		if curState, swapErr := p.swapState(StateStarting, StateStopped); swapErr != nil {
+			p.forceState(StateStopped)
+			return fmt.Errorf("on_load hook failed and state swap failed. hook error: %w, current state: %v, state swap error: %w", err, curState, swapErr)
+		}
+		return fmt.Errorf("on_load hook failed: %w", err)
+	}
 
-			if time.Since(checkStartTime) > maxDuration {
-				p.stopCommand()
-				return fmt.Errorf("health check timed out after %vs", maxDuration.Seconds())
-			}
+	p.cmdMutex.Lock()
+	p.cancelUpstream = ctxCancelUpstream
+	p.cmdWaitChan = make(chan struct{})
+	p.cmdMutex.Unlock()
 
-			err := p.checkHealthEndpoint(healthURL)
-			if err == nil {
-				p.proxyLogger.Infof("<%s> Health check passed on %s", p.ID, healthURL)
-				break
-			} else {
-				if strings.Contains(err.Error(), "connection refused") {
-					ttl := time.Until(checkStartTime.Add(maxDuration))
-					p.proxyLogger.Debugf("<%s> Connection refused on %s, giving up in %.0fs (normal during startup)", p.ID, healthURL, ttl.Seconds())
-				} else {
-					p.proxyLogger.Debugf("<%s> Health check error on %s, %v (normal during startup)", p.ID, healthURL, err)
-				}
-			}
-			<-time.After(p.healthCheckLoopInterval)
+	go func() {
+		<-cmdContext.Done()
+		if err := p.callHook(p.config.Hooks.OnUnload); err != nil {
+			p.proxyLogger.Errorf("<%s> on_unload hook failed: %v", p.ID, err)
 		}
+		p.cmdExited()
+	}()
+
+	return nil
+}
+
+// callHook sends the hook request to the proxy URL, does nothing when the hook has no path.
+func (p *Process) callHook(hook config.EndpointHook) error {
+	if hook.Path == "" {
+		return nil
 	}
 
-	if p.config.UnloadAfter > 0 {
-		// start a goroutine to check every second if
-		// the process should be stopped
-		go func() {
-			maxDuration := time.Duration(p.config.UnloadAfter) * time.Second
+	hookURL, err := url.JoinPath(p.config.Proxy, hook.Path)
+	if err != nil {
+		return fmt.Errorf("failed to create hook URL proxy=%s and path=%s", p.config.Proxy, hook.Path)
+	}
 
-			for range time.Tick(time.Second) {
-				if p.CurrentState() != StateReady {
-					return
-				}
+	method := hook.Method
+	if method == "" {
+		method = http.MethodPost
+	}
 
-				// skip the TTL check if there are inflight requests
-				if p.inFlightRequestsCount.Load() != 0 {
-					continue
-				}
+	req, err := http.NewRequest(method, hookURL, strings.NewReader(hook.Body))
+	if err != nil {
+		return err
+	}
+	if hook.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
-				if time.Since(p.getLastRequestHandled()) > maxDuration {
-					p.proxyLogger.Infof("<%s> Unloading model, TTL of %ds reached", p.ID, p.config.UnloadAfter)
-					p.Stop()
-					return
-				}
+	// loading a model may take a while
+	client := &http.Client{Timeout: hookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s status code: %d", method, hookURL, resp.StatusCode)
+	}
+	p.proxyLogger.Debugf("<%s> hook %s %s: %d", p.ID, method, hookURL, resp.StatusCode)
+	return nil
+}
+
+// monitorLiveness periodically probes the health endpoint while the process is Ready.
+// After too many consecutive failures, the process is marked unhealthy, drained and stopped.
+// The exited channel stops the goroutine when this command instance exits.
+func (p *Process) monitorLiveness(healthURL string, exited <-chan struct{}) {
+	hc := p.config.HealthCheck
+	ticker := time.NewTicker(time.Duration(hc.Interval) * time.Second)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-exited:
+			return
+		case <-ticker.C:
+		}
+
+		if p.CurrentState() != StateReady {
+			return
+		}
+
+		err := p.checkHealthEndpoint(healthURL, hc.ProbeTimeout())
+		if err == nil {
+			if failures > 0 {
+				p.proxyLogger.Infof("<%s> Liveness probe recovered on %s", p.ID, healthURL)
 			}
-		}()
+			failures = 0
+			continue
+		}
+
+		if errors.Is(err, errRouterModelUnloaded) {
+			// evicted by the router (e.g. --models-max), not a failure
+			p.proxyLogger.Infof("<%s> Model unloaded by the router %s", p.ID, p.config.Router)
+			p.Stop()
+			return
+		}
+
+		failures++
+		p.proxyLogger.Warnf("<%s> Liveness probe failed (%d/%d) on %s: %v", p.ID, failures, hc.Threshold(), healthURL, err)
+		if failures >= hc.Threshold() {
+			p.stopUnhealthy()
+			return
+		}
 	}
+}
 
-	if curState, err := p.swapState(StateStarting, StateReady); err != nil {
-		return fmt.Errorf("failed to set Process state to ready: current state: %v, error: %w", curState, err)
-	} else {
-		p.failedStartCount = 0
-		return nil
+// stopUnhealthy marks the process as unhealthy so no new request is accepted,
+// waits for the in-flight requests (up to unhealthyDrainTimeout) and stops the
+// upstream command. It is not started here but by the next request, through its
+// process group: the group may have swapped to another model meanwhile.
+func (p *Process) stopUnhealthy() {
+	if _, err := p.swapState(StateReady, StateUnhealthy); err != nil {
+		return // stopped meanwhile
 	}
+	p.proxyLogger.Errorf("<%s> Process is unhealthy, stopping it after %d in-flight requests (restarted by the next request)", p.ID, p.inFlightRequestsCount.Load())
+
+	drained := make(chan struct{})
+	go func() {
+		p.inFlightRequests.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(p.unhealthyDrainTimeout):
+		p.proxyLogger.Warnf("<%s> %d in-flight requests still pending after %v, stopping anyway", p.ID, p.inFlightRequestsCount.Load(), p.unhealthyDrainTimeout)
+	}
+
+	if _, err := p.swapState(StateUnhealthy, StateStopping); err != nil {
+		return // already stopped by someone else (swap, unload, shutdown)
+	}
+	p.stopCommand()
+	p.proxyLogger.Infof("<%s> Unhealthy process stopped, the next request starts it again", p.ID)
 }
 
 // Stop will wait for inflight requests to complete before stopping the process.
@@ -379,11 +651,20 @@ func (p *Process) StopImmediately() {
 	}
 
 	p.proxyLogger.Debugf("<%s> Stopping process, current state: %s", p.ID, p.CurrentState())
-	if curState, err := p.swapState(StateReady, StateStopping); err != nil {
+	expectedState := StateReady
+	if p.CurrentState() == StateUnhealthy {
+		expectedState = StateUnhealthy
+	}
+	if curState, err := p.swapState(expectedState, StateStopping); err != nil {
 		p.proxyLogger.Infof("<%s> Stop() Ready -> StateStopping err: %v, current state: %v", p.ID, err, curState)
 		return
 	}
 
+	// an unhealthy server may not answer
+	if p.slots != nil && expectedState == StateReady {
+		p.slots.save(context.Background(), p.config.Proxy)
+	}
+
 	p.stopCommand()
 }
 
@@ -396,6 +677,11 @@ func (p *Process) Shutdown() {
 		return
 	}
 
+	// restored by the next Goinfer
+	if p.slots != nil && p.CurrentState() == StateReady {
+		p.slots.save(context.Background(), p.config.Proxy)
+	}
+
 	p.stopCommand()
 	// just force it to this state since there is no recovery from shutdown
 	p.forceState(StateShutdown)
@@ -426,7 +712,22 @@ func (p *Process) stopCommand() {
 	<-cmdWaitChan
 }
 
-func (p *Process) checkHealthEndpoint(healthURL string) error {
+func (p *Process) checkHealthEndpoint(healthURL string, timeout time.Duration) error {
+	if p.config.Router != "" {
+		// the router is healthy but the model may not be loaded
+		status, err := p.routerModelStatus(timeout)
+		switch {
+		case err != nil:
+			return err
+		case status == "loaded":
+			return nil
+		case status == "unloaded":
+			return errRouterModelUnloaded
+		default:
+			return fmt.Errorf("router model status: %q", status)
+		}
+	}
+
 	client := &http.Client{
 		// wait a short time for a tcp connection to be established
 		Transport: &http.Transport{
@@ -434,11 +735,10 @@ func (p *Process) checkHealthEndpoint(healthURL string) error {
 				Timeout: 500 * time.Millisecond,
 			}).DialContext,
 		},
-
-		// give a long time to respond to the health check endpoint
-		// after the connection is established. See issue: 276
-		Timeout: 5000 * time.Millisecond,
+		Timeout: timeout,
 	}
+	// probes run periodically, do not keep a pool of idle connections per call
+	defer client.CloseIdleConnections()
 
 	req, err := http.NewRequest(http.MethodGet, healthURL, http.NoBody)
 	if err != nil {
@@ -459,18 +759,55 @@ func (p *Process) checkHealthEndpoint(healthURL string) error {
 	return nil
 }
 
+// routerModelStatus returns the status of the model (loaded, loading, unloaded...)
+// reported by the GET /models endpoint of the llama-server router.
+func (p *Process) routerModelStatus(timeout time.Duration) (string, error) {
+	modelsURL, err := url.JoinPath(p.config.Proxy, "/models")
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(modelsURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return "", err
+	}
+
+	for _, model := range gjson.GetBytes(body, "data").Array() {
+		if model.Get("id").String() == p.config.UseModelName {
+			return model.Get("status.value").String(), nil
+		}
+	}
+	return "", fmt.Errorf("model %s not found in the router %s", p.config.UseModelName, p.config.Router)
+}
+
 func (p *Process) ProxyRequest(w http.ResponseWriter, r *http.Request) {
 	if p.reverseProxy == nil {
 		http.Error(w, "No reverse proxy available for "+p.ID, http.StatusInternalServerError)
 		return
 	}
 
+	log := p.proxyLogger.ForRequest(r.Context())
 	requestBeginTime := time.Now()
 	var startDuration time.Duration
+	timings := requestTimingsFrom(r)
+	timings.markQueued()
 
 	// prevent new requests from being made while stopping or irrecoverable
 	currentState := p.CurrentState()
-	if currentState == StateShutdown || currentState == StateStopping {
+	if currentState == StateShutdown || currentState == StateStopping || currentState == StateUnhealthy {
 		http.Error(w, fmt.Sprintf("Process can not ProxyRequest, state is %s", currentState), http.StatusServiceUnavailable)
 		return
 	}
@@ -502,17 +839,19 @@ func (p *Process) ProxyRequest(w http.ResponseWriter, r *http.Request) {
 
 		isStreaming, _ := r.Context().Value(proxyCtxKey("streaming")).(bool)
 
-		// PR #417 (no support for anthropic v1/messages yet)
-		isChatCompletions := strings.HasPrefix(r.URL.Path, "/v1/chat/completions")
-		if p.config.SendLoadingState != nil && *p.config.SendLoadingState && isStreaming && isChatCompletions {
-			srw = newStatusResponseWriter(p, w)
+		// PR #417: the loading state is sent using the streaming format of the endpoint
+		format, hasFormat := loadingFormatFor(r.URL.Path)
+		if p.config.SendLoadingState != nil && *p.config.SendLoadingState && isStreaming && hasFormat {
+			srw = newStatusResponseWriter(p, w, format)
 			go srw.statusUpdates(swapCtx)
 		} else {
-			p.proxyLogger.Debugf("<%s> SendLoadingState is nil or false, not streaming loading state", p.ID)
+			log.Debugf("<%s> SendLoadingState is nil or false, not streaming loading state", p.ID)
 		}
 
 		beginStartTime := time.Now()
-		err := p.start()
+		p.queuedRequestsCount.Add(1)
+		err := p.startTraced(r.Context())
+		p.queuedRequestsCount.Add(-1)
 		if err != nil {
 			errstr := fmt.Sprintf("unable to start process: %s", err)
 			cancelLoadCtx()
@@ -528,37 +867,54 @@ func (p *Process) ProxyRequest(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		startDuration = time.Since(beginStartTime)
+		p.swapDuration.observe(startDuration.Seconds())
 	}
 
 	// should trigger srw to stop sending loading events ...
 	cancelLoadCtx()
 
+	// the upstream call, llama-server continues the trace
+	ctx, span := startSpan(r.Context(), "upstream "+p.ID, spanKindClient)
+	span.setAttr("server.address", p.config.Proxy)
+	defer span.finish(nil)
+	injectTraceparent(ctx, r.Header)
+	r = r.WithContext(ctx)
+
 	// recover from http.ErrAbortHandler panics that can occur when the client
 	// disconnects before the response is sent
 	defer func() {
 		if r := recover(); r != nil {
 			err, ok := r.(error)
 			if ok && errors.Is(http.ErrAbortHandler, err) {
-				p.proxyLogger.Infof("<%s> recovered from client disconnection during streaming", p.ID)
+				log.Infof("<%s> recovered from client disconnection during streaming", p.ID)
 			} else {
-				p.proxyLogger.Infof("<%s> recovered from panic: %v", p.ID, r)
+				log.Infof("<%s> recovered from panic: %v", p.ID, r)
 			}
 		}
 	}()
 
+	// marks the beginning of the llama-server output of this request in the upstream logs
+	p.processLogger.ForRequest(r.Context()).Infof("<%s> %s %s", p.ID, r.Method, r.URL.Path)
+
 	if srw != nil {
 		// Wait for the goroutine to finish writing its final messages
 		const completionTimeout = 1 * time.Second
 		if !srw.waitForCompletion(completionTimeout) {
-			p.proxyLogger.Warnf("<%s> status updates goroutine did not complete within %v, proceeding with proxy request", p.ID, completionTimeout)
+			log.Warnf("<%s> status updates goroutine did not complete within %v, proceeding with proxy request", p.ID, completionTimeout)
 		}
+		// the loading state is not part of the cached response
+		if loading, ok := r.Context().Value(proxyCtxKey("loadingBytes")).(*atomic.Int64); ok {
+			loading.Store(srw.sent.Load())
+		}
+		timings.markReady()
 		p.reverseProxy.ServeHTTP(srw, r)
 	} else {
+		timings.markReady()
 		p.reverseProxy.ServeHTTP(w, r)
 	}
 
 	totalTime := time.Since(requestBeginTime)
-	p.proxyLogger.Debugf("<%s> request %s - start: %v, total: %v",
+	log.Debugf("<%s> request %s - start: %v, total: %v",
 		p.ID, r.RequestURI, startDuration, totalTime)
 }
 
@@ -589,6 +945,16 @@ func (p *Process) waitForCmd() {
 		}
 	}
 
+	p.cmdExited()
+}
+
+// cmdExited updates the state once the upstream command (or adopted endpoint) is gone
+// and signals it to stopCommand.
+func (p *Process) cmdExited() {
+	if p.slots != nil {
+		p.slots.unload()
+	}
+
 	currentState := p.CurrentState()
 	switch currentState {
 	case StateStopping:
@@ -715,19 +1081,49 @@ var loadingRemarks = []string{
 	"The model is reading its own documentation...",
 }
 
+// loadingFormat is the streaming event format used to send the loading state.
+type loadingFormat int
+
+const (
+	loadingFormatChat        loadingFormat = iota // OpenAI chat completion chunks (reasoning_content)
+	loadingFormatCompletions                      // legacy OpenAI completion chunks (text)
+	loadingFormatAnthropic                        // Anthropic ping events
+	loadingFormatResponses                        // SSE comments (keep-alive) for the OpenAI Responses API
+)
+
+// loadingFormatFor returns the loading state format of the endpoint,
+// false if the endpoint does not support streaming the loading state.
+func loadingFormatFor(path string) (loadingFormat, bool) {
+	switch {
+	case strings.HasPrefix(path, "/v1/chat/completions"):
+		return loadingFormatChat, true
+	case strings.HasPrefix(path, "/v1/completions"):
+		return loadingFormatCompletions, true
+	case strings.HasPrefix(path, "/v1/messages"):
+		return loadingFormatAnthropic, true
+	case strings.HasPrefix(path, "/v1/responses"):
+		return loadingFormatResponses, true
+	default:
+		return 0, false
+	}
+}
+
 type statusResponseWriter struct {
 	start      time.Time
 	writer     http.ResponseWriter
 	process    *Process
 	wg         sync.WaitGroup
+	format     loadingFormat
+	sent       atomic.Int64 // bytes of the loading state, before the upstream response
 	hasWritten bool
 }
 
-func newStatusResponseWriter(p *Process, w http.ResponseWriter) *statusResponseWriter {
+func newStatusResponseWriter(p *Process, w http.ResponseWriter, format loadingFormat) *statusResponseWriter {
 	s := &statusResponseWriter{
 		writer:  w,
 		process: p,
 		start:   time.Now(),
+		format:  format,
 	}
 
 	s.Header().Set("Content-Type", "text/event-stream") // SSE
@@ -770,6 +1166,7 @@ func (s *statusResponseWriter) statusUpdates(ctx context.Context) {
 	// Pick a random duration to send a remark
 	nextRemarkIn := time.Duration(2+rand.Intn(4)) * time.Second
 	lastRemarkTime := time.Now()
+	var lastProgress LoadProgress
 
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop() // Ensure ticker is stopped to prevent resource leak
@@ -782,6 +1179,14 @@ func (s *statusResponseWriter) statusUpdates(ctx context.Context) {
 				return
 			}
 
+			// the real progress parsed from the upstream output takes precedence over remarks
+			if progress := s.process.LoadProgress(); progress.Stage != "" && progress != lastProgress {
+				lastProgress = progress
+				s.sendLine("\n" + progress.String())
+				lastRemarkTime = time.Now()
+				continue
+			}
+
 			// Check if it's time for a snarky remark
 			if time.Since(lastRemarkTime) >= nextRemarkIn {
 				remark := remarks[ri%len(remarks)]
@@ -818,39 +1223,47 @@ func (s *statusResponseWriter) sendLine(line string) {
 }
 
 func (s *statusResponseWriter) sendData(data string) {
-	// Create the proper SSE JSON structure
-	type Delta struct {
-		ReasoningContent string `json:"reasoning_content"`
-	}
-	type Choice struct {
-		Delta Delta `json:"delta"`
-	}
-	type SSEMessage struct {
-		Choices []Choice `json:"choices"`
+	// Write SSE formatted data, panic if not able to write
+	n, err := io.WriteString(s.writer, s.sseEvent(data))
+	if err != nil {
+		panic(fmt.Sprintf("<%s> Failed to write SSE data: %v", s.process.ID, err))
 	}
+	s.sent.Add(int64(n))
+	s.Flush()
+}
 
-	msg := SSEMessage{
-		Choices: []Choice{
-			{
-				Delta: Delta{
-					ReasoningContent: data,
-				},
-			},
-		},
+// sseEvent returns the SSE event carrying data in the native streaming format of the endpoint.
+// The Anthropic and Responses streams must begin with their start events (message_start,
+// response.created), sent by the upstream: the loading state only keeps these streams alive.
+func (s *statusResponseWriter) sseEvent(data string) string {
+	var msg any
+	switch s.format {
+	case loadingFormatCompletions:
+		msg = map[string]any{
+			"object":  "text_completion",
+			"choices": []any{map[string]any{"index": 0, "text": data, "finish_reason": nil}},
+		}
+	case loadingFormatAnthropic:
+		return "event: ping\ndata: {\"type\":\"ping\"}\n\n"
+	case loadingFormatResponses:
+		// SSE comments, ignored by the clients
+		var b strings.Builder
+		for line := range strings.SplitSeq(strings.TrimRight(data, "\n"), "\n") {
+			b.WriteString(": " + line + "\n")
+		}
+		return b.String() + "\n"
+	default:
+		msg = map[string]any{
+			"choices": []any{map[string]any{"delta": map[string]any{"reasoning_content": data}}},
+		}
 	}
 
 	jsonData, err := json.Marshal(msg)
 	if err != nil {
 		s.process.proxyLogger.Errorf("<%s> Failed to marshal SSE message: %v", s.process.ID, err)
-		return
-	}
-
-	// Write SSE formatted data, panic if not able to write
-	_, err = fmt.Fprintf(s.writer, "data: %s\n\n", jsonData)
-	if err != nil {
-		panic(fmt.Sprintf("<%s> Failed to write SSE data: %v", s.process.ID, err))
+		return ""
 	}
-	s.Flush()
+	return "data: " + string(jsonData) + "\n\n"
 }
 
 func (s *statusResponseWriter) Header() http.Header {
@@ -0,0 +1,69 @@
+//go:build !windows
+
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lynxai-team/goinfer/event"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// A wedged upstream (SIGSTOP) must fail the liveness probes,
+// then the process is marked unhealthy and stopped, the next request restarts it.
+func TestProcess_LivenessProbeRestartsWedgedProcess(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping slow liveness probe test")
+	}
+
+	cfg := getTestSimpleResponderConfig("liveness")
+	cfg.HealthCheck = config.ModelHealthCheck{Interval: 1, Timeout: 1, FailureThreshold: 2}
+
+	process := NewProcess("liveness", 5, cfg, debugLogger, debugLogger)
+	process.gracefulStopTimeout = time.Second
+	process.unhealthyDrainTimeout = time.Second
+	defer process.Stop()
+
+	sawUnhealthy := make(chan struct{})
+	var once sync.Once
+	defer event.On(func(e ProcessStateChangeEvent) {
+		if e.ProcessName == "liveness" && e.NewState == StateUnhealthy {
+			once.Do(func() { close(sawUnhealthy) })
+		}
+	})()
+
+	assert.NoError(t, process.start())
+	firstPid := process.cmd.Process.Pid
+
+	// wedge the upstream: the TCP port stays open but nothing answers
+	assert.NoError(t, process.cmd.Process.Signal(syscall.SIGSTOP))
+
+	select {
+	case <-sawUnhealthy:
+	case <-time.After(10 * time.Second):
+		t.Fatal("process was not marked unhealthy")
+	}
+
+	assert.Eventually(t, func() bool {
+		return process.CurrentState() == StateStopped
+	}, 15*time.Second, 100*time.Millisecond, "process was not stopped")
+
+	// restarted by the next request
+	req := httptest.NewRequest(http.MethodGet, "/test", http.NoBody)
+	w := httptest.NewRecorder()
+	process.ProxyRequest(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "liveness")
+	assert.Equal(t, StateReady, process.CurrentState())
+	assert.NotEqual(t, firstPid, process.cmd.Process.Pid)
+}
@@ -5,11 +5,14 @@
 package proxy
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -111,6 +114,155 @@ func TestProcess_BrokenModelConfig(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "start() failed for command 'nonexistent-command':")
 }
 
+// an external model (no cmd) uses an already running server, calls its hooks and never stops it.
+func TestProcess_ExternalEndpoint(t *testing.T) {
+	var mu sync.Mutex
+	var hooks []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+		case "/missing":
+			http.NotFound(w, r)
+		case "/models/load", "/models/unload":
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			hooks = append(hooks, r.Method+" "+r.URL.Path+" "+string(body))
+			mu.Unlock()
+		default:
+			fmt.Fprint(w, "external says hi")
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.ModelConfig{
+		Proxy:         server.URL,
+		CheckEndpoint: "/health",
+		Hooks: config.ModelHooks{
+			OnLoad:   config.EndpointHook{Path: "/models/load", Body: `{"model":"m"}`},
+			OnUnload: config.EndpointHook{Path: "/models/unload", Body: `{"model":"m"}`},
+		},
+	}
+	process := NewProcess("external", 5, cfg, debugLogger, debugLogger)
+
+	w := httptest.NewRecorder()
+	process.ProxyRequest(w, httptest.NewRequest(http.MethodGet, "/test", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "external says hi", w.Body.String())
+	assert.Equal(t, StateReady, process.CurrentState())
+
+	process.Stop()
+	assert.Equal(t, StateStopped, process.CurrentState())
+
+	mu.Lock()
+	assert.Equal(t, []string{`POST /models/load {"model":"m"}`, `POST /models/unload {"model":"m"}`}, hooks)
+	mu.Unlock()
+
+	// the server is still running
+	resp, err := http.Get(server.URL + "/test")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// a failing on_load hook aborts the start
+	cfg.Hooks.OnLoad.Path = "/missing"
+	w = httptest.NewRecorder()
+	process.ProxyRequest(w, httptest.NewRequest(http.MethodGet, "/test", http.NoBody))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "on_load hook failed")
+	assert.Equal(t, StateStopped, process.CurrentState())
+}
+
+// fakeRouter mimics the model-management API of llama-server in router mode.
+type fakeRouter struct {
+	status map[string]string
+	loads  int
+	sync.Mutex
+}
+
+func (fr *fakeRouter) setStatus(model, status string) {
+	fr.Lock()
+	defer fr.Unlock()
+	fr.status[model] = status
+}
+
+func (fr *fakeRouter) loadCount() int {
+	fr.Lock()
+	defer fr.Unlock()
+	return fr.loads
+}
+
+func (fr *fakeRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fr.Lock()
+	defer fr.Unlock()
+	switch r.URL.Path {
+	case "/models":
+		data := make([]map[string]any, 0, len(fr.status))
+		for id, status := range fr.status {
+			data = append(data, map[string]any{"id": id, "status": map[string]string{"value": status}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	case "/models/load", "/models/unload":
+		var body struct{ Model string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path == "/models/load" {
+			fr.loads++
+			fr.status[body.Model] = "loaded"
+		} else {
+			fr.status[body.Model] = "unloaded"
+		}
+	default:
+		fmt.Fprint(w, "router says hi")
+	}
+}
+
+func TestProcess_RouterModel(t *testing.T) {
+	router := &fakeRouter{status: map[string]string{"preset1": "unloaded"}}
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	content := `
+models:
+  router:
+    cmd: llama-server --models-preset models.ini
+    proxy: ` + server.URL + `
+  preset1:
+    router: router
+    healthCheck:
+      interval: 1
+groups:
+  routers:
+    persistent: true
+    members: [router]
+`
+	cfg, err := config.LoadConfigFromReader(strings.NewReader(content))
+	assert.NoError(t, err)
+
+	process := NewProcess("preset1", 5, cfg.Models["preset1"], debugLogger, debugLogger)
+	process.healthCheckLoopInterval = 100 * time.Millisecond
+	defer process.Stop()
+
+	w := httptest.NewRecorder()
+	process.ProxyRequest(w, httptest.NewRequest(http.MethodGet, "/test", http.NoBody))
+	assert.Equal(t, "router says hi", w.Body.String())
+	assert.Equal(t, StateReady, process.CurrentState())
+	assert.Equal(t, 1, router.loadCount())
+
+	process.Stop()
+	assert.Equal(t, StateStopped, process.CurrentState())
+	router.setStatus("preset1", "loaded") // loaded by the router itself (autoload)
+
+	process.ProxyRequest(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", http.NoBody))
+	assert.Equal(t, StateReady, process.CurrentState())
+	assert.Equal(t, 1, router.loadCount(), "the load hook is skipped when the preset is already loaded")
+
+	// evicted by the router (--models-max), the liveness probe stops the process
+	router.setStatus("preset1", "unloaded")
+	assert.Eventually(t, func() bool {
+		return process.CurrentState() == StateStopped
+	}, 3*time.Second, 100*time.Millisecond)
+}
+
 func TestProcess_UnloadAfterTTL(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping long auto unload TTL test")
@@ -250,6 +402,9 @@ func TestProcess_SwapState(t *testing.T) {
 		{"Starting to Stopping", StateStarting, StateStarting, StateStopping, nil, StateStopping},
 		{"Starting to Stopped", StateStarting, StateStarting, StateStopped, nil, StateStopped},
 		{"Ready to Stopping", StateReady, StateReady, StateStopping, nil, StateStopping},
+		{"Ready to Unhealthy", StateReady, StateReady, StateUnhealthy, nil, StateUnhealthy},
+		{"Unhealthy to Stopping", StateUnhealthy, StateUnhealthy, StateStopping, nil, StateStopping},
+		{"Unhealthy to Ready", StateUnhealthy, StateUnhealthy, StateReady, ErrInvalidStateTransition, StateUnhealthy},
 		{"Stopping to Stopped", StateStopping, StateStopping, StateStopped, nil, StateStopped},
 		{"Stopping to Shutdown", StateStopping, StateStopping, StateShutdown, nil, StateShutdown},
 		{"Stopped to Ready", StateStopped, StateStopped, StateReady, ErrInvalidStateTransition, StateStopped},
@@ -337,6 +492,26 @@ func TestProcess_ExitInterruptsHealthCheck(t *testing.T) {
 	assert.Equal(t, StateStopped, process.CurrentState())
 }
 
+func TestProcess_StartupTimeoutOverridesHealthCheckTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping slow startup timeout test")
+	}
+
+	// the health check always fails because nothing listens on the proxy port
+	cfg := getTestSimpleResponderConfigPort("startup", getTestPort())
+	cfg.Proxy = fmt.Sprintf("http://127.0.0.1:%d", getTestPort())
+	cfg.StartupTimeout = 1
+
+	process := NewProcess("startup", 60, cfg, debugLogger, debugLogger)
+	process.healthCheckLoopInterval = 100 * time.Millisecond
+
+	begin := time.Now()
+	err := process.start()
+	assert.ErrorContains(t, err, "health check timed out after 1s")
+	assert.Less(t, time.Since(begin), 10*time.Second)
+	assert.Equal(t, StateStopped, process.CurrentState())
+}
+
 func TestProcess_ConcurrencyLimit(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping long concurrency limit test")
@@ -566,3 +741,45 @@ func (w *panicOnWriteResponseWriter) Write(b []byte) (int, error) {
 	}
 	return w.ResponseRecorder.Write(b)
 }
+
+func TestProcess_StatusResponseWriterFormats(t *testing.T) {
+	process := NewProcess("loading", 5, &config.ModelConfig{}, debugLogger, debugLogger)
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/v1/chat/completions", `data: {"choices":[{"delta":{"reasoning_content":"hi"}}]}` + "\n\n"},
+		{"/v1/completions", `data: {"choices":[{"finish_reason":null,"index":0,"text":"hi"}],"object":"text_completion"}` + "\n\n"},
+		{"/v1/messages", "event: ping\ndata: {\"type\":\"ping\"}\n\n"},
+		{"/v1/responses", ": hi\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			format, ok := loadingFormatFor(tt.path)
+			assert.True(t, ok)
+
+			w := httptest.NewRecorder()
+			srw := newStatusResponseWriter(process, w, format)
+			w.Body.Reset() // skip the header lines
+			srw.sendData("hi")
+			assert.Equal(t, tt.expected, w.Body.String())
+			assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		})
+	}
+
+	// no content event before the message_start and response.created of the upstream
+	w := httptest.NewRecorder()
+	srw := newStatusResponseWriter(process, w, loadingFormatAnthropic)
+	srw.sendLine("\nDone! (1.00s)")
+	assert.Equal(t, strings.Repeat("event: ping\ndata: {\"type\":\"ping\"}\n\n", 3), w.Body.String())
+
+	w = httptest.NewRecorder()
+	srw = newStatusResponseWriter(process, w, loadingFormatResponses)
+	w.Body.Reset()
+	srw.sendLine("\nDone! (1.00s)")
+	assert.Equal(t, ": \n: Done! (1.00s)\n\n", w.Body.String())
+
+	_, ok := loadingFormatFor("/v1/embeddings")
+	assert.False(t, ok)
+}
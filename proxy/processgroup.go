@@ -47,6 +47,7 @@ func NewProcessGroup(id string, config *config.Config, proxyLogger, upstreamLogg
 	for _, modelID := range groupConfig.Members {
 		modelConfig, modelID, _ := pg.config.FindConfig(modelID)
 		processLogger := NewLogMonitorWriter(upstreamLogger)
+		processLogger.SetLogFormat(upstreamLogger.LogFormat())
 		process := NewProcess(modelID, pg.config.HealthCheckTimeout, modelConfig, processLogger, pg.proxyLogger)
 		pg.processes[modelID] = process
 	}
@@ -0,0 +1,289 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Prometheus text exposition format, see:
+// https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+
+var (
+	// tokens per second, from a slow CPU generation to a fast GPU prompt processing
+	tpsBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+	// seconds, from a small model already in the page cache to a -hf download
+	durationBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+	processStates = []ProcessState{StateStopped, StateStarting, StateReady, StateUnhealthy, StateStopping, StateShutdown}
+)
+
+// histogram is a Prometheus histogram with fixed buckets.
+type histogram struct {
+	buckets []float64
+	counts  []uint64 // per bucket, not cumulative
+	sum     float64
+	count   uint64
+	mu      sync.Mutex
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// write writes the _bucket, _sum and _count series, labels are already formatted (e.g. `model="x"`).
+func (h *histogram) write(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cumulative uint64
+	for i, le := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", name, labels, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+// prometheusMetrics holds the counters and histograms not owned by a Process:
+// the per-process series (state, in-flight, load durations) are collected at scrape time.
+type prometheusMetrics struct {
+	requests     map[[2]string]uint64  // model, code
+	peerRequests map[[3]string]uint64  // peer, model, code
+	tokens       map[[2]string]uint64  // model, type
+	peerCost     map[[2]string]float64 // peer, model
+	cache        map[[2]string]uint64  // model, result
+	promptTPS    map[string]*histogram
+	generateTPS  map[string]*histogram
+	mu           sync.Mutex
+}
+
+func newPrometheusMetrics() *prometheusMetrics {
+	return &prometheusMetrics{
+		requests:     make(map[[2]string]uint64),
+		peerRequests: make(map[[3]string]uint64),
+		tokens:       make(map[[2]string]uint64),
+		peerCost:     make(map[[2]string]float64),
+		cache:        make(map[[2]string]uint64),
+		promptTPS:    make(map[string]*histogram),
+		generateTPS:  make(map[string]*histogram),
+	}
+}
+
+func (pr *prometheusMetrics) countRequest(modelID string, code int) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.requests[[2]string{modelID, strconv.Itoa(code)}]++
+}
+
+func (pr *prometheusMetrics) countPeerRequest(peerID, modelID string, code int) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.peerRequests[[3]string{peerID, modelID, strconv.Itoa(code)}]++
+}
+
+// countCache counts the response cache lookups, result is hit or miss.
+func (pr *prometheusMetrics) countCache(modelID, result string) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.cache[[2]string{modelID, result}]++
+}
+
+// observeTokenMetrics is called by the metricsMonitor for each request,
+// negative values mean unknown.
+func (pr *prometheusMetrics) observeTokenMetrics(tm TokenMetrics) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	pr.tokens[[2]string{tm.Model, "input"}] += uint64(max(tm.InputTokens, 0))
+	pr.tokens[[2]string{tm.Model, "output"}] += uint64(max(tm.OutputTokens, 0))
+	pr.tokens[[2]string{tm.Model, "cached"}] += uint64(max(tm.CachedTokens, 0))
+	if tm.Peer != "" {
+		pr.peerCost[[2]string{tm.Peer, tm.Model}] += tm.CostUSD
+	}
+
+	if tm.PromptPerSecond > 0 {
+		if pr.promptTPS[tm.Model] == nil {
+			pr.promptTPS[tm.Model] = newHistogram(tpsBuckets)
+		}
+		pr.promptTPS[tm.Model].observe(tm.PromptPerSecond)
+	}
+	if tm.TokensPerSecond > 0 {
+		if pr.generateTPS[tm.Model] == nil {
+			pr.generateTPS[tm.Model] = newHistogram(tpsBuckets)
+		}
+		pr.generateTPS[tm.Model].observe(tm.TokensPerSecond)
+	}
+}
+
+func (pr *prometheusMetrics) write(w io.Writer) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	writeHeader(w, "goinfer_requests_total", "counter", "Requests proxied to a local model by HTTP status code.")
+	for _, k := range slices.SortedFunc(maps.Keys(pr.requests), compareKeys) {
+		fmt.Fprintf(w, "goinfer_requests_total{model=%s,code=%s} %d\n", labelValue(k[0]), labelValue(k[1]), pr.requests[k])
+	}
+
+	writeHeader(w, "goinfer_peer_requests_total", "counter", "Requests proxied to a peer by HTTP status code.")
+	for _, k := range slices.SortedFunc(maps.Keys(pr.peerRequests), comparePeerKeys) {
+		fmt.Fprintf(w, "goinfer_peer_requests_total{peer=%s,model=%s,code=%s} %d\n", labelValue(k[0]), labelValue(k[1]), labelValue(k[2]), pr.peerRequests[k])
+	}
+
+	writeHeader(w, "goinfer_peer_cost_usd_total", "counter", "Spend on the peers (remote providers) in USD.")
+	for _, k := range slices.SortedFunc(maps.Keys(pr.peerCost), compareKeys) {
+		fmt.Fprintf(w, "goinfer_peer_cost_usd_total{peer=%s,model=%s} %g\n", labelValue(k[0]), labelValue(k[1]), pr.peerCost[k])
+	}
+
+	writeHeader(w, "goinfer_response_cache_requests_total", "counter", "Response cache lookups by result: hit, miss.")
+	for _, k := range slices.SortedFunc(maps.Keys(pr.cache), compareKeys) {
+		fmt.Fprintf(w, "goinfer_response_cache_requests_total{model=%s,result=%s} %d\n", labelValue(k[0]), labelValue(k[1]), pr.cache[k])
+	}
+
+	writeHeader(w, "goinfer_tokens_total", "counter", "Tokens processed by type: input, output, cached.")
+	for _, k := range slices.SortedFunc(maps.Keys(pr.tokens), compareKeys) {
+		fmt.Fprintf(w, "goinfer_tokens_total{model=%s,type=%s} %d\n", labelValue(k[0]), labelValue(k[1]), pr.tokens[k])
+	}
+
+	writeHeader(w, "goinfer_prompt_tokens_per_second", "histogram", "Prompt processing speed.")
+	for _, model := range slices.Sorted(maps.Keys(pr.promptTPS)) {
+		pr.promptTPS[model].write(w, "goinfer_prompt_tokens_per_second", "model="+labelValue(model))
+	}
+
+	writeHeader(w, "goinfer_generation_tokens_per_second", "histogram", "Token generation speed.")
+	for _, model := range slices.Sorted(maps.Keys(pr.generateTPS)) {
+		pr.generateTPS[model].write(w, "goinfer_generation_tokens_per_second", "model="+labelValue(model))
+	}
+}
+
+// writeProcesses writes the series collected from the processes at scrape time.
+func writeProcesses(w io.Writer, processes []*Process) {
+	slices.SortFunc(processes, func(a, b *Process) int { return strings.Compare(a.ID, b.ID) })
+
+	writeHeader(w, "goinfer_process_state", "gauge", "Current state of the process (1) by model.")
+	for _, p := range processes {
+		current := p.CurrentState()
+		for _, state := range processStates {
+			value := 0
+			if state == current {
+				value = 1
+			}
+			fmt.Fprintf(w, "goinfer_process_state{model=%s,state=%s} %d\n", labelValue(p.ID), labelValue(string(state)), value)
+		}
+	}
+
+	writeHeader(w, "goinfer_requests_in_flight", "gauge", "Requests being handled by the model, including the queued ones.")
+	for _, p := range processes {
+		fmt.Fprintf(w, "goinfer_requests_in_flight{model=%s} %d\n", labelValue(p.ID), p.inFlightRequestsCount.Load())
+	}
+
+	writeHeader(w, "goinfer_requests_queued", "gauge", "Requests waiting for the model to be ready.")
+	for _, p := range processes {
+		fmt.Fprintf(w, "goinfer_requests_queued{model=%s} %d\n", labelValue(p.ID), p.queuedRequestsCount.Load())
+	}
+
+	writeHeader(w, "goinfer_model_load_duration_seconds", "histogram", "Duration of the process startup until ready.")
+	for _, p := range processes {
+		p.loadDuration.write(w, "goinfer_model_load_duration_seconds", "model="+labelValue(p.ID))
+	}
+
+	writeHeader(w, "goinfer_model_swap_duration_seconds", "histogram", "Duration a request waited for its model to be swapped in.")
+	for _, p := range processes {
+		p.swapDuration.write(w, "goinfer_model_swap_duration_seconds", "model="+labelValue(p.ID))
+	}
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelValue quotes and escapes a label value: backslash, double-quote and line feed.
+func labelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return `"` + v + `"`
+}
+
+func compareKeys(a, b [2]string) int {
+	return slices.Compare(a[:], b[:])
+}
+
+func comparePeerKeys(a, b [3]string) int {
+	return slices.Compare(a[:], b[:])
+}
+
+// countRequests is a middleware counting the proxied requests once handled,
+// the handlers set the model (and peer) in the request context.
+func (pm *ProxyManager) countRequests(c *gin.Context) {
+	c.Next()
+
+	modelID, _ := c.Request.Context().Value(proxyCtxKey("model")).(string)
+	if modelID == "" {
+		return
+	}
+	if peerID, _ := c.Request.Context().Value(proxyCtxKey("peer")).(string); peerID != "" {
+		pm.prometheus.countPeerRequest(peerID, modelID, c.Writer.Status())
+		return
+	}
+	pm.prometheus.countRequest(modelID, c.Writer.Status())
+}
+
+// metricsScrapeAuth protects /metrics with the metricsToken if configured,
+// otherwise with the usual API keys.
+func (pm *ProxyManager) metricsScrapeAuth() gin.HandlerFunc {
+	token := pm.cfg.Swap.MetricsToken
+	if token == "" {
+		return pm.apiKeyAuth()
+	}
+
+	return func(c *gin.Context) {
+		provided, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			pm.sendErrorResponse(c, http.StatusUnauthorized, "unauthorized: invalid or missing metrics token")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func (pm *ProxyManager) prometheusHandler(c *gin.Context) {
+	var processes []*Process
+	for _, processGroup := range pm.processGroups {
+		for _, process := range processGroup.processes {
+			processes = append(processes, process)
+		}
+	}
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := bufio.NewWriter(c.Writer)
+	pm.prometheus.write(w)
+	writeProcesses(w, processes)
+	w.Flush()
+}
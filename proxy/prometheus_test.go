@@ -0,0 +1,102 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheus_Histogram(t *testing.T) {
+	h := newHistogram([]float64{1, 5, 10})
+	for _, v := range []float64{0.5, 1, 3, 7, 20} {
+		h.observe(v)
+	}
+
+	var buf bytes.Buffer
+	h.write(&buf, "test_seconds", `model="m"`)
+	assert.Equal(t, `test_seconds_bucket{model="m",le="1"} 2
+test_seconds_bucket{model="m",le="5"} 3
+test_seconds_bucket{model="m",le="10"} 4
+test_seconds_bucket{model="m",le="+Inf"} 5
+test_seconds_sum{model="m"} 31.5
+test_seconds_count{model="m"} 5
+`, buf.String())
+}
+
+func TestPrometheus_LabelValue(t *testing.T) {
+	assert.Equal(t, `"a\\b\"c\nd"`, labelValue("a\\b\"c\nd"))
+}
+
+func TestPrometheus_TokenMetrics(t *testing.T) {
+	pr := newPrometheusMetrics()
+	pr.observeTokenMetrics(TokenMetrics{Model: "m", InputTokens: 25, OutputTokens: 10, CachedTokens: -1, PromptPerSecond: 100, TokensPerSecond: -1})
+	pr.observeTokenMetrics(TokenMetrics{Model: "m", InputTokens: 5, OutputTokens: 2, CachedTokens: 20, PromptPerSecond: 2000, TokensPerSecond: 40})
+	pr.countRequest("m", http.StatusOK)
+	pr.countPeerRequest("peer1", "remote", http.StatusBadGateway)
+
+	var buf bytes.Buffer
+	pr.write(&buf)
+	out := buf.String()
+	assert.Contains(t, out, `goinfer_requests_total{model="m",code="200"} 1`)
+	assert.Contains(t, out, `goinfer_peer_requests_total{peer="peer1",model="remote",code="502"} 1`)
+	assert.Contains(t, out, `goinfer_tokens_total{model="m",type="input"} 30`)
+	assert.Contains(t, out, `goinfer_tokens_total{model="m",type="output"} 12`)
+	assert.Contains(t, out, `goinfer_tokens_total{model="m",type="cached"} 20`)
+	assert.Contains(t, out, `goinfer_prompt_tokens_per_second_count{model="m"} 2`)
+	assert.Contains(t, out, `goinfer_generation_tokens_per_second_count{model="m"} 1`)
+}
+
+func TestProxyManager_PrometheusEndpoint(t *testing.T) {
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"prom-model": getTestSimpleResponderConfig("prom-model"),
+			"prom-idle":  getTestSimpleResponderConfig("prom-idle"),
+		},
+		LogLevel:     "error",
+		MetricsToken: "scrape-token",
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"prom-model","stream":true}`))
+	w := CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the scrape token is required
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody)
+	req.Header.Set("Authorization", "Bearer scrape-token")
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+
+	out := w.Body.String()
+	assert.Contains(t, out, `goinfer_requests_total{model="prom-model",code="200"} 1`)
+	assert.Contains(t, out, `goinfer_tokens_total{model="prom-model",type="output"}`)
+	assert.Contains(t, out, `goinfer_process_state{model="prom-model",state="ready"} 1`)
+	assert.Contains(t, out, `goinfer_process_state{model="prom-idle",state="stopped"} 1`)
+	assert.Contains(t, out, `goinfer_requests_in_flight{model="prom-model"} 0`)
+	assert.Contains(t, out, `goinfer_requests_queued{model="prom-model"} 0`)
+	assert.Contains(t, out, `goinfer_model_load_duration_seconds_count{model="prom-model"} 1`)
+	assert.Contains(t, out, `goinfer_model_swap_duration_seconds_count{model="prom-model"} 1`)
+	assert.Contains(t, out, `goinfer_model_load_duration_seconds_count{model="prom-idle"} 0`)
+}
@@ -6,8 +6,12 @@ package proxy
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -37,6 +41,12 @@ type proxyCtxKey string
 type ProxyManager struct {
 	shutdownCtx    context.Context
 	metricsMonitor *metricsMonitor
+	prometheus     *prometheusMetrics
+	quotas         *quotaManager
+	tracer         *tracer             // nil if tracing is disabled
+	captures       *captureStore       // nil if the captures are disabled
+	responses      *responseStore      // nil if /v1/responses is forwarded as is
+	logFiles       map[string]*logFile // by "proxy" or model ID, empty if disabled
 	ginEngine      *gin.Engine
 	proxyLogger    *LogMonitor
 	upstreamLogger *LogMonitor
@@ -45,6 +55,9 @@ type ProxyManager struct {
 	cfg            *conf.Cfg
 	shutdownCancel context.CancelFunc
 	peerProxy      *PeerProxy
+	replicas       replicaSets
+	responseCache  *responseCache
+	dedupe         *dedupeGroup
 	buildDate      string
 	commit         string
 	version        string
@@ -123,6 +136,12 @@ func New(cfg *conf.Cfg) *ProxyManager {
 		upstreamLogger.SetLogTimeFormat(timeFormat)
 	}
 
+	if cfg.Swap.LogFormat == config.LogFormatJSON {
+		muxLogger.SetLogFormat(config.LogFormatJSON)
+		proxyLogger.SetLogFormat(config.LogFormatJSON)
+		upstreamLogger.SetLogFormat(config.LogFormatJSON)
+	}
+
 	shutdownCtx, shutdownCancel := context.WithCancel(context.Background())
 
 	var maxMetrics int
@@ -138,6 +157,22 @@ func New(cfg *conf.Cfg) *ProxyManager {
 		peerProxy = nil
 	}
 
+	prometheus := newPrometheusMetrics()
+	quotas := newQuotaManager(cfg.Swap.APIKeyQuotas)
+	metricsMonitor := newMetricsMonitor(proxyLogger, maxMetrics)
+	metricsMonitor.prometheus = prometheus
+	metricsMonitor.quotas = quotas
+	metricsMonitor.peers = cfg.Swap.Peers
+	if storeCfg := cfg.Swap.MetricsStore; storeCfg.Dir != "" {
+		store, err := newMetricsStore(storeCfg.Dir, storeCfg.MaxSizeMB, storeCfg.MaxFiles)
+		if err != nil {
+			proxyLogger.Errorf("Disabling the metrics store: %v", err)
+		} else {
+			metricsMonitor.setStore(store)
+		}
+	}
+	quotas.restore(metricsMonitor)
+
 	pm := &ProxyManager{
 		cfg:       cfg,
 		ginEngine: gin.New(),
@@ -146,7 +181,12 @@ func New(cfg *conf.Cfg) *ProxyManager {
 		muxLogger:      muxLogger,
 		upstreamLogger: upstreamLogger,
 
-		metricsMonitor: newMetricsMonitor(proxyLogger, maxMetrics),
+		metricsMonitor: metricsMonitor,
+		prometheus:     prometheus,
+		quotas:         quotas,
+		tracer:         newTracer(cfg.Swap.Tracing, proxyLogger),
+		captures:       newCaptureStore(cfg.Swap),
+		responses:      newResponseStore(cfg.Swap),
 
 		processGroups: make(map[string]*ProcessGroup),
 
@@ -158,6 +198,14 @@ func New(cfg *conf.Cfg) *ProxyManager {
 		version:   "0",
 
 		peerProxy: peerProxy,
+		replicas:  newReplicaSets(cfg.Swap),
+
+		responseCache: newResponseCache(cfg.Swap.ResponseCache, proxyLogger),
+		dedupe:        newDedupeGroup(),
+	}
+
+	if peerProxy != nil {
+		peerProxy.StartPolling(shutdownCtx)
 	}
 
 	// create the process groups
@@ -165,6 +213,7 @@ func New(cfg *conf.Cfg) *ProxyManager {
 		processGroup := NewProcessGroup(groupID, cfg.Swap, proxyLogger, upstreamLogger)
 		pm.processGroups[groupID] = processGroup
 	}
+	pm.openLogFiles()
 
 	pm.setupGinEngine()
 
@@ -182,7 +231,7 @@ func New(cfg *conf.Cfg) *ProxyManager {
 				}
 
 				proxyLogger.Infof("Preloading model: %s", modelID)
-				processGroup, err := pm.swapProcessGroup(modelID)
+				processGroup, err := pm.swapProcessGroup(context.Background(), modelID)
 
 				if err != nil {
 					event.Emit(ModelPreloadedEvent{
@@ -207,6 +256,7 @@ func New(cfg *conf.Cfg) *ProxyManager {
 }
 
 func (pm *ProxyManager) setupGinEngine() {
+	pm.ginEngine.Use(pm.requestID)
 	pm.ginEngine.Use(func(c *gin.Context) {
 		// don't log the Wake on Lan proxy health check
 		if c.Request.URL.Path == "/wol-health" {
@@ -231,7 +281,7 @@ func (pm *ProxyManager) setupGinEngine() {
 		statusCode := c.Writer.Status()
 		bodySize := c.Writer.Size()
 
-		pm.proxyLogger.Infof("Request %s \"%s %s %s\" %d %d \"%s\" %v",
+		pm.proxyLogger.ForRequest(c.Request.Context()).Infof("Request %s \"%s %s %s\" %d %d \"%s\" %v",
 			clientIP,
 			method,
 			path,
@@ -243,6 +293,9 @@ func (pm *ProxyManager) setupGinEngine() {
 		)
 	})
 
+	pm.ginEngine.Use(pm.countRequests)
+	pm.ginEngine.Use(pm.traceRequests)
+
 	// see: issue: #81, #77 and #42 for CORS issues
 	// respond with permissive OPTIONS for any endpoint
 	pm.ginEngine.Use(func(c *gin.Context) {
@@ -269,34 +322,36 @@ func (pm *ProxyManager) setupGinEngine() {
 
 	// Set up routes using the Gin engine
 	// Protected routes use pm.apiKeyAuth() middleware
-	pm.ginEngine.POST("/v1/chat/completions", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
-	pm.ginEngine.POST("/v1/responses", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/v1/chat/completions", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/v1/responses", pm.apiKeyAuth(), pm.checkQuota, pm.responsesCreate)
+	pm.ginEngine.GET("/v1/responses/:id", pm.apiKeyAuth(), pm.responsesGet)
+	pm.ginEngine.DELETE("/v1/responses/:id", pm.apiKeyAuth(), pm.responsesDelete)
 	// Support legacy /v1/completions api, see issue #12
-	pm.ginEngine.POST("/v1/completions", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/v1/completions", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
 	// Support anthropic /v1/messages (added https://github.com/ggml-org/llama.cpp/pull/17570)
-	pm.ginEngine.POST("/v1/messages", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/v1/messages", pm.apiKeyAuth(), pm.checkQuota, pm.anthropicMessages)
 
 	// Support embeddings and reranking
-	pm.ginEngine.POST("/v1/embeddings", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/v1/embeddings", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
 
 	// llama-server's /reranking endpoint + aliases
-	pm.ginEngine.POST("/reranking", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
-	pm.ginEngine.POST("/rerank", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
-	pm.ginEngine.POST("/v1/rerank", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
-	pm.ginEngine.POST("/v1/reranking", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/reranking", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/rerank", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/v1/rerank", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/v1/reranking", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
 
 	// llama-server's /infill endpoint for code infilling
-	pm.ginEngine.POST("/infill", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/infill", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
 
 	// llama-server's /completion endpoint
-	pm.ginEngine.POST("/completion", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/completion", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
 
 	// Support audio/speech endpoint
-	pm.ginEngine.POST("/v1/audio/speech", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
-	pm.ginEngine.POST("/v1/audio/voices", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
-	pm.ginEngine.POST("/v1/audio/transcriptions", pm.apiKeyAuth(), pm.ProxyOAIPostFormHandler)
-	pm.ginEngine.POST("/v1/images/generations", pm.apiKeyAuth(), pm.ProxyInferenceHandler)
-	pm.ginEngine.POST("/v1/images/edits", pm.apiKeyAuth(), pm.ProxyOAIPostFormHandler)
+	pm.ginEngine.POST("/v1/audio/speech", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/v1/audio/voices", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/v1/audio/transcriptions", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyOAIPostFormHandler)
+	pm.ginEngine.POST("/v1/images/generations", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyInferenceHandler)
+	pm.ginEngine.POST("/v1/images/edits", pm.apiKeyAuth(), pm.checkQuota, pm.ProxyOAIPostFormHandler)
 
 	pm.ginEngine.GET("/v1/models", pm.apiKeyAuth(), pm.ListModelsHandler)
 
@@ -317,9 +372,10 @@ func (pm *ProxyManager) setupGinEngine() {
 	pm.ginEngine.GET("/upstream", func(c *gin.Context) {
 		c.Redirect(http.StatusFound, "/ui/models")
 	})
-	pm.ginEngine.Any("/upstream/*upstreamPath", pm.apiKeyAuth(), pm.proxyToUpstream)
+	pm.ginEngine.Any("/upstream/*upstreamPath", pm.apiKeyAuth(), pm.checkPostQuota, pm.proxyToUpstream)
 	pm.ginEngine.GET("/unload", pm.apiKeyAuth(), pm.UnloadAllModelsHandler)
 	pm.ginEngine.GET("/running", pm.apiKeyAuth(), pm.ListRunningProcessesHandler)
+	pm.ginEngine.GET("/metrics", pm.metricsScrapeAuth(), pm.prometheusHandler)
 	pm.ginEngine.GET("/health", func(c *gin.Context) {
 		c.String(http.StatusOK, "OK")
 	})
@@ -413,16 +469,36 @@ func (pm *ProxyManager) Shutdown() {
 	}
 	wg.Wait()
 	pm.shutdownCancel()
+	pm.tracer.shutdown()
+
+	if pm.metricsMonitor.store != nil {
+		if err := pm.metricsMonitor.store.Close(); err != nil {
+			pm.proxyLogger.Errorf("Failed to close the metrics store: %v", err)
+		}
+	}
+
+	for name, lf := range pm.logFiles {
+		if err := lf.Close(); err != nil {
+			pm.proxyLogger.Errorf("Failed to close the log file of %s: %v", name, err)
+		}
+	}
 }
 
-func (pm *ProxyManager) swapProcessGroup(realModelName string) (*ProcessGroup, error) {
+func (pm *ProxyManager) swapProcessGroup(ctx context.Context, realModelName string) (*ProcessGroup, error) {
 	processGroup := pm.findGroupByModelName(realModelName)
 	if processGroup == nil {
 		return nil, fmt.Errorf("could not find process group for model %s", realModelName)
 	}
 
+	// a model served by a llama-server router requires the router first
+	if modelConfig, ok := pm.cfg.Swap.Models[realModelName]; ok && modelConfig.Router != "" {
+		if err := pm.startRouter(modelConfig.Router); err != nil {
+			return nil, fmt.Errorf("could not start router %s for model %s: %w", modelConfig.Router, realModelName, err)
+		}
+	}
+
 	if processGroup.exclusive {
-		pm.proxyLogger.Debugf("Exclusive mode for group %s, stopping other process groups", processGroup.id)
+		pm.proxyLogger.ForRequest(ctx).Debugf("Exclusive mode for group %s, stopping other process groups", processGroup.id)
 		for groupId, otherGroup := range pm.processGroups {
 			if groupId != processGroup.id && !otherGroup.persistent {
 				otherGroup.StopProcesses(StopWaitForInflightRequest)
@@ -433,6 +509,21 @@ func (pm *ProxyManager) swapProcessGroup(realModelName string) (*ProcessGroup, e
 	return processGroup, nil
 }
 
+// startRouter starts the llama-server router process (--models-preset) if not yet ready,
+// the router should be in a persistent group to not be swapped out by its own models.
+func (pm *ProxyManager) startRouter(routerID string) error {
+	routerGroup := pm.findGroupByModelName(routerID)
+	if routerGroup == nil {
+		return fmt.Errorf("could not find process group for router %s", routerID)
+	}
+
+	process, _ := routerGroup.GetMember(routerID)
+	if process.CurrentState() == StateReady {
+		return nil
+	}
+	return process.start()
+}
+
 func (pm *ProxyManager) ListModelsHandler(c *gin.Context) {
 	data := make([]gin.H, 0, len(pm.cfg.Swap.Models))
 	createdTime := time.Now().Unix()
@@ -479,9 +570,9 @@ func (pm *ProxyManager) ListModelsHandler(c *gin.Context) {
 	}
 
 	if pm.peerProxy != nil {
-		for peerID, peer := range pm.peerProxy.ListPeers() {
-			// add peer models
-			for _, modelID := range peer.Models {
+		// add the models of the healthy peers
+		for peerID, modelIDs := range pm.peerProxy.PeerModels() {
+			for _, modelID := range modelIDs {
 				// Skip unlisted models if not showing them
 				record := newRecord(modelID, &config.ModelConfig{
 					Name: fmt.Sprintf("%s: %s", peerID, modelID),
@@ -568,7 +659,7 @@ func (pm *ProxyManager) proxyToUpstream(c *gin.Context) {
 		return
 	}
 
-	processGroup, err := pm.swapProcessGroup(modelID)
+	processGroup, err := pm.swapProcessGroupTraced(c.Request.Context(), modelID)
 	if err != nil {
 		pm.sendErrorResponse(c, http.StatusInternalServerError, "error swapping process group: "+err.Error())
 		return
@@ -583,14 +674,14 @@ func (pm *ProxyManager) proxyToUpstream(c *gin.Context) {
 		err := pm.metricsMonitor.wrapHandler(modelID, c.Writer, c.Request, processGroup.ProxyRequest)
 		if err != nil {
 			pm.sendErrorResponse(c, http.StatusInternalServerError, "error proxying metrics wrapped request: "+err.Error())
-			pm.proxyLogger.Errorf("Error proxying wrapped upstream request for model %s, path=%s", modelID, originalPath)
+			pm.proxyLogger.ForRequest(c.Request.Context()).Errorf("Error proxying wrapped upstream request for model %s, path=%s", modelID, originalPath)
 			return
 		}
 	} else {
 		err := processGroup.ProxyRequest(modelID, c.Writer, c.Request)
 		if err != nil {
 			pm.sendErrorResponse(c, http.StatusInternalServerError, "error proxying request: "+err.Error())
-			pm.proxyLogger.Errorf("Error proxying upstream request for model %s, path=%s", modelID, originalPath)
+			pm.proxyLogger.ForRequest(c.Request.Context()).Errorf("Error proxying upstream request for model %s, path=%s", modelID, originalPath)
 			return
 		}
 	}
@@ -619,12 +710,64 @@ func (pm *ProxyManager) ProxyInferenceHandler(c *gin.Context) {
 		}
 	}
 
+	// deterministic requests to the local models are answered from the response cache,
+	// not the peers: they may have access rules and costs per API key
+	modelID, found := pm.realModelName(c.Request.Context(), requestedModel)
+	proxy := func(c *gin.Context) { pm.proxyCandidates(c, requestedModel, bodyBytes) }
+	if key, ok := pm.responseCache.key(c.Request, modelID, bodyBytes); found && ok {
+		if entry := pm.responseCache.get(key); entry != nil {
+			pm.prometheus.countCache(modelID, "hit")
+			pm.responseCache.replay(c.Writer, entry)
+			return
+		}
+		pm.prometheus.countCache(modelID, "miss")
+		uncached := proxy
+		proxy = func(c *gin.Context) { pm.cacheResponse(c, key, modelID, uncached) }
+	}
+
+	// identical concurrent requests share one upstream call
+	if found && pm.cfg.Swap.Models[modelID].Dedupe {
+		if key, ok := requestKey(c.Request.URL.Path, modelID, bodyBytes); ok {
+			// per API key: the usage and the quotas of each key count its tokens
+			keyID, _ := c.Request.Context().Value(proxyCtxKey("apiKey")).(string)
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), proxyCtxKey("model"), modelID))
+			pm.dedupe.do(c, keyID+"\x00"+key, proxy)
+			return
+		}
+	}
+	proxy(c)
+}
+
+// proxyCandidates follows the per-model fallbacks in order when a model fails before responding,
+// each served by one of its replicas.
+func (pm *ProxyManager) proxyCandidates(c *gin.Context, requestedModel string, bodyBytes []byte) {
+	candidates := append([]string{requestedModel}, pm.fallbacks(c.Request.Context(), requestedModel)...)
+	session := pm.sessionKey(bodyBytes)
+	client, request := c.Writer, c.Request
+	for i, model := range candidates {
+		replica, done := pm.pickReplica(request.Context(), model, session)
+		fw := newFallbackWriter(client, replica, i == len(candidates)-1)
+		c.Writer = fw
+		c.Request = request // each attempt from the original request, without the context values of the previous one
+		pm.proxyInferenceModel(c, replica, bodyBytes)
+		c.Writer = client
+		done(fw.status)
+		if !fw.failed {
+			return
+		}
+		pm.proxyLogger.ForRequest(request.Context()).Warnf("model %s failed with status %d, falling back to %s", replica, fw.status, candidates[i+1])
+	}
+}
+
+// proxyInferenceModel sends the request to a local or peer model.
+func (pm *ProxyManager) proxyInferenceModel(c *gin.Context, requestedModel string, bodyBytes []byte) {
 	// Look for a matching local model first
 	var nextHandler func(modelID string, w http.ResponseWriter, r *http.Request) error
+	var peerID string
 
-	modelID, found := pm.cfg.Swap.RealModelName(requestedModel)
+	modelID, found := pm.realModelName(c.Request.Context(), requestedModel)
 	if found {
-		processGroup, err := pm.swapProcessGroup(modelID)
+		processGroup, err := pm.swapProcessGroupTraced(c.Request.Context(), modelID)
 		if err != nil {
 			pm.sendErrorResponse(c, http.StatusInternalServerError, "error swapping process group: "+err.Error())
 			return
@@ -640,13 +783,28 @@ func (pm *ProxyManager) ProxyInferenceHandler(c *gin.Context) {
 			}
 		}
 
+		// the same slot for a conversation: its prompt cache is reused
+		if process := processGroup.processes[modelID]; process.slots != nil {
+			if session := pm.sessionKey(bodyBytes); session != "" {
+				slot, release := process.slots.assign(c.Request.Context(), process.config.Proxy, session)
+				defer release()
+				if slot >= 0 { // all busy: any slot
+					bodyBytes, err = sjson.SetBytes(bodyBytes, "id_slot", slot)
+					if err != nil {
+						pm.sendErrorResponse(c, http.StatusInternalServerError, "error setting id_slot in JSON: "+err.Error())
+						return
+					}
+				}
+			}
+		}
+
 		// issue #174 strip parameters from the JSON body
 		stripParams, err := pm.cfg.Swap.Models[modelID].Filters.SanitizedStripParams()
 		if err != nil { // just log it and continue
-			pm.proxyLogger.Errorf("Error sanitizing strip params string: %s, %s", pm.cfg.Swap.Models[modelID].Filters.StripParams, err.Error())
+			pm.proxyLogger.ForRequest(c.Request.Context()).Errorf("Error sanitizing strip params string: %s, %s", pm.cfg.Swap.Models[modelID].Filters.StripParams, err.Error())
 		} else {
 			for _, param := range stripParams {
-				pm.proxyLogger.Debugf("<%s> stripping param: %s", modelID, param)
+				pm.proxyLogger.ForRequest(c.Request.Context()).Debugf("<%s> stripping param: %s", modelID, param)
 				bodyBytes, err = sjson.DeleteBytes(bodyBytes, param)
 				if err != nil {
 					pm.sendErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("error deleting parameter %s from request", param))
@@ -655,11 +813,30 @@ func (pm *ProxyManager) ProxyInferenceHandler(c *gin.Context) {
 			}
 		}
 
-		pm.proxyLogger.Debugf("ProxyManager using local Process for model: %s", requestedModel)
+		pm.proxyLogger.ForRequest(c.Request.Context()).Debugf("ProxyManager using local Process for model: %s", requestedModel)
 		nextHandler = processGroup.ProxyRequest
 	} else if pm.peerProxy != nil && pm.peerProxy.HasPeerModel(requestedModel) {
-		pm.proxyLogger.Debugf("ProxyManager using ProxyPeer for model: %s", requestedModel)
+		pm.proxyLogger.ForRequest(c.Request.Context()).Debugf("ProxyManager using ProxyPeer for model: %s", requestedModel)
 		modelID = requestedModel
+		peerID = pm.peerProxy.Pick(requestedModel, pm.sessionKey(bodyBytes))
+		peer := pm.cfg.Swap.Peers[peerID]
+
+		// paid providers: the API keys allowed to use the model
+		keyID, _ := c.Request.Context().Value(proxyCtxKey("apiKey")).(string)
+		if !peer.KeyAllowed(requestedModel, keyID) {
+			pm.sendErrorResponse(c, http.StatusForbidden, fmt.Sprintf("API key %s is not allowed to use %s", cmp.Or(keyID, "(none)"), requestedModel))
+			return
+		}
+
+		// model name of the provider
+		if name := peer.UpstreamModelName(requestedModel); name != requestedModel {
+			var err error
+			bodyBytes, err = sjson.SetBytes(bodyBytes, "model", name)
+			if err != nil {
+				pm.sendErrorResponse(c, http.StatusInternalServerError, "error rewriting model name in JSON: "+err.Error())
+				return
+			}
+		}
 		nextHandler = pm.peerProxy.ProxyRequest
 	}
 
@@ -679,20 +856,25 @@ func (pm *ProxyManager) ProxyInferenceHandler(c *gin.Context) {
 	isStreaming := gjson.GetBytes(bodyBytes, "stream").Bool()
 	ctx := context.WithValue(c.Request.Context(), proxyCtxKey("streaming"), isStreaming)
 	ctx = context.WithValue(ctx, proxyCtxKey("model"), modelID)
+	ctx = context.WithValue(ctx, proxyCtxKey("peer"), peerID) // empty for a local model
 	c.Request = c.Request.WithContext(ctx)
 
+	if pm.captures.enabled(modelID) {
+		nextHandler = pm.captures.wrap(requestedModel, bodyBytes, nextHandler)
+	}
+
 	if pm.metricsMonitor != nil && c.Request.Method == http.MethodPost {
 		err := pm.metricsMonitor.wrapHandler(modelID, c.Writer, c.Request, nextHandler)
 		if err != nil {
 			pm.sendErrorResponse(c, http.StatusInternalServerError, "error proxying metrics wrapped request: "+err.Error())
-			pm.proxyLogger.Errorf("Error Proxying Metrics Wrapped Request model %s", modelID)
+			pm.proxyLogger.ForRequest(c.Request.Context()).Errorf("Error Proxying Metrics Wrapped Request model %s", modelID)
 			return
 		}
 	} else {
 		err := nextHandler(modelID, c.Writer, c.Request)
 		if err != nil {
 			pm.sendErrorResponse(c, http.StatusInternalServerError, "error proxying request: "+err.Error())
-			pm.proxyLogger.Errorf("Error Proxying Request for model %s", modelID)
+			pm.proxyLogger.ForRequest(c.Request.Context()).Errorf("Error Proxying Request for model %s", modelID)
 			return
 		}
 	}
@@ -722,17 +904,18 @@ func (pm *ProxyManager) ProxyOAIPostFormHandler(c *gin.Context) {
 		}
 	}
 
-	modelID, found := pm.cfg.Swap.RealModelName(requestedModel)
+	modelID, found := pm.realModelName(c.Request.Context(), requestedModel)
 	if !found {
 		pm.sendErrorResponse(c, http.StatusBadRequest, "could not find real modelID for "+requestedModel)
 		return
 	}
 
-	processGroup, err := pm.swapProcessGroup(modelID)
+	processGroup, err := pm.swapProcessGroupTraced(c.Request.Context(), modelID)
 	if err != nil {
 		pm.sendErrorResponse(c, http.StatusInternalServerError, "error swapping process group: "+err.Error())
 		return
 	}
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), proxyCtxKey("model"), modelID))
 
 	// We need to reconstruct the multipart form in any case since the body is consumed
 	// Create a new buffer for the reconstructed request
@@ -818,7 +1001,7 @@ func (pm *ProxyManager) ProxyOAIPostFormHandler(c *gin.Context) {
 	// Use the modified request for proxying
 	if err := processGroup.ProxyRequest(modelID, c.Writer, modifiedReq); err != nil {
 		pm.sendErrorResponse(c, http.StatusInternalServerError, "error proxying request: "+err.Error())
-		pm.proxyLogger.Errorf("Error Proxying Request for processGroup %s and model %s", processGroup.id, modelID)
+		pm.proxyLogger.ForRequest(c.Request.Context()).Errorf("Error Proxying Request for processGroup %s and model %s", processGroup.id, modelID)
 		return
 	}
 }
@@ -841,6 +1024,7 @@ func (pm *ProxyManager) apiKeyAuth() gin.HandlerFunc {
 	}
 
 	return func(c *gin.Context) {
+		_, span := startSpan(c.Request.Context(), "auth", spanKindInternal)
 		xApiKey := c.GetHeader("x-api-key")
 
 		var bearerKey string
@@ -874,6 +1058,7 @@ func (pm *ProxyManager) apiKeyAuth() gin.HandlerFunc {
 		valid := slices.Contains(pm.cfg.Swap.RequiredAPIKeys, providedKey)
 
 		if !valid {
+			span.finish(errors.New("invalid or missing API key"))
 			c.Header("WWW-Authenticate", `Basic realm="llama-swap"`)
 			pm.sendErrorResponse(c, http.StatusUnauthorized, "unauthorized: invalid or missing API key")
 			c.Abort()
@@ -884,10 +1069,23 @@ func (pm *ProxyManager) apiKeyAuth() gin.HandlerFunc {
 		c.Request.Header.Del("Authorization")
 		c.Request.Header.Del("X-Api-Key")
 
+		// identify the key in the metrics without storing it
+		ctx := context.WithValue(c.Request.Context(), proxyCtxKey("apiKey"), pm.quotas.keyID(providedKey))
+		c.Request = c.Request.WithContext(ctx)
+		span.setAttr("goinfer.api_key", pm.quotas.keyID(providedKey))
+		span.finish(nil)
+
 		c.Next()
 	}
 }
 
+// apiKeyID returns a short and stable identifier of the API key,
+// the key itself must not be written in the metrics files.
+func apiKeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key-" + hex.EncodeToString(sum[:4])
+}
+
 func (pm *ProxyManager) UnloadAllModelsHandler(c *gin.Context) {
 	pm.StopProcesses(StopImmediately)
 	c.String(http.StatusOK, "OK")
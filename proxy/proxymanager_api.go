@@ -16,23 +16,47 @@ import (
 )
 
 type Model struct {
-	Id          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	State       string `json:"state"`
-	PeerID      string `json:"peerID"`
-	Unlisted    bool   `json:"unlisted"`
+	Progress    *LoadProgress `json:"progress,omitempty"` // only while starting
+	Id          string        `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	State       string        `json:"state"`
+	PeerID      string        `json:"peerID"`
+	Unlisted    bool          `json:"unlisted"`
 }
 
 func addApiHandlers(pm *ProxyManager) {
 	// Add API endpoints for React to consume
 	// Protected with API key authentication
 	apiGroup := pm.ginEngine.Group("/api", pm.apiKeyAuth())
+	apiGroup.GET("/models", pm.apiListModels)
 	apiGroup.POST("/models/unload", pm.apiUnloadAllModels)
 	apiGroup.POST("/models/unload/*model", pm.apiUnloadSingleModelHandler)
 	apiGroup.GET("/events", pm.apiSendEvents)
 	apiGroup.GET("/metrics", pm.apiGetMetrics)
+	apiGroup.GET("/usage", pm.apiGetUsage)
+	apiGroup.GET("/peers", pm.apiListPeers)
+	apiGroup.GET("/logfiles", pm.apiListLogFiles)
+	apiGroup.GET("/logfiles/*name", pm.apiGetLogFile)
+	apiGroup.GET("/captures", pm.apiListCaptures)
+	apiGroup.DELETE("/captures", pm.apiDeleteCaptures)
+	apiGroup.GET("/captures/:id", pm.apiGetCapture)
+	apiGroup.POST("/captures/:id/replay", pm.checkQuota, pm.apiReplayCapture)
 	apiGroup.GET("/version", pm.apiGetVersion)
+
+	// Ollama API, see ollama.go
+	apiGroup.POST("/chat", pm.checkQuota, pm.ollamaChat)
+	apiGroup.POST("/generate", pm.checkQuota, pm.ollamaGenerate)
+	apiGroup.POST("/embed", pm.checkQuota, pm.ollamaEmbed)
+	apiGroup.POST("/embeddings", pm.checkQuota, pm.ollamaEmbeddings)
+	apiGroup.GET("/tags", pm.ollamaTags)
+	apiGroup.POST("/show", pm.ollamaShow)
+	apiGroup.GET("/ps", pm.ollamaPS)
+	apiGroup.POST("/pull", pm.ollamaNotSupported)
+	apiGroup.POST("/push", pm.ollamaNotSupported)
+	apiGroup.POST("/create", pm.ollamaNotSupported)
+	apiGroup.POST("/copy", pm.ollamaNotSupported)
+	apiGroup.DELETE("/delete", pm.ollamaNotSupported)
 }
 
 func (pm *ProxyManager) apiUnloadAllModels(c *gin.Context) {
@@ -40,6 +64,19 @@ func (pm *ProxyManager) apiUnloadAllModels(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"msg": "ok"})
 }
 
+func (pm *ProxyManager) apiListModels(c *gin.Context) {
+	c.JSON(http.StatusOK, pm.getModelStatus())
+}
+
+// apiListPeers returns the health and the served models of the peers.
+func (pm *ProxyManager) apiListPeers(c *gin.Context) {
+	if pm.peerProxy == nil {
+		c.JSON(http.StatusOK, []PeerStatus{})
+		return
+	}
+	c.JSON(http.StatusOK, pm.peerProxy.Status())
+}
+
 func (pm *ProxyManager) getModelStatus() []Model {
 	// Extract keys and sort them
 	models := []Model{}
@@ -55,6 +92,7 @@ func (pm *ProxyManager) getModelStatus() []Model {
 		// Get process state
 		processGroup := pm.findGroupByModelName(modelID)
 		state := "unknown"
+		var progress *LoadProgress
 		if processGroup != nil {
 			process := processGroup.processes[modelID]
 			if process != nil {
@@ -64,8 +102,13 @@ func (pm *ProxyManager) getModelStatus() []Model {
 					stateStr = "ready"
 				case StateStarting:
 					stateStr = "starting"
+					if lp := process.LoadProgress(); lp.Stage != "" {
+						progress = &lp
+					}
 				case StateStopping:
 					stateStr = "stopping"
+				case StateUnhealthy:
+					stateStr = "unhealthy"
 				case StateShutdown:
 					stateStr = "shutdown"
 				case StateStopped:
@@ -77,6 +120,7 @@ func (pm *ProxyManager) getModelStatus() []Model {
 			}
 		}
 		models = append(models, Model{
+			Progress:    progress,
 			Id:          modelID,
 			Name:        pm.cfg.Swap.Models[modelID].Name,
 			Description: pm.cfg.Swap.Models[modelID].Description,
@@ -87,11 +131,16 @@ func (pm *ProxyManager) getModelStatus() []Model {
 
 	// Iterate over the peer models
 	if pm.peerProxy != nil {
-		for peerID, peer := range pm.peerProxy.ListPeers() {
+		for _, peer := range pm.peerProxy.Status() {
+			state := "ready"
+			if !peer.Healthy {
+				state = "unhealthy"
+			}
 			for _, modelID := range peer.Models {
 				models = append(models, Model{
 					Id:     modelID,
-					PeerID: peerID,
+					State:  state,
+					PeerID: peer.ID,
 				})
 			}
 		}
@@ -173,6 +222,9 @@ func (pm *ProxyManager) apiSendEvents(c *gin.Context) {
 	defer event.On(func(e ConfigFileChangedEvent) {
 		sendModels()
 	})()
+	defer event.On(func(e ModelLoadProgressEvent) {
+		sendModels()
+	})()
 
 	/**
 	 * Send Log data
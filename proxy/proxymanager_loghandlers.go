@@ -5,12 +5,16 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
 	"net/http"
+	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lynxai-team/goinfer/proxy/config"
 )
 
 func (pm *ProxyManager) sendLogsHandlers(c *gin.Context) {
@@ -18,9 +22,14 @@ func (pm *ProxyManager) sendLogsHandlers(c *gin.Context) {
 	if strings.Contains(accept, "text/html") {
 		c.Redirect(http.StatusFound, "/ui/")
 	} else {
-		c.Header("Content-Type", "text/plain")
-		history := pm.muxLogger.GetHistory()
-		_, err := c.Writer.Write(history)
+		filter, format, err := pm.logFilter(c, pm.muxLogger)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		c.Header("Content-Type", logContentType(format))
+		history := filter(pm.muxLogger.GetHistory())
+		_, err = c.Writer.Write(history)
 		if err != nil {
 			c.AbortWithError(http.StatusInternalServerError, err)
 			return
@@ -29,12 +38,6 @@ func (pm *ProxyManager) sendLogsHandlers(c *gin.Context) {
 }
 
 func (pm *ProxyManager) StreamLogsHandler(c *gin.Context) {
-	c.Header("Content-Type", "text/plain")
-	c.Header("Transfer-Encoding", "chunked")
-	c.Header("X-Content-Type-Options", "nosniff")
-	// prevent nginx from buffering streamed logs
-	c.Header("X-Accel-Buffering", "no")
-
 	logMonitorId := strings.TrimPrefix(c.Param("logMonitorID"), "/")
 	logger, err := pm.getLogger(logMonitorId)
 	if err != nil {
@@ -42,6 +45,18 @@ func (pm *ProxyManager) StreamLogsHandler(c *gin.Context) {
 		return
 	}
 
+	filter, format, err := pm.logFilter(c, logger)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", logContentType(format))
+	c.Header("Transfer-Encoding", "chunked")
+	c.Header("X-Content-Type-Options", "nosniff")
+	// prevent nginx from buffering streamed logs
+	c.Header("X-Accel-Buffering", "no")
+
 	flusher, ok := c.Writer.(http.Flusher)
 	if !ok {
 		c.AbortWithError(http.StatusInternalServerError, errors.New("streaming unsupported"))
@@ -52,7 +67,7 @@ func (pm *ProxyManager) StreamLogsHandler(c *gin.Context) {
 	// Send history first if not skipped
 
 	if !skipHistory {
-		history := logger.GetHistory()
+		history := filter(logger.GetHistory())
 		if len(history) != 0 {
 			c.Writer.Write(history)
 			flusher.Flush()
@@ -79,12 +94,59 @@ func (pm *ProxyManager) StreamLogsHandler(c *gin.Context) {
 			cancel()
 			return
 		case data := <-sendChan:
+			if data = filter(data); len(data) == 0 {
+				continue
+			}
 			c.Writer.Write(data)
 			flusher.Flush()
 		}
 	}
 }
 
+// logFilter returns the transformation of the log data requested by the query parameters:
+//   - format=text|json converts the lines, the default is the format of the logger
+//   - request_id=<id> keeps the lines of a request, see X-Request-ID
+func (pm *ProxyManager) logFilter(c *gin.Context, logger *LogMonitor) (filter func([]byte) []byte, format string, err error) {
+	filter = func(data []byte) []byte { return data }
+	format = logger.LogFormat()
+
+	switch requested := c.Query("format"); requested {
+	case "", format:
+	case config.LogFormatText, config.LogFormatJSON:
+		format = requested
+		pm.proxyLogger.mu.RLock()
+		lc := &logConverter{format: format, timeFormat: pm.proxyLogger.timeFormat}
+		pm.proxyLogger.mu.RUnlock()
+		filter = lc.convert
+	default:
+		return nil, "", errors.New("invalid format. Use 'text' or 'json'")
+	}
+
+	if requestID := c.Query("request_id"); requestID != "" {
+		convert, match := filter, requestIDMatch(format, requestID)
+		filter = func(data []byte) []byte { return filterLogLines(convert(data), match) }
+	}
+	return filter, format, nil
+}
+
+func logContentType(format string) string {
+	if format == config.LogFormatJSON {
+		return "application/x-ndjson"
+	}
+	return "text/plain"
+}
+
+// filterLogLines keeps the lines containing substr.
+func filterLogLines(data []byte, substr string) []byte {
+	var result []byte
+	for line := range bytes.Lines(data) {
+		if bytes.Contains(line, []byte(substr)) {
+			result = append(result, line...)
+		}
+	}
+	return result
+}
+
 // getLogger searches for the appropriate logger based on the logMonitorId.
 func (pm *ProxyManager) getLogger(logMonitorId string) (*LogMonitor, error) {
 	switch logMonitorId {
@@ -109,3 +171,92 @@ func (pm *ProxyManager) getLogger(logMonitorId string) (*LogMonitor, error) {
 		return nil, errors.New("invalid logger. Use 'proxy', 'upstream' or a model's ID")
 	}
 }
+
+// openLogFiles copies the proxy logs and the output of each model to the rotated files of logFiles.dir.
+func (pm *ProxyManager) openLogFiles() {
+	pm.logFiles = make(map[string]*logFile)
+	root := pm.cfg.Swap.LogFiles.Dir
+	if root == "" {
+		return
+	}
+
+	loggers := map[string]*LogMonitor{"proxy": pm.proxyLogger}
+	for _, group := range pm.processGroups {
+		for modelID, process := range group.processes {
+			loggers[modelID] = process.Logger()
+		}
+	}
+
+	for name, logger := range loggers {
+		lf, err := newLogFile(logFileDir(root, name), pm.cfg.Swap.LogFiles)
+		if err != nil {
+			pm.proxyLogger.Errorf("Disabling the log file of %s: %v", name, err)
+			continue
+		}
+		logger.SetFile(lf)
+		pm.logFiles[name] = lf
+	}
+}
+
+// apiListLogFiles returns the segments of each log file.
+func (pm *ProxyManager) apiListLogFiles(c *gin.Context) {
+	result := make(map[string][]logSegment, len(pm.logFiles))
+	for name, lf := range pm.logFiles {
+		segments, err := lf.segments()
+		if err != nil {
+			pm.sendErrorResponse(c, http.StatusInternalServerError, "cannot list the log files: "+err.Error())
+			return
+		}
+		result[name] = segments
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// apiGetLogFile returns the segments of the log file of "proxy" or a model,
+// or the content of a segment with ?segment=<name> (last-failed for the last failed start).
+func (pm *ProxyManager) apiGetLogFile(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("name"), "/")
+	if realName, found := pm.cfg.Swap.RealModelName(name); found {
+		name = realName
+	}
+	lf, ok := pm.logFiles[name]
+	if !ok {
+		pm.sendErrorResponse(c, http.StatusNotFound, "no log file for "+name+", see logFiles.dir")
+		return
+	}
+
+	segment := c.Query("segment")
+	switch segment {
+	case "":
+		segments, err := lf.segments()
+		if err != nil {
+			pm.sendErrorResponse(c, http.StatusInternalServerError, "cannot list the log files: "+err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, segments)
+		return
+	case "last-failed":
+		failed, found := lf.lastFailed()
+		if !found {
+			pm.sendErrorResponse(c, http.StatusNotFound, "no failed start of "+name)
+			return
+		}
+		segment = failed.Name
+	}
+
+	rc, err := lf.openSegment(segment)
+	if errors.Is(err, os.ErrNotExist) {
+		pm.sendErrorResponse(c, http.StatusNotFound, "log segment not found: "+segment)
+		return
+	}
+	if err != nil {
+		pm.sendErrorResponse(c, http.StatusInternalServerError, "cannot read the log segment: "+err.Error())
+		return
+	}
+	defer rc.Close()
+
+	c.Header("X-Log-Segment", segment)
+	c.Header("Content-Type", logContentType(pm.proxyLogger.LogFormat()))
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, rc)
+}
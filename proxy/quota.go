@@ -0,0 +1,215 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lynxai-team/goinfer/proxy/config"
+)
+
+// keyQuota tracks the usage of one API key against its limits.
+type keyQuota struct {
+	cfg      config.APIKeyQuota
+	requests []time.Time // accepted during the last minute, oldest first
+	day      string      // YYYY-MM-DD of dayTokens
+	tokens   int64       // input + output tokens of the day
+	inFlight int
+	mu       sync.Mutex
+}
+
+// quotaManager enforces the apiKeyQuotas, the keys are identified by
+// their name (see keyID) so the accounting matches the usage metrics.
+type quotaManager struct {
+	keys  map[string]*keyQuota // by key ID
+	names map[string]string    // key -> key ID
+	now   func() time.Time
+}
+
+func newQuotaManager(quotas []config.APIKeyQuota) *quotaManager {
+	qm := &quotaManager{
+		keys:  make(map[string]*keyQuota, len(quotas)),
+		names: make(map[string]string, len(quotas)),
+		now:   time.Now,
+	}
+	for _, q := range quotas {
+		id := q.Name
+		if id == "" {
+			id = apiKeyID(q.Key)
+		}
+		qm.names[q.Key] = id
+		qm.keys[id] = &keyQuota{cfg: q}
+	}
+	return qm
+}
+
+// keyID returns the configured name of the key, or the hash identifier.
+func (qm *quotaManager) keyID(key string) string {
+	if id, ok := qm.names[key]; ok {
+		return id
+	}
+	return apiKeyID(key)
+}
+
+// quotaExceededError is returned by acquire, retryAfter is the wait before the quota frees up.
+type quotaExceededError struct {
+	keyID      string
+	limit      string
+	retryAfter time.Duration
+}
+
+func (e *quotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for API key %s: %s", e.keyID, e.limit)
+}
+
+// acquire reserves a request for the key, release must be called once the request is done.
+// The remaining quota is written in the headers, even when exceeded.
+func (qm *quotaManager) acquire(keyID string, header http.Header) (release func(), err error) {
+	kq := qm.keys[keyID]
+	if kq == nil {
+		return func() {}, nil // no quota for this key
+	}
+
+	now := qm.now()
+	kq.mu.Lock()
+	defer kq.mu.Unlock()
+
+	// forget the requests older than one minute
+	cutoff := now.Add(-time.Minute)
+	i := 0
+	for i < len(kq.requests) && !kq.requests[i].After(cutoff) {
+		i++
+	}
+	kq.requests = kq.requests[i:]
+
+	if today := now.Format(time.DateOnly); kq.day != today {
+		kq.day = today
+		kq.tokens = 0
+	}
+
+	if limit := kq.cfg.RequestsPerMinute; limit > 0 {
+		remaining := limit - len(kq.requests)
+		reset := time.Minute
+		if len(kq.requests) > 0 {
+			reset = kq.requests[0].Add(time.Minute).Sub(now)
+		}
+		setQuotaHeaders(header, "Requests", int64(limit), int64(max(remaining-1, 0)), reset) // including this request
+		if remaining <= 0 {
+			return nil, &quotaExceededError{keyID, fmt.Sprintf("%d requests per minute", limit), reset}
+		}
+	}
+
+	if limit := kq.cfg.TokensPerDay; limit > 0 {
+		remaining := max(limit-kq.tokens, 0)
+		year, month, day := now.Date()
+		reset := time.Date(year, month, day+1, 0, 0, 0, 0, now.Location()).Sub(now)
+		setQuotaHeaders(header, "Tokens", limit, remaining, reset)
+		if remaining == 0 {
+			return nil, &quotaExceededError{keyID, fmt.Sprintf("%d tokens per day", limit), reset}
+		}
+	}
+
+	if limit := kq.cfg.ConcurrentRequests; limit > 0 {
+		remaining := limit - kq.inFlight
+		header.Set("X-Ratelimit-Limit-Concurrent", strconv.Itoa(limit))
+		header.Set("X-Ratelimit-Remaining-Concurrent", strconv.Itoa(max(remaining-1, 0)))
+		if remaining <= 0 {
+			return nil, &quotaExceededError{keyID, fmt.Sprintf("%d concurrent requests", limit), time.Second}
+		}
+	}
+
+	kq.requests = append(kq.requests, now)
+	kq.inFlight++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			kq.mu.Lock()
+			kq.inFlight--
+			kq.mu.Unlock()
+		})
+	}, nil
+}
+
+// addTokens is called by the metricsMonitor once the tokens of a request are known.
+func (qm *quotaManager) addTokens(tm TokenMetrics) {
+	kq := qm.keys[tm.APIKey]
+	if kq == nil {
+		return
+	}
+
+	kq.mu.Lock()
+	defer kq.mu.Unlock()
+	if day := tm.Timestamp.Local().Format(time.DateOnly); day != kq.day {
+		if day < kq.day {
+			return // metric from a previous day
+		}
+		kq.day = day
+		kq.tokens = 0
+	}
+	kq.tokens += int64(max(tm.InputTokens, 0) + max(tm.OutputTokens, 0))
+}
+
+// restore reloads the tokens used today from the metrics history.
+func (qm *quotaManager) restore(mp *metricsMonitor) {
+	if len(qm.keys) == 0 {
+		return
+	}
+	year, month, day := qm.now().Date()
+	report, err := mp.queryUsage(time.Date(year, month, day, 0, 0, 0, 0, time.Local), time.Time{}, "key")
+	if err != nil {
+		mp.logger.Warnf("quotas: cannot read the usage of today: %v", err)
+		return
+	}
+	today := qm.now().Format(time.DateOnly)
+	for _, g := range report.Groups {
+		if kq := qm.keys[g.Key]; kq != nil {
+			kq.mu.Lock()
+			kq.day = today
+			kq.tokens = g.TotalTokens
+			kq.mu.Unlock()
+		}
+	}
+}
+
+// setQuotaHeaders writes the OpenAI-like rate limit headers.
+func setQuotaHeaders(header http.Header, kind string, limit, remaining int64, reset time.Duration) {
+	header.Set("X-Ratelimit-Limit-"+kind, strconv.FormatInt(limit, 10))
+	header.Set("X-Ratelimit-Remaining-"+kind, strconv.FormatInt(remaining, 10))
+	header.Set("X-Ratelimit-Reset-"+kind, reset.Round(time.Second).String())
+}
+
+// checkQuota is a middleware enforcing the quota of the authenticated key,
+// it must follow apiKeyAuth.
+func (pm *ProxyManager) checkQuota(c *gin.Context) {
+	keyID, _ := c.Request.Context().Value(proxyCtxKey("apiKey")).(string)
+	release, err := pm.quotas.acquire(keyID, c.Writer.Header())
+	if err != nil {
+		var qe *quotaExceededError
+		if errors.As(err, &qe) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(qe.retryAfter.Seconds()))))
+		}
+		pm.sendErrorResponse(c, http.StatusTooManyRequests, err.Error())
+		c.Abort()
+		return
+	}
+	defer release()
+	c.Next()
+}
+
+// checkPostQuota enforces the quota on the POST requests only, the ones metered by /upstream
+// (the other methods serve the upstream web UI).
+func (pm *ProxyManager) checkPostQuota(c *gin.Context) {
+	if c.Request.Method == http.MethodPost {
+		pm.checkQuota(c)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaManager_RequestsPerMinute(t *testing.T) {
+	qm := newQuotaManager([]config.APIKeyQuota{{Name: "team-a", Key: "sk-a", RequestsPerMinute: 2}})
+	now := time.Date(2026, 9, 1, 12, 0, 0, 0, time.Local)
+	qm.now = func() time.Time { return now }
+	assert.Equal(t, "team-a", qm.keyID("sk-a"))
+	assert.Equal(t, apiKeyID("sk-other"), qm.keyID("sk-other"))
+
+	header := http.Header{}
+	release, err := qm.acquire("team-a", header)
+	require.NoError(t, err)
+	release()
+	assert.Equal(t, "2", header.Get("X-Ratelimit-Limit-Requests"))
+	assert.Equal(t, "1", header.Get("X-Ratelimit-Remaining-Requests"))
+
+	now = now.Add(20 * time.Second)
+	_, err = qm.acquire("team-a", header)
+	require.NoError(t, err)
+	assert.Equal(t, "0", header.Get("X-Ratelimit-Remaining-Requests"))
+
+	_, err = qm.acquire("team-a", header)
+	var qe *quotaExceededError
+	require.ErrorAs(t, err, &qe)
+	assert.Equal(t, 40*time.Second, qe.retryAfter)
+	assert.Contains(t, err.Error(), "team-a: 2 requests per minute")
+
+	// the first request leaves the window
+	now = now.Add(41 * time.Second)
+	_, err = qm.acquire("team-a", header)
+	require.NoError(t, err)
+
+	// keys without quota are not limited
+	for range 5 {
+		_, err = qm.acquire(apiKeyID("sk-other"), http.Header{})
+		require.NoError(t, err)
+	}
+}
+
+func TestQuotaManager_TokensAndConcurrency(t *testing.T) {
+	qm := newQuotaManager([]config.APIKeyQuota{{Key: "sk-b", TokensPerDay: 100, ConcurrentRequests: 1}})
+	id := apiKeyID("sk-b")
+	now := time.Date(2026, 9, 1, 23, 0, 0, 0, time.Local)
+	qm.now = func() time.Time { return now }
+
+	header := http.Header{}
+	release, err := qm.acquire(id, header)
+	require.NoError(t, err)
+	assert.Equal(t, "100", header.Get("X-Ratelimit-Remaining-Tokens"))
+	assert.Equal(t, "1h0m0s", header.Get("X-Ratelimit-Reset-Tokens"))
+	assert.Equal(t, "0", header.Get("X-Ratelimit-Remaining-Concurrent"))
+
+	_, err = qm.acquire(id, http.Header{})
+	require.ErrorContains(t, err, "1 concurrent requests")
+
+	qm.addTokens(TokenMetrics{Timestamp: now, APIKey: id, InputTokens: 80, OutputTokens: 30, CachedTokens: -1})
+	release()
+	release() // only once
+
+	header = http.Header{}
+	_, err = qm.acquire(id, header)
+	require.ErrorContains(t, err, "100 tokens per day")
+	assert.Equal(t, "0", header.Get("X-Ratelimit-Remaining-Tokens"))
+
+	// reset at midnight
+	now = now.Add(2 * time.Hour)
+	_, err = qm.acquire(id, http.Header{})
+	require.NoError(t, err)
+}
+
+func TestProxyManager_QuotaExceeded(t *testing.T) {
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"quota-model": getTestSimpleResponderConfig("quota-model"),
+		},
+		LogLevel:        "error",
+		RequiredAPIKeys: []string{"sk-team", "sk-free"},
+		APIKeyQuotas:    []config.APIKeyQuota{{Name: "team", Key: "sk-team", RequestsPerMinute: 1}},
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	post := func(key string) *TestResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"quota-model"}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Accept", "application/json")
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("sk-team")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-Ratelimit-Remaining-Requests"))
+
+	w = post("sk-team")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "quota exceeded for API key team")
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// also through /upstream
+	req := httptest.NewRequest(http.MethodPost, "/upstream/quota-model/v1/chat/completions", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer sk-team")
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// other keys and non inference endpoints are not limited
+	assert.Equal(t, http.StatusOK, post("sk-free").Code)
+	req = httptest.NewRequest(http.MethodGet, "/v1/models", http.NoBody)
+	req.Header.Set("Authorization", "Bearer sk-team")
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	metrics := proxy.metricsMonitor.getMetrics()
+	require.NotEmpty(t, metrics)
+	assert.Equal(t, "team", metrics[0].APIKey)
+}
@@ -0,0 +1,200 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/tidwall/gjson"
+)
+
+// circuitBreaker tracks the health of a peer or a replica: closed (healthy), open after
+// threshold consecutive failures, half-open when a request probes it after the cooldown.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time // zero when closed
+	probing   bool
+	lastError string
+}
+
+// allow reports whether a request may be sent, an open circuit lets one probe through after the cooldown.
+func (h *circuitBreaker) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.openedAt.IsZero() {
+		return true
+	}
+	if h.probing || time.Since(h.openedAt) < h.cooldown {
+		return false
+	}
+	h.probing = true
+	return true
+}
+
+// success closes the circuit, it returns true if it was open.
+func (h *circuitBreaker) success() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	wasOpen := !h.openedAt.IsZero()
+	h.failures = 0
+	h.openedAt = time.Time{}
+	h.probing = false
+	h.lastError = ""
+	return wasOpen
+}
+
+// failure counts a failure, it returns true if the circuit opens.
+func (h *circuitBreaker) failure(err error) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures++
+	h.lastError = err.Error()
+	if h.probing { // failed probe: wait another cooldown
+		h.probing = false
+		h.openedAt = time.Now()
+		return false
+	}
+	if h.openedAt.IsZero() && h.failures >= h.threshold {
+		h.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// release ends a probe without outcome (the client went away).
+func (h *circuitBreaker) release() {
+	h.mu.Lock()
+	h.probing = false
+	h.mu.Unlock()
+}
+
+// ready reports whether allow would let a request through, without claiming the probe.
+func (h *circuitBreaker) ready() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.openedAt.IsZero() || (!h.probing && time.Since(h.openedAt) >= h.cooldown)
+}
+
+func (h *circuitBreaker) healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.openedAt.IsZero()
+}
+
+// replica is a model (local or peer) serving the requests of a replicated model.
+type replica struct {
+	model    string
+	inFlight atomic.Int32
+	health   *circuitBreaker
+}
+
+// replicaSets holds the replicas of the models having replicas, see ModelConfig.Replicas.
+type replicaSets map[string][]*replica
+
+func newReplicaSets(cfg *config.Config) replicaSets {
+	sets := replicaSets{}
+	for modelID, modelConfig := range cfg.Models {
+		if len(modelConfig.Replicas) == 0 {
+			continue
+		}
+		for _, model := range append([]string{modelID}, modelConfig.Replicas...) {
+			sets[modelID] = append(sets[modelID], &replica{
+				model:  model,
+				health: &circuitBreaker{threshold: 3, cooldown: 30 * time.Second},
+			})
+		}
+	}
+	return sets
+}
+
+// sessionKey returns the first non-empty sticky key of the request body, see Config.StickyKeys.
+func (pm *ProxyManager) sessionKey(body []byte) string {
+	for _, key := range pm.cfg.Swap.StickyKeys {
+		if value := gjson.GetBytes(body, key).String(); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// pickReplica returns the replica serving the request and the function to call with the response status.
+// A session goes to the same replica while it is healthy, the others go to the least busy healthy replica.
+func (pm *ProxyManager) pickReplica(ctx context.Context, requestedModel, session string) (string, func(status int)) {
+	modelID, found := pm.realModelName(ctx, requestedModel)
+	replicas := pm.replicas[modelID]
+	if !found || len(replicas) == 0 {
+		return requestedModel, func(int) {}
+	}
+
+	ready := make([]*replica, 0, len(replicas))
+	for _, r := range replicas {
+		if r.health.ready() && pm.replicaAvailable(ctx, r.model) {
+			ready = append(ready, r)
+		}
+	}
+	if len(ready) == 0 {
+		ready = replicas // all down: the first one answers, the fallbacks follow
+	}
+	chosen := ready[0]
+	for _, r := range ready[1:] {
+		if session != "" {
+			if rendezvousScore(session, r.model) > rendezvousScore(session, chosen.model) {
+				chosen = r
+			}
+		} else if r.inFlight.Load() < chosen.inFlight.Load() {
+			chosen = r
+		}
+	}
+
+	chosen.health.allow()
+	chosen.inFlight.Add(1)
+	return chosen.model, func(status int) {
+		chosen.inFlight.Add(-1)
+		switch {
+		case status == 0:
+			chosen.health.release()
+		case fallbackStatus(status):
+			chosen.health.failure(errors.New("HTTP " + strconv.Itoa(status)))
+		default:
+			chosen.health.success()
+		}
+	}
+}
+
+// replicaAvailable reports whether the local process can take requests or a healthy peer serves the model.
+func (pm *ProxyManager) replicaAvailable(ctx context.Context, model string) bool {
+	if modelID, found := pm.realModelName(ctx, model); found {
+		processGroup := pm.findGroupByModelName(modelID)
+		if processGroup == nil {
+			return false
+		}
+		switch processGroup.processes[modelID].CurrentState() {
+		case StateUnhealthy, StateShutdown:
+			return false
+		}
+		return true
+	}
+	return pm.peerProxy != nil && pm.peerProxy.Healthy(model)
+}
+
+// rendezvousScore ranks the replicas of a session, the highest score serves it:
+// the sessions of a replica going down move to the others, the other sessions stay.
+func rendezvousScore(session, name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(session))
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+	return h.Sum64()
+}
@@ -0,0 +1,176 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	h := &circuitBreaker{threshold: 2, cooldown: time.Hour}
+	assert.True(t, h.allow())
+	assert.False(t, h.failure(errors.New("refused")))
+	assert.True(t, h.healthy())
+	assert.True(t, h.failure(errors.New("refused")), "opens at the threshold")
+	assert.False(t, h.healthy())
+	assert.False(t, h.allow(), "fails fast during the cooldown")
+
+	// half-open: a single probe after the cooldown
+	h.openedAt = time.Now().Add(-2 * time.Hour)
+	assert.True(t, h.allow())
+	assert.False(t, h.allow())
+	h.failure(errors.New("refused"))
+	assert.False(t, h.allow(), "a failed probe restarts the cooldown")
+
+	h.openedAt = time.Now().Add(-2 * time.Hour)
+	assert.True(t, h.allow())
+	assert.True(t, h.success(), "a successful probe closes the circuit")
+	assert.True(t, h.healthy())
+	assert.Equal(t, 0, h.failures)
+}
+
+func TestPeerProxy_Pick(t *testing.T) {
+	proxyURL, _ := url.Parse("http://peer.example.com:8080")
+	peers := config.PeerDictionaryConfig{
+		"a": {Proxy: proxyURL.String(), ProxyURL: proxyURL, Models: []string{"m"}},
+		"b": {Proxy: proxyURL.String(), ProxyURL: proxyURL, Models: []string{"m"}},
+	}
+	pp, err := NewPeerProxy(peers, testLogger)
+	require.NoError(t, err)
+	a, b := pp.members["a"], pp.members["b"]
+
+	// least in-flight, the first peer on equality
+	assert.Equal(t, "a", pp.Pick("m", ""))
+	a.inFlight.Add(1)
+	assert.Equal(t, "b", pp.Pick("m", ""))
+	a.inFlight.Add(-1)
+
+	// sessions stick to a peer whatever the load, and are spread over the peers
+	picked := map[string]int{}
+	for i := range 20 {
+		session := fmt.Sprint("session-", i)
+		first := pp.Pick("m", session)
+		b.inFlight.Add(5)
+		assert.Equal(t, first, pp.Pick("m", session))
+		b.inFlight.Add(-5)
+		picked[first]++
+	}
+	assert.Len(t, picked, 2)
+
+	// an unhealthy peer is skipped, its sessions move
+	for range 3 {
+		b.health.failure(errors.New("refused"))
+	}
+	for i := range 20 {
+		assert.Equal(t, "a", pp.Pick("m", fmt.Sprint("session-", i)))
+	}
+	assert.True(t, pp.Healthy("m"))
+	assert.Equal(t, map[string][]string{"a": {"m"}}, pp.PeerModels())
+}
+
+func TestProxyManager_Replicas(t *testing.T) {
+	release := make(chan struct{})
+	var failing atomic.Bool
+	var mu sync.Mutex
+	received := map[string]int{}
+	upstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/chat/completions" {
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			received[name]++
+			mu.Unlock()
+			if strings.Contains(string(body), "wait") {
+				<-release
+			}
+			if name == "gpu1" && failing.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(`{}`))
+		}))
+	}
+	gpu0 := upstream("gpu0")
+	defer gpu0.Close()
+	gpu1 := upstream("gpu1")
+	defer gpu1.Close()
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"qwen":      {Proxy: gpu0.URL, CheckEndpoint: "/health", Replicas: []string{"qwen-gpu1"}},
+			"qwen-gpu1": {Proxy: gpu1.URL, CheckEndpoint: "/health"},
+		},
+		Groups: map[string]config.GroupConfig{
+			"gpus": {Swap: false, Members: []string{"qwen", "qwen-gpu1"}},
+		},
+		StickyKeys: []string{"prompt_cache_key", "user"},
+		LogLevel:   "error",
+	}
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	post := func(body string) *TestResponseRecorder {
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+		return w
+	}
+
+	// least in-flight: the second request goes to the idle replica
+	done := make(chan *TestResponseRecorder)
+	go func() { done <- post(`{"model":"qwen","wait":true}`) }()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return received["gpu0"] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	w := post(`{"model":"qwen"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "qwen-gpu1", w.Header().Get(servedModelHeader))
+	close(release)
+	assert.Equal(t, "qwen", (<-done).Header().Get(servedModelHeader))
+
+	// sticky sessions, prompt_cache_key first
+	served := map[string]string{}
+	for i := range 10 {
+		key := fmt.Sprint("conv-", i)
+		served[key] = post(`{"model":"qwen","prompt_cache_key":"` + key + `"}`).Header().Get(servedModelHeader)
+		assert.Equal(t, served[key], post(`{"model":"qwen","user":"`+key+`"}`).Header().Get(servedModelHeader))
+	}
+
+	// a failing replica is skipped after 3 failures
+	failing.Store(true)
+	failures := 0
+	for i := 0; failures < 3; i++ {
+		require.Less(t, i, 50)
+		if post(`{"model":"qwen","user":"conv-`+fmt.Sprint(i%10)+`"}`).Code == http.StatusInternalServerError {
+			failures++
+		}
+	}
+	for key := range served {
+		w := post(`{"model":"qwen","user":"` + key + `"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "qwen", w.Header().Get(servedModelHeader))
+	}
+}
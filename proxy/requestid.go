@@ -0,0 +1,64 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestIDHeader correlates the proxy logs, the upstream logs and the metrics of a request.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds the accepted client IDs, longer ones are replaced.
+const maxRequestIDLen = 128
+
+// requestID is the outermost middleware: it accepts the X-Request-ID of the client
+// or generates one, stores it in the request context, forwards it upstream and echoes it.
+func (pm *ProxyManager) requestID(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	c.Request.Header.Set(requestIDHeader, id) // forwarded to llama-server and the peers
+	c.Header(requestIDHeader, id)
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), proxyCtxKey("requestID"), id))
+	c.Next()
+}
+
+// newRequestID returns 16 random hex digits.
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID accepts the printable ASCII IDs without spaces, brackets and quotes:
+// the text and JSON log lines stay parsable.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := range len(id) {
+		switch c := id[i]; {
+		case c <= ' ', c > '~', c == '[', c == ']', c == '"', c == '\\':
+			return false
+		}
+	}
+	return true
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(proxyCtxKey("requestID")).(string)
+	return id
+}
+
+// requestIDTag is the marker of the request ID in the log lines.
+func requestIDTag(id string) string {
+	return "[req=" + id + "]"
+}
@@ -0,0 +1,100 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID_Valid(t *testing.T) {
+	assert.True(t, validRequestID("abc-123"))
+	assert.True(t, validRequestID("7f1c2e9a-4b3d-4c55-9a0e-3f2b1d6c8e77"))
+	assert.False(t, validRequestID(""))
+	assert.False(t, validRequestID("with space"))
+	assert.False(t, validRequestID("new\nline"))
+	assert.False(t, validRequestID("[req=fake]"))
+	assert.False(t, validRequestID(strings.Repeat("x", maxRequestIDLen+1)))
+	assert.Len(t, newRequestID(), 16)
+	assert.NotEqual(t, newRequestID(), newRequestID())
+}
+
+func TestRequestID_Logger(t *testing.T) {
+	lm := NewLogMonitorWriter(io.Discard)
+	ctx := context.WithValue(t.Context(), proxyCtxKey("requestID"), "abc")
+	lm.Info("no request")
+	lm.ForRequest(t.Context()).Info("no request ID")
+	lm.ForRequest(ctx).Debug("below the level")
+	lm.ForRequest(ctx).Warnf("<%s> tagged", "model")
+
+	assert.Equal(t, "[INFO] no request\n[INFO] no request ID\n[WARN] [req=abc] <model> tagged\n", string(lm.GetHistory()))
+	assert.Equal(t, "[WARN] [req=abc] <model> tagged\n", string(filterLogLines(lm.GetHistory(), requestIDTag("abc"))))
+}
+
+func TestProxyManager_RequestID(t *testing.T) {
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": getTestSimpleResponderConfig("model1"),
+		},
+		LogLevel:    "info",
+		LogToStdout: config.LogToStdoutBoth,
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+	proxy.muxLogger.stdout = io.Discard // keep the test output clean
+
+	// the client ID is echoed and forwarded
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"model1"}`))
+	req.Header.Set(requestIDHeader, "client-id-1")
+	w := CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "client-id-1", w.Header().Get(requestIDHeader))
+
+	// generated when missing or invalid
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"model1"}`))
+	req.Header.Set(requestIDHeader, "invalid id")
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	generated := w.Header().Get(requestIDHeader)
+	assert.Len(t, generated, 16)
+
+	metrics := proxy.metricsMonitor.getMetrics()
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "client-id-1", metrics[0].RequestID)
+	assert.Equal(t, generated, metrics[1].RequestID)
+	data, err := json.Marshal(metrics[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"request_id":"client-id-1"`)
+
+	// the proxy and upstream lines of the first request
+	req = httptest.NewRequest(http.MethodGet, "/logs?request_id=client-id-1", http.NoBody)
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	logs := w.Body.String()
+	assert.Contains(t, logs, `[req=client-id-1] Request `, "access log")
+	assert.Contains(t, logs, `[req=client-id-1] <model1> POST /v1/chat/completions`, "upstream marker")
+	assert.Contains(t, logs, `[req=client-id-1] <model1> Health check passed`, "start of the process")
+	assert.NotContains(t, logs, generated)
+	for line := range strings.Lines(logs) {
+		assert.Contains(t, line, "[req=client-id-1]")
+	}
+}
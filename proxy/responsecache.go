@@ -0,0 +1,323 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/tidwall/gjson"
+)
+
+// responseCacheHeader is sent by the client to force (cache a non-deterministic request)
+// or bypass the cache, the response tells hit or miss.
+const responseCacheHeader = "X-Response-Cache"
+
+// cachedResponse is a complete 200 response, streamed or not.
+type cachedResponse struct {
+	Expires     time.Time `json:"expires"`
+	Key         string    `json:"key"`
+	Model       string    `json:"model"`
+	ServedModel string    `json:"served_model,omitempty"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+}
+
+// responseCache keeps the responses in LRU order, bounded by their total size.
+type responseCache struct {
+	entries map[string]*list.Element // of *cachedResponse
+	lru     *list.List               // the most recently used first
+	logger  *LogMonitor
+	dir     string
+	ttl     time.Duration
+	size    int
+	maxSize int
+	mu      sync.Mutex
+	fileMu  sync.Mutex // orders the writes and deletions of the files, outside mu
+}
+
+// newResponseCache returns nil when the cache is disabled.
+func newResponseCache(cfg config.ResponseCacheConfig, logger *LogMonitor) *responseCache {
+	if !cfg.Enabled {
+		return nil
+	}
+	rc := &responseCache{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		logger:  logger,
+		dir:     cfg.Dir,
+		ttl:     time.Duration(cfg.TTL) * time.Second,
+		maxSize: cfg.MaxSizeMB << 20,
+	}
+	if rc.dir != "" {
+		if err := os.MkdirAll(rc.dir, 0o750); err != nil {
+			logger.Errorf("Response cache kept in memory only: %v", err)
+			rc.dir = ""
+		} else {
+			rc.load()
+		}
+	}
+	return rc
+}
+
+// key returns the cache key of the request, see requestKey.
+// Only the deterministic requests are cached (temperature 0, top_k 1), unless the client forces it.
+func (rc *responseCache) key(r *http.Request, modelID string, body []byte) (string, bool) {
+	if rc == nil || r.Method != http.MethodPost {
+		return "", false
+	}
+	switch strings.ToLower(r.Header.Get(responseCacheHeader)) {
+	case "bypass":
+		return "", false
+	case "force":
+	default:
+		temperature, topK := gjson.GetBytes(body, "temperature"), gjson.GetBytes(body, "top_k")
+		deterministic := (temperature.Exists() && temperature.Float() == 0) || (topK.Exists() && topK.Int() == 1)
+		if !deterministic || gjson.GetBytes(body, "n").Int() > 1 {
+			return "", false
+		}
+	}
+
+	return requestKey(r.URL.Path, modelID, body)
+}
+
+// requestKey hashes the model ID, the path and the body with sorted keys.
+func requestKey(path, modelID string, body []byte) (string, bool) {
+	var parsed map[string]any // the numbers become float64: 0 and 0.0 are the same
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", false
+	}
+	delete(parsed, "model") // the aliases share the model ID
+	canonical, err := json.Marshal(parsed)
+	if err != nil {
+		return "", false
+	}
+
+	h := sha256.New()
+	h.Write([]byte(modelID))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+func (rc *responseCache) get(key string) *cachedResponse {
+	rc.mu.Lock()
+	elem, found := rc.entries[key]
+	if !found {
+		rc.mu.Unlock()
+		return nil
+	}
+	entry := elem.Value.(*cachedResponse)
+	if time.Now().After(entry.Expires) {
+		rc.remove(elem)
+		rc.mu.Unlock()
+		rc.deleteFiles(key)
+		return nil
+	}
+	rc.lru.MoveToFront(elem)
+	rc.mu.Unlock()
+	return entry
+}
+
+// put adds the response, evicts the least recently used beyond maxSize and persists it.
+// The files are written and deleted after releasing rc.mu: get does not wait for the disk.
+func (rc *responseCache) put(entry *cachedResponse) {
+	if len(entry.Body) > rc.maxSize {
+		return
+	}
+	rc.mu.Lock()
+	if elem, found := rc.entries[entry.Key]; found {
+		rc.remove(elem) // its file is overwritten
+	}
+	rc.entries[entry.Key] = rc.lru.PushFront(entry)
+	rc.size += len(entry.Body)
+	var evicted []string
+	for rc.size > rc.maxSize {
+		evicted = append(evicted, rc.remove(rc.lru.Back()))
+	}
+	rc.mu.Unlock()
+
+	if rc.dir == "" {
+		return
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		rc.logger.Warnf("Failed to persist the cached response: %v", err)
+		return
+	}
+	rc.deleteFiles(evicted...)
+
+	rc.fileMu.Lock()
+	defer rc.fileMu.Unlock()
+	rc.mu.Lock()
+	elem, found := rc.entries[entry.Key]
+	rc.mu.Unlock()
+	if !found || elem.Value != entry {
+		return // evicted meanwhile, its file deleted before this one is written
+	}
+	if err := os.WriteFile(filepath.Join(rc.dir, entry.Key+".json"), b, 0o600); err != nil {
+		rc.logger.Warnf("Failed to persist the cached response: %v", err)
+	}
+}
+
+// remove deletes an entry and returns its key, the caller holds rc.mu and deletes its file.
+func (rc *responseCache) remove(elem *list.Element) string {
+	entry := rc.lru.Remove(elem).(*cachedResponse)
+	delete(rc.entries, entry.Key)
+	rc.size -= len(entry.Body)
+	return entry.Key
+}
+
+// deleteFiles deletes the persisted responses, without holding rc.mu.
+func (rc *responseCache) deleteFiles(keys ...string) {
+	if rc.dir == "" || len(keys) == 0 {
+		return
+	}
+	rc.fileMu.Lock()
+	defer rc.fileMu.Unlock()
+	for _, key := range keys {
+		os.Remove(filepath.Join(rc.dir, key+".json"))
+	}
+}
+
+// load reads the persisted responses, the expired ones are deleted.
+func (rc *responseCache) load() {
+	files, err := filepath.Glob(filepath.Join(rc.dir, "*.json"))
+	if err != nil {
+		return
+	}
+	var loaded []*cachedResponse
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var entry cachedResponse
+		if err := json.Unmarshal(b, &entry); err != nil || entry.Key+".json" != filepath.Base(file) || time.Now().After(entry.Expires) {
+			os.Remove(file)
+			continue
+		}
+		loaded = append(loaded, &entry)
+	}
+
+	// the oldest are evicted first
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Expires.Before(loaded[j].Expires) })
+	for _, entry := range loaded {
+		rc.entries[entry.Key] = rc.lru.PushFront(entry)
+		rc.size += len(entry.Body)
+	}
+	for rc.size > rc.maxSize {
+		os.Remove(filepath.Join(rc.dir, rc.remove(rc.lru.Back())+".json"))
+	}
+	rc.logger.Infof("Response cache: %d responses loaded from %s", len(rc.entries), rc.dir)
+}
+
+// replay sends the cached response, a stream is sent again event by event.
+func (rc *responseCache) replay(w gin.ResponseWriter, entry *cachedResponse) {
+	w.Header().Set("Content-Type", entry.ContentType)
+	if entry.ServedModel != "" {
+		w.Header().Set(servedModelHeader, entry.ServedModel)
+	}
+	w.Header().Set(responseCacheHeader, "hit")
+	w.WriteHeader(http.StatusOK)
+
+	if !strings.Contains(entry.ContentType, "text/event-stream") {
+		w.Write(entry.Body)
+		return
+	}
+	for event := range bytes.SplitAfterSeq(entry.Body, []byte("\n\n")) {
+		w.Write(event)
+		w.Flush()
+	}
+}
+
+// cacheResponse runs next and stores its response, unless served by a peer (fallback or replica).
+func (pm *ProxyManager) cacheResponse(c *gin.Context, key, modelID string, next func(c *gin.Context)) {
+	loading := new(atomic.Int64) // set by Process.ProxyRequest when the loading state is sent
+	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), proxyCtxKey("loadingBytes"), loading))
+	c.Header(responseCacheHeader, "miss")
+	cw := &cacheWriter{ResponseWriter: c.Writer, maxSize: pm.responseCache.maxSize}
+	c.Writer = cw
+	next(c)
+	c.Writer = cw.ResponseWriter
+
+	if _, local := pm.realModelName(c.Request.Context(), cw.Header().Get(servedModelHeader)); !local || c.Request.Context().Err() != nil {
+		return
+	}
+	pm.responseCache.store(key, modelID, cw, int(loading.Load()))
+}
+
+// store keeps the response recorded by cw if it is complete, without the first skip bytes (loading state).
+func (rc *responseCache) store(key, modelID string, cw *cacheWriter, skip int) {
+	if cw.Status() != http.StatusOK || cw.tooLarge || skip > cw.body.Len() {
+		return
+	}
+	body := cw.body.Bytes()[skip:]
+	if encoding := cw.Header().Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return // the replay sends the body as is, without Content-Encoding
+	}
+	contentType := cw.Header().Get("Content-Type")
+	if strings.Contains(contentType, "text/event-stream") && !streamComplete(body) {
+		return // interrupted stream
+	}
+	rc.put(&cachedResponse{
+		Expires:     time.Now().Add(rc.ttl),
+		Key:         key,
+		Model:       modelID,
+		ServedModel: cw.Header().Get(servedModelHeader),
+		ContentType: contentType,
+		Body:        bytes.Clone(body),
+	})
+}
+
+// streamComplete reports whether the SSE body ends with the last event of its format:
+// OpenAI data: [DONE], Anthropic message_stop, Responses response.completed.
+func streamComplete(body []byte) bool {
+	body = bytes.TrimRight(body, "\n")
+	last := body[bytes.LastIndex(body, []byte("\n\n"))+1:]
+	return bytes.Contains(last, []byte("data: [DONE]")) ||
+		bytes.Contains(last, []byte(`"type":"message_stop"`)) ||
+		bytes.Contains(last, []byte(`"type":"response.completed"`))
+}
+
+// cacheWriter records the response sent to the client, up to the cache size.
+type cacheWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	maxSize  int
+	tooLarge bool
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if !cw.tooLarge {
+		if cw.body.Len()+len(b) > cw.maxSize {
+			cw.tooLarge = true
+			cw.body.Reset()
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *cacheWriter) WriteString(s string) (int, error) {
+	return cw.Write([]byte(s))
+}
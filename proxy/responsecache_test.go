@@ -0,0 +1,267 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestResponseCache_Key(t *testing.T) {
+	var rc *responseCache
+	_, ok := rc.key(httptest.NewRequest(http.MethodPost, "/v1/chat/completions", http.NoBody), "m", []byte(`{"temperature":0}`))
+	assert.False(t, ok, "disabled")
+
+	rc = newResponseCache(config.ResponseCacheConfig{Enabled: true, TTL: 60, MaxSizeMB: 1}, testLogger)
+	key := func(body string, header string) string {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		if header != "" {
+			r.Header.Set(responseCacheHeader, header)
+		}
+		k, _ := rc.key(r, "m", []byte(body))
+		return k
+	}
+
+	k := key(`{"model":"m","temperature":0,"messages":[{"role":"user","content":"hi"}]}`, "")
+	assert.NotEmpty(t, k)
+	assert.Equal(t, k, key(`{"messages":[{"content":"hi","role":"user"}], "temperature":0.0e0, "model":"alias"}`, ""))
+	assert.NotEqual(t, k, key(`{"temperature":0,"messages":[{"role":"user","content":"ho"}]}`, ""))
+	assert.NotEmpty(t, key(`{"top_k":1}`, ""))
+	assert.Empty(t, key(`{"messages":[]}`, ""), "default temperature")
+	assert.Empty(t, key(`{"temperature":0.7}`, ""))
+	assert.Empty(t, key(`{"temperature":0,"n":2}`, ""))
+	assert.NotEmpty(t, key(`{"temperature":0.7}`, "force"))
+	assert.Empty(t, key(`{"temperature":0}`, "bypass"))
+}
+
+func TestResponseCache_LRUAndPersistence(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.ResponseCacheConfig{Enabled: true, TTL: 60, MaxSizeMB: 1, Dir: dir}
+	rc := newResponseCache(cfg, testLogger)
+	entry := func(key string) *cachedResponse {
+		return &cachedResponse{Key: key, Expires: time.Now().Add(time.Minute), ContentType: "application/json", Body: make([]byte, 400<<10)}
+	}
+	rc.put(entry("a"))
+	rc.put(entry("b"))
+	require.NotNil(t, rc.get("a"))
+	rc.put(entry("c")) // evicts b, the least recently used
+	assert.Nil(t, rc.get("b"))
+	assert.NotNil(t, rc.get("a"))
+	assert.NotNil(t, rc.get("c"))
+
+	expired := entry("d")
+	expired.Expires = time.Now().Add(-time.Second)
+	expired.Body = []byte("{}")
+	rc.put(expired)
+	assert.Nil(t, rc.get("d"))
+
+	loaded := newResponseCache(cfg, testLogger)
+	assert.NotNil(t, loaded.get("a"))
+	assert.NotNil(t, loaded.get("c"))
+	assert.Len(t, loaded.entries, 2)
+
+	// the lookups do not wait for the disk
+	rc.fileMu.Lock()
+	done := make(chan struct{})
+	go func() {
+		rc.put(entry("e"))
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return rc.get("e") != nil }, 5*time.Second, 10*time.Millisecond)
+	rc.fileMu.Unlock()
+	<-done
+	assert.FileExists(t, filepath.Join(dir, "e.json"))
+	assert.NoFileExists(t, filepath.Join(dir, "a.json"), "evicted")
+}
+
+func TestResponseCache_Store(t *testing.T) {
+	rc := newResponseCache(config.ResponseCacheConfig{Enabled: true, TTL: 60, MaxSizeMB: 1}, testLogger)
+	store := func(key, encoding string) {
+		c, _ := gin.CreateTestContext(CreateTestResponseRecorder())
+		cw := &cacheWriter{ResponseWriter: c.Writer, maxSize: rc.maxSize}
+		cw.Header().Set("Content-Type", "application/json")
+		if encoding != "" {
+			cw.Header().Set("Content-Encoding", encoding)
+		}
+		cw.Write([]byte(`{}`))
+		rc.store(key, "m", cw, 0)
+	}
+	store("plain", "")
+	store("gzip", "gzip")
+	assert.NotNil(t, rc.get("plain"))
+	assert.Nil(t, rc.get("gzip"), "encoded bodies are not cached")
+}
+
+func TestStreamComplete(t *testing.T) {
+	assert.True(t, streamComplete([]byte("data: {\"choices\":[]}\n\ndata: [DONE]\n\n")))
+	assert.True(t, streamComplete([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")))
+	assert.True(t, streamComplete([]byte("event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{}}\n\n")))
+	assert.False(t, streamComplete([]byte("event: response.created\ndata: {\"type\":\"response.created\"}\n\n")))
+	assert.False(t, streamComplete([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"[DONE]\"}}]}\n\n")))
+	assert.False(t, streamComplete(nil))
+}
+
+func TestProxyManager_ResponseCache(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			return
+		}
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if gjson.GetBytes(body, "stream").Bool() {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"hi"}}]}`))
+	}))
+	defer upstream.Close()
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": {Proxy: upstream.URL, CheckEndpoint: "/health"},
+		},
+		ResponseCache: config.ResponseCacheConfig{Enabled: true, TTL: 60, MaxSizeMB: 1},
+		LogLevel:      "error",
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	post := func(body string) *TestResponseRecorder {
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w
+	}
+
+	w := post(`{"model":"model1","temperature":0,"messages":[]}`)
+	assert.Equal(t, "miss", w.Header().Get(responseCacheHeader))
+	w = post(`{"messages":[],"temperature":0,"model":"model1"}`)
+	assert.Equal(t, "hit", w.Header().Get(responseCacheHeader))
+	assert.JSONEq(t, `{"choices":[{"message":{"content":"hi"}}]}`, w.Body.String())
+	assert.Equal(t, int32(1), calls.Load())
+
+	post(`{"model":"model1","temperature":0,"stream":true}`)
+	w = post(`{"model":"model1","temperature":0,"stream":true}`)
+	assert.Equal(t, "hit", w.Header().Get(responseCacheHeader))
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n", w.Body.String())
+	assert.Equal(t, int32(2), calls.Load())
+
+	w = post(`{"model":"model1","temperature":0.5}`)
+	post(`{"model":"model1","temperature":0.5}`)
+	assert.Empty(t, w.Header().Get(responseCacheHeader))
+	assert.Equal(t, int32(4), calls.Load())
+
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	assert.Contains(t, w.Body.String(), `goinfer_response_cache_requests_total{model="model1",result="hit"} 2`)
+	assert.Contains(t, w.Body.String(), `goinfer_response_cache_requests_total{model="model1",result="miss"} 2`)
+}
+
+func TestProxyManager_ResponseCachePeers(t *testing.T) {
+	var calls atomic.Int32
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			return
+		}
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"paid"}}]}`))
+	}))
+	defer provider.Close()
+	providerURL, _ := url.Parse(provider.URL)
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"broken": {Cmd: "nonexistent-command", Proxy: provider.URL, CheckEndpoint: "/health", Fallbacks: []string{"paid"}},
+		},
+		Peers: config.PeerDictionaryConfig{
+			"provider": {Proxy: provider.URL, ProxyURL: providerURL, Models: []string{"paid"}},
+		},
+		ResponseCache: config.ResponseCacheConfig{Enabled: true, TTL: 60, MaxSizeMB: 1},
+		LogLevel:      "error",
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	// the peers may have access rules and costs per API key: their responses are not cached
+	for _, model := range []string{"paid", "paid", "broken", "broken"} {
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+model+`","temperature":0}`)))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "paid", w.Header().Get(servedModelHeader))
+		assert.NotEqual(t, "hit", w.Header().Get(responseCacheHeader))
+	}
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestProxyManager_ResponseCacheLoadingState(t *testing.T) {
+	started := time.Now()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && time.Since(started) < 1500*time.Millisecond {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/v1/chat/completions" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"))
+		}
+	}))
+	defer upstream.Close()
+
+	sendLoadingState := true
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": {Proxy: upstream.URL, CheckEndpoint: "/health", SendLoadingState: &sendLoadingState},
+		},
+		ResponseCache: config.ResponseCacheConfig{Enabled: true, TTL: 60, MaxSizeMB: 1},
+		LogLevel:      "error",
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	post := func() *TestResponseRecorder {
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"model1","temperature":0,"stream":true}`)))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w
+	}
+
+	// the loading state is sent to the first client, not replayed from the cache
+	w := post()
+	assert.Contains(t, w.Body.String(), "reasoning_content")
+	w = post()
+	assert.Equal(t, "hit", w.Header().Get(responseCacheHeader))
+	assert.Equal(t, "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n", w.Body.String())
+}
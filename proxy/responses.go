@@ -0,0 +1,635 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/tidwall/gjson"
+)
+
+// storedResponse is a response kept for GET /v1/responses/:id and previous_response_id.
+type storedResponse struct {
+	expires  time.Time
+	response gin.H            // as returned to the client
+	messages []map[string]any // chat history ending with the response, without the instructions
+}
+
+// responseStore keeps the responses in memory, until their TTL or the oldest beyond max.
+type responseStore struct {
+	responses map[string]*storedResponse
+	order     []string // oldest first, may contain deleted IDs
+	ttl       time.Duration
+	max       int
+	mu        sync.Mutex
+}
+
+// newResponseStore returns nil when /v1/responses is forwarded as is.
+func newResponseStore(cfg *config.Config) *responseStore {
+	if !cfg.Responses.Enabled {
+		return nil
+	}
+	return &responseStore{
+		responses: make(map[string]*storedResponse),
+		ttl:       time.Duration(cfg.Responses.TTL) * time.Second,
+		max:       cfg.Responses.MaxResponses,
+	}
+}
+
+func (rs *responseStore) add(id string, sr *storedResponse) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	sr.expires = time.Now().Add(rs.ttl)
+	rs.responses[id] = sr
+	rs.order = append(rs.order, id)
+	rs.purge()
+}
+
+func (rs *responseStore) get(id string) (*storedResponse, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.purge()
+	sr, found := rs.responses[id]
+	return sr, found
+}
+
+func (rs *responseStore) delete(id string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.purge()
+	_, found := rs.responses[id]
+	delete(rs.responses, id)
+	return found
+}
+
+// purge removes the expired responses and the oldest ones beyond max,
+// the TTL is the same for all so the expired ones are at the front.
+func (rs *responseStore) purge() {
+	now := time.Now()
+	n := 0
+	for _, id := range rs.order {
+		sr, found := rs.responses[id]
+		if found && now.Before(sr.expires) && len(rs.responses) <= rs.max {
+			break
+		}
+		delete(rs.responses, id)
+		n++
+	}
+	rs.order = rs.order[n:]
+}
+
+// responsesCreate serves POST /v1/responses: forwarded as is,
+// or translated to /v1/chat/completions when the responses are enabled.
+func (pm *ProxyManager) responsesCreate(c *gin.Context) {
+	if pm.responses == nil {
+		pm.ProxyInferenceHandler(c)
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil || !gjson.ValidBytes(body) {
+		responsesError(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req := gjson.ParseBytes(body)
+
+	var history []map[string]any
+	if prev := req.Get("previous_response_id").String(); prev != "" {
+		sr, found := pm.responses.get(prev)
+		if !found {
+			responsesError(c, http.StatusBadRequest, fmt.Sprintf("Previous response with id '%s' not found.", prev))
+			return
+		}
+		history = sr.messages
+	}
+	input, err := responsesInput(req.Get("input"))
+	if err != nil {
+		responsesError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	messages := append(slices.Clone(history), input...)
+
+	chat, err := responsesToChat(req, messages)
+	if err != nil {
+		responsesError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rw := &responsesWriter{id: "resp_" + randomHex(12), created: time.Now().Unix(), request: req}
+	rw.translateWriter = newTranslateWriter(c.Writer, rw.event)
+	pm.proxyTranslated(c, "/v1/chat/completions", chat, &rw.translateWriter)
+	rw.finish()
+
+	if rw.status != "" && rw.status != "failed" && rw.store() {
+		pm.responses.add(rw.id, &storedResponse{response: rw.response(), messages: append(messages, rw.assistantMessage())})
+	}
+}
+
+// responsesGet serves GET /v1/responses/:id.
+func (pm *ProxyManager) responsesGet(c *gin.Context) {
+	id := c.Param("id")
+	if pm.responses == nil {
+		responsesError(c, http.StatusNotFound, "the responses are not stored, see responses.enabled")
+		return
+	}
+	sr, found := pm.responses.get(id)
+	if !found {
+		responsesError(c, http.StatusNotFound, fmt.Sprintf("No response found with id '%s'.", id))
+		return
+	}
+	c.JSON(http.StatusOK, sr.response)
+}
+
+// responsesDelete serves DELETE /v1/responses/:id.
+func (pm *ProxyManager) responsesDelete(c *gin.Context) {
+	id := c.Param("id")
+	if pm.responses == nil || !pm.responses.delete(id) {
+		responsesError(c, http.StatusNotFound, fmt.Sprintf("No response found with id '%s'.", id))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "object": "response", "deleted": true})
+}
+
+// responsesError sends an error in the format of the OpenAI API.
+func responsesError(c *gin.Context, status int, message string) {
+	c.JSON(status, responsesErrorBody(status, message))
+}
+
+func responsesErrorBody(status int, message string) gin.H {
+	errType := "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		errType = "server_error"
+	}
+	return gin.H{"error": gin.H{"message": message, "type": errType, "code": nil}}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// responsesInput converts the input items to chat messages.
+func responsesInput(input gjson.Result) ([]map[string]any, error) {
+	if !input.IsArray() {
+		return []map[string]any{{"role": "user", "content": input.String()}}, nil
+	}
+
+	var messages []map[string]any
+	for _, item := range input.Array() {
+		switch t := item.Get("type").String(); t {
+		case "", "message":
+			role := item.Get("role").String()
+			if role == "developer" {
+				role = "system"
+			}
+			content, err := responsesContent(item.Get("content"), role == "user")
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, map[string]any{"role": role, "content": content})
+		case "function_call":
+			toolCall := map[string]any{
+				"id":       item.Get("call_id").String(),
+				"type":     "function",
+				"function": map[string]any{"name": item.Get("name").String(), "arguments": item.Get("arguments").String()},
+			}
+			// the parallel calls belong to the same assistant message
+			if n := len(messages); n > 0 && messages[n-1]["role"] == "assistant" {
+				calls, _ := messages[n-1]["tool_calls"].([]map[string]any)
+				messages[n-1]["tool_calls"] = append(calls, toolCall)
+			} else {
+				messages = append(messages, map[string]any{"role": "assistant", "content": "", "tool_calls": []map[string]any{toolCall}})
+			}
+		case "function_call_output":
+			output := item.Get("output")
+			text := output.String()
+			if output.IsArray() {
+				text = ""
+				for _, part := range output.Array() {
+					text += part.Get("text").String()
+				}
+			}
+			messages = append(messages, map[string]any{"role": "tool", "tool_call_id": item.Get("call_id").String(), "content": text})
+		case "reasoning":
+			// the chat templates drop the previous reasoning
+		default:
+			return nil, fmt.Errorf("unsupported input item type %q", t)
+		}
+	}
+	return messages, nil
+}
+
+// responsesContent converts a message content: a string, or the parts when images are given.
+func responsesContent(content gjson.Result, user bool) (any, error) {
+	if !content.IsArray() {
+		return content.String(), nil
+	}
+	var text strings.Builder
+	var parts []map[string]any
+	images := false
+	for _, part := range content.Array() {
+		switch t := part.Get("type").String(); t {
+		case "input_text", "output_text", "text":
+			text.WriteString(part.Get("text").String())
+			parts = append(parts, map[string]any{"type": "text", "text": part.Get("text").String()})
+		case "input_image":
+			url := part.Get("image_url").String()
+			if !user || url == "" {
+				return nil, errors.New("input_image requires an image_url in a user message")
+			}
+			images = true
+			parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}})
+		case "refusal":
+			text.WriteString(part.Get("refusal").String())
+		default:
+			return nil, fmt.Errorf("unsupported content type %q", t)
+		}
+	}
+	if images {
+		return parts, nil
+	}
+	return text.String(), nil
+}
+
+// responsesToChat converts a Responses request to a chat completions request.
+func responsesToChat(req gjson.Result, messages []map[string]any) ([]byte, error) {
+	if instructions := req.Get("instructions").String(); instructions != "" {
+		messages = append([]map[string]any{{"role": "system", "content": instructions}}, messages...)
+	}
+
+	chat := map[string]any{"model": req.Get("model").String(), "messages": messages}
+	if v := req.Get("max_output_tokens"); v.Exists() && v.Type != gjson.Null {
+		chat["max_tokens"] = v.Int()
+	}
+	for _, key := range []string{"temperature", "top_p", "user", "parallel_tool_calls"} {
+		if v := req.Get(key); v.Exists() && v.Type != gjson.Null {
+			chat[key] = v.Value()
+		}
+	}
+	if req.Get("stream").Bool() {
+		chat["stream"] = true
+		chat["stream_options"] = map[string]any{"include_usage": true}
+	}
+
+	var tools []map[string]any
+	for _, tool := range req.Get("tools").Array() {
+		if t := tool.Get("type").String(); t != "function" {
+			return nil, fmt.Errorf("unsupported tool type %q", t)
+		}
+		function := map[string]any{"name": tool.Get("name").String()}
+		for _, key := range []string{"description", "parameters", "strict"} {
+			if v := tool.Get(key); v.Exists() && v.Type != gjson.Null {
+				function[key] = json.RawMessage(v.Raw)
+			}
+		}
+		tools = append(tools, map[string]any{"type": "function", "function": function})
+	}
+	if tools != nil {
+		chat["tools"] = tools
+	}
+	if choice := req.Get("tool_choice"); choice.Type == gjson.String {
+		chat["tool_choice"] = choice.String()
+	} else if choice.Get("type").String() == "function" {
+		chat["tool_choice"] = map[string]any{"type": "function", "function": map[string]any{"name": choice.Get("name").String()}}
+	}
+
+	format := req.Get("text.format")
+	switch format.Get("type").String() {
+	case "json_object":
+		chat["response_format"] = map[string]any{"type": "json_object"}
+	case "json_schema":
+		schema := map[string]any{"name": format.Get("name").String(), "schema": json.RawMessage(format.Get("schema").Raw)}
+		if strict := format.Get("strict"); strict.Exists() {
+			schema["strict"] = strict.Bool()
+		}
+		chat["response_format"] = map[string]any{"type": "json_schema", "json_schema": schema}
+	}
+
+	return json.Marshal(chat)
+}
+
+// responseItem is an output item: message, reasoning or function_call.
+type responseItem struct {
+	Type      string
+	ID        string
+	Text      string // content, reasoning or arguments
+	CallID    string
+	Name      string
+	toolIndex int64
+}
+
+func (item *responseItem) json(status string) gin.H {
+	switch item.Type {
+	case "reasoning":
+		return gin.H{"type": "reasoning", "id": item.ID, "summary": []any{}, "content": []gin.H{{"type": "reasoning_text", "text": item.Text}}}
+	case "function_call":
+		return gin.H{"type": "function_call", "id": item.ID, "call_id": item.CallID, "name": item.Name, "arguments": item.Text, "status": status}
+	default:
+		content := []gin.H{}
+		if status != "in_progress" {
+			content = append(content, outputText(item.Text))
+		}
+		return gin.H{"type": "message", "id": item.ID, "status": status, "role": "assistant", "content": content}
+	}
+}
+
+func outputText(text string) gin.H {
+	return gin.H{"type": "output_text", "text": text, "annotations": []any{}}
+}
+
+// responsesWriter translates the chat completions responses to the Responses format.
+// The stream is converted to output items with their delta and done events.
+type responsesWriter struct {
+	translateWriter
+	request      gjson.Result
+	err          gin.H
+	open         *responseItem // item receiving the deltas
+	id           string
+	status       string // empty while in progress
+	finishReason string
+	items        []*responseItem
+	created      int64
+	inputTokens  int64
+	outputTokens int64
+	seq          int
+	started      bool // response.created sent
+}
+
+func (rw *responsesWriter) store() bool {
+	store := rw.request.Get("store")
+	return !store.Exists() || store.Bool()
+}
+
+// event translates an SSE event of the upstream stream.
+func (rw *responsesWriter) event(data []byte) {
+	if bytes.Equal(data, []byte("[DONE]")) {
+		rw.complete()
+		return
+	}
+	if rw.status != "" || !gjson.ValidBytes(data) {
+		return
+	}
+
+	chunk := gjson.ParseBytes(data)
+	if e := chunk.Get("error"); e.Exists() {
+		rw.fail(errorMessage(e))
+		return
+	}
+	if !rw.started {
+		rw.started = true
+		rw.writeEvent("response.created", gin.H{"response": rw.response()})
+		rw.writeEvent("response.in_progress", gin.H{"response": rw.response()})
+	}
+	if usage := chunk.Get("usage"); usage.IsObject() {
+		rw.inputTokens = usage.Get("prompt_tokens").Int()
+		rw.outputTokens = usage.Get("completion_tokens").Int()
+	}
+
+	choice := chunk.Get("choices.0")
+	delta := choice.Get("delta")
+	if s := delta.Get("reasoning_content").String(); s != "" {
+		item := rw.openItem("reasoning", 0, delta)
+		item.Text += s
+		rw.writeEvent("response.reasoning_text.delta", gin.H{"item_id": item.ID, "output_index": len(rw.items) - 1, "content_index": 0, "delta": s})
+	}
+	if s := delta.Get("content").String(); s != "" {
+		item := rw.openItem("message", 0, delta)
+		item.Text += s
+		rw.writeEvent("response.output_text.delta", gin.H{"item_id": item.ID, "output_index": len(rw.items) - 1, "content_index": 0, "delta": s})
+	}
+	for _, tc := range delta.Get("tool_calls").Array() {
+		item := rw.openItem("function_call", tc.Get("index").Int(), tc)
+		if args := tc.Get("function.arguments").String(); args != "" {
+			item.Text += args
+			rw.writeEvent("response.function_call_arguments.delta", gin.H{"item_id": item.ID, "output_index": len(rw.items) - 1, "delta": args})
+		}
+	}
+	if fr := choice.Get("finish_reason").String(); fr != "" {
+		rw.finishReason = fr
+	}
+}
+
+// openItem returns the item receiving the delta, closing the previous one when it differs.
+func (rw *responsesWriter) openItem(itemType string, toolIndex int64, delta gjson.Result) *responseItem {
+	if open := rw.open; open != nil && open.Type == itemType &&
+		(itemType != "function_call" || (open.toolIndex == toolIndex && delta.Get("id").String() == "")) {
+		return open
+	}
+	rw.closeItem()
+
+	prefix := map[string]string{"message": "msg_", "reasoning": "rs_", "function_call": "fc_"}[itemType]
+	item := &responseItem{Type: itemType, ID: prefix + randomHex(12), toolIndex: toolIndex}
+	if itemType == "function_call" {
+		item.CallID = delta.Get("id").String()
+		item.Name = delta.Get("function.name").String()
+	}
+	rw.items = append(rw.items, item)
+	rw.open = item
+
+	outputIndex := len(rw.items) - 1
+	rw.writeEvent("response.output_item.added", gin.H{"output_index": outputIndex, "item": item.json("in_progress")})
+	if itemType == "message" {
+		rw.writeEvent("response.content_part.added", gin.H{"item_id": item.ID, "output_index": outputIndex, "content_index": 0, "part": outputText("")})
+	}
+	return item
+}
+
+func (rw *responsesWriter) closeItem() {
+	item := rw.open
+	if item == nil {
+		return
+	}
+	rw.open = nil
+	outputIndex := len(rw.items) - 1
+	switch item.Type {
+	case "message":
+		rw.writeEvent("response.output_text.done", gin.H{"item_id": item.ID, "output_index": outputIndex, "content_index": 0, "text": item.Text})
+		rw.writeEvent("response.content_part.done", gin.H{"item_id": item.ID, "output_index": outputIndex, "content_index": 0, "part": outputText(item.Text)})
+	case "reasoning":
+		rw.writeEvent("response.reasoning_text.done", gin.H{"item_id": item.ID, "output_index": outputIndex, "content_index": 0, "text": item.Text})
+	case "function_call":
+		rw.writeEvent("response.function_call_arguments.done", gin.H{"item_id": item.ID, "output_index": outputIndex, "arguments": item.Text})
+	}
+	rw.writeEvent("response.output_item.done", gin.H{"output_index": outputIndex, "item": item.json("completed")})
+}
+
+// complete ends the stream with the final response.
+func (rw *responsesWriter) complete() {
+	if rw.status != "" || !rw.started {
+		return
+	}
+	rw.closeItem()
+	rw.setStatus()
+	if rw.status == "incomplete" {
+		rw.writeEvent("response.incomplete", gin.H{"response": rw.response()})
+	} else {
+		rw.writeEvent("response.completed", gin.H{"response": rw.response()})
+	}
+}
+
+func (rw *responsesWriter) setStatus() {
+	rw.status = "completed"
+	if rw.finishReason == "length" {
+		rw.status = "incomplete"
+	}
+}
+
+func (rw *responsesWriter) fail(message string) {
+	rw.status = "failed"
+	rw.err = gin.H{"code": "server_error", "message": message}
+	rw.writeEvent("response.failed", gin.H{"response": rw.response()})
+}
+
+// response returns the response object in its current state.
+func (rw *responsesWriter) response() gin.H {
+	req := rw.request
+	output := make([]gin.H, 0, len(rw.items))
+	for _, item := range rw.items {
+		output = append(output, item.json("completed"))
+	}
+	resp := gin.H{
+		"id":                   rw.id,
+		"object":               "response",
+		"created_at":           rw.created,
+		"status":               cmp.Or(rw.status, "in_progress"),
+		"model":                req.Get("model").String(),
+		"output":               output,
+		"error":                rw.err,
+		"incomplete_details":   nil,
+		"instructions":         rawOrNil(req.Get("instructions")),
+		"previous_response_id": rawOrNil(req.Get("previous_response_id")),
+		"max_output_tokens":    rawOrNil(req.Get("max_output_tokens")),
+		"temperature":          rawOrNil(req.Get("temperature")),
+		"top_p":                rawOrNil(req.Get("top_p")),
+		"metadata":             rawOrNil(req.Get("metadata")),
+		"tools":                json.RawMessage(cmp.Or(req.Get("tools").Raw, "[]")),
+		"tool_choice":          json.RawMessage(cmp.Or(req.Get("tool_choice").Raw, `"auto"`)),
+		"parallel_tool_calls":  !req.Get("parallel_tool_calls").Exists() || req.Get("parallel_tool_calls").Bool(),
+		"store":                rw.store(),
+		"usage":                nil,
+	}
+	if rw.status == "incomplete" {
+		resp["incomplete_details"] = gin.H{"reason": "max_output_tokens"}
+	}
+	if rw.status != "" {
+		resp["usage"] = gin.H{
+			"input_tokens":  rw.inputTokens,
+			"output_tokens": rw.outputTokens,
+			"total_tokens":  rw.inputTokens + rw.outputTokens,
+		}
+	}
+	return resp
+}
+
+// assistantMessage is the response as a chat message, for the history.
+func (rw *responsesWriter) assistantMessage() map[string]any {
+	var content strings.Builder
+	var toolCalls []map[string]any
+	for _, item := range rw.items {
+		switch item.Type {
+		case "message":
+			content.WriteString(item.Text)
+		case "function_call":
+			toolCalls = append(toolCalls, map[string]any{
+				"id":       item.CallID,
+				"type":     "function",
+				"function": map[string]any{"name": item.Name, "arguments": item.Text},
+			})
+		}
+	}
+	message := map[string]any{"role": "assistant", "content": content.String()}
+	if toolCalls != nil {
+		message["tool_calls"] = toolCalls
+	}
+	return message
+}
+
+func rawOrNil(v gjson.Result) any {
+	if !v.Exists() {
+		return nil
+	}
+	return json.RawMessage(v.Raw)
+}
+
+// writeEvent sends an SSE event to the client, with its type and sequence number.
+func (rw *responsesWriter) writeEvent(event string, data gin.H) {
+	if !rw.ResponseWriter.Written() {
+		rw.ResponseWriter.Header().Set("Cache-Control", "no-cache")
+		rw.writeHeader(http.StatusOK, "text/event-stream")
+	}
+	data["type"] = event
+	data["sequence_number"] = rw.seq
+	rw.seq++
+	b, _ := json.Marshal(data)
+	fmt.Fprintf(rw.ResponseWriter, "event: %s\ndata: %s\n\n", event, b)
+	rw.ResponseWriter.Flush()
+}
+
+// finish sends the translation of the buffered response, or ends the stream.
+func (rw *responsesWriter) finish() {
+	if rw.sse {
+		rw.endStream()
+		rw.complete()
+		return
+	}
+
+	status := rw.Status()
+	body := rw.body.Bytes()
+	if status != http.StatusOK {
+		msg := strings.TrimSpace(string(body))
+		if gjson.ValidBytes(body) {
+			msg = errorMessage(gjson.GetBytes(body, "error"))
+		}
+		rw.writeJSON(status, responsesErrorBody(status, msg))
+		return
+	}
+	if !gjson.ValidBytes(body) {
+		rw.writeJSON(http.StatusBadGateway, responsesErrorBody(http.StatusBadGateway, "invalid upstream response: "+string(body)))
+		return
+	}
+
+	resp := gjson.ParseBytes(body)
+	message := resp.Get("choices.0.message")
+	if s := message.Get("reasoning_content").String(); s != "" {
+		rw.items = append(rw.items, &responseItem{Type: "reasoning", ID: "rs_" + randomHex(12), Text: s})
+	}
+	if s := message.Get("content").String(); s != "" {
+		rw.items = append(rw.items, &responseItem{Type: "message", ID: "msg_" + randomHex(12), Text: s})
+	}
+	for _, tc := range message.Get("tool_calls").Array() {
+		rw.items = append(rw.items, &responseItem{
+			Type:   "function_call",
+			ID:     "fc_" + randomHex(12),
+			CallID: tc.Get("id").String(),
+			Name:   tc.Get("function.name").String(),
+			Text:   tc.Get("function.arguments").String(),
+		})
+	}
+	rw.finishReason = resp.Get("choices.0.finish_reason").String()
+	rw.inputTokens = resp.Get("usage.prompt_tokens").Int()
+	rw.outputTokens = resp.Get("usage.completion_tokens").Int()
+	rw.setStatus()
+	rw.writeJSON(http.StatusOK, rw.response())
+}
+
+func (rw *responsesWriter) writeJSON(status int, resp gin.H) {
+	b, _ := json.Marshal(resp)
+	rw.writeResponse(status, "application/json", b)
+}
@@ -0,0 +1,206 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestResponses_Store(t *testing.T) {
+	rs := newResponseStore(&config.Config{Responses: config.ResponsesConfig{Enabled: true, TTL: 3600, MaxResponses: 2}})
+	rs.add("a", &storedResponse{})
+	rs.add("b", &storedResponse{})
+	rs.add("c", &storedResponse{})
+	_, found := rs.get("a")
+	assert.False(t, found, "the oldest is evicted beyond max")
+	_, found = rs.get("c")
+	assert.True(t, found)
+
+	assert.True(t, rs.delete("b"))
+	assert.False(t, rs.delete("b"))
+
+	rs.responses["c"].expires = time.Now().Add(-time.Second)
+	_, found = rs.get("c")
+	assert.False(t, found, "expired")
+	assert.Empty(t, rs.order)
+
+	assert.Nil(t, newResponseStore(&config.Config{}))
+}
+
+func TestResponses_Input(t *testing.T) {
+	messages, err := responsesInput(gjson.Parse(`[
+		{"role":"developer","content":"be brief"},
+		{"type":"message","role":"user","content":[{"type":"input_text","text":"look"},{"type":"input_image","image_url":"data:image/png;base64,iVBO"}]},
+		{"type":"reasoning","summary":[]},
+		{"type":"function_call","call_id":"c1","name":"read","arguments":"{}"},
+		{"type":"function_call","call_id":"c2","name":"ls","arguments":"{}"},
+		{"type":"function_call_output","call_id":"c1","output":"42"}
+	]`))
+	require.NoError(t, err)
+	b, _ := json.Marshal(messages)
+	assert.JSONEq(t, `[
+		{"role":"system","content":"be brief"},
+		{"role":"user","content":[{"type":"text","text":"look"},{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBO"}}]},
+		{"role":"assistant","content":"","tool_calls":[
+			{"id":"c1","type":"function","function":{"name":"read","arguments":"{}"}},
+			{"id":"c2","type":"function","function":{"name":"ls","arguments":"{}"}}
+		]},
+		{"role":"tool","tool_call_id":"c1","content":"42"}
+	]`, string(b))
+
+	_, err = responsesInput(gjson.Parse(`[{"type":"item_reference","id":"x"}]`))
+	assert.EqualError(t, err, `unsupported input item type "item_reference"`)
+
+	chat, err := responsesToChat(gjson.Parse(`{
+		"model":"m","instructions":"be brief","max_output_tokens":10,"temperature":0.5,
+		"tools":[{"type":"function","name":"read","parameters":{"type":"object"}}],
+		"tool_choice":{"type":"function","name":"read"},
+		"text":{"format":{"type":"json_schema","name":"out","schema":{"type":"object"},"strict":true}},
+		"stream":true
+	}`), []map[string]any{{"role": "user", "content": "hi"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"model":"m",
+		"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}],
+		"max_tokens":10,
+		"temperature":0.5,
+		"tools":[{"type":"function","function":{"name":"read","parameters":{"type":"object"}}}],
+		"tool_choice":{"type":"function","function":{"name":"read"}},
+		"response_format":{"type":"json_schema","json_schema":{"name":"out","schema":{"type":"object"},"strict":true}},
+		"stream":true,
+		"stream_options":{"include_usage":true}
+	}`, string(chat))
+}
+
+func TestProxyManager_Responses(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, r.URL.Path+" "+string(body))
+		mu.Unlock()
+		if gjson.GetBytes(body, "stream").Bool() {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{
+				`{"choices":[{"delta":{"reasoning_content":"hmm"}}]}`,
+				`{"choices":[{"delta":{"content":"Hel"}}]}`,
+				`{"choices":[{"delta":{"content":"lo"}}]}`,
+				`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"read","arguments":"{}"}}]}}]}`,
+				`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+				`{"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5}}`,
+				`[DONE]`,
+			} {
+				w.Write([]byte("data: " + chunk + "\n\n"))
+				w.(http.Flusher).Flush()
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"Paris"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": {Proxy: upstream.URL, CheckEndpoint: "/health"},
+		},
+		LogLevel:  "error",
+		Responses: config.ResponsesConfig{Enabled: true, TTL: 60, MaxResponses: 10},
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	do := func(method, path, body string) *TestResponseRecorder {
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	// not streamed, stored
+	w := do(http.MethodPost, "/v1/responses", `{"model":"model1","instructions":"be brief","input":"capital of France?"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	first := gjson.Parse(w.Body.String())
+	assert.True(t, strings.HasPrefix(first.Get("id").String(), "resp_"))
+	assert.Equal(t, "completed", first.Get("status").String())
+	assert.Equal(t, "message", first.Get("output.0.type").String())
+	assert.Equal(t, "Paris", first.Get("output.0.content.0.text").String())
+	assert.JSONEq(t, `{"input_tokens":10,"output_tokens":1,"total_tokens":11}`, first.Get("usage").Raw)
+
+	w = do(http.MethodGet, "/v1/responses/"+first.Get("id").String(), "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, first.Raw, w.Body.String())
+
+	// history rebuilt from previous_response_id, without the previous instructions
+	w = do(http.MethodPost, "/v1/responses", `{"model":"model1","stream":true,"previous_response_id":"`+first.Get("id").String()+`","input":"and Spain?"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	mu.Lock()
+	require.Len(t, received, 2)
+	assert.Equal(t, `/v1/chat/completions {"messages":[{"content":"capital of France?","role":"user"},{"content":"Paris","role":"assistant"},{"content":"and Spain?","role":"user"}],"model":"model1","stream":true,"stream_options":{"include_usage":true}}`, received[1])
+	mu.Unlock()
+
+	var types []string
+	var completed gjson.Result
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if data, found := strings.CutPrefix(line, "data: "); found {
+			event := gjson.Parse(data)
+			assert.Equal(t, int64(len(types)), event.Get("sequence_number").Int())
+			types = append(types, event.Get("type").String())
+			if event.Get("type").String() == "response.completed" {
+				completed = event.Get("response")
+			}
+		}
+	}
+	assert.Equal(t, []string{
+		"response.created", "response.in_progress",
+		"response.output_item.added", "response.reasoning_text.delta", "response.reasoning_text.done", "response.output_item.done",
+		"response.output_item.added", "response.content_part.added", "response.output_text.delta", "response.output_text.delta",
+		"response.output_text.done", "response.content_part.done", "response.output_item.done",
+		"response.output_item.added", "response.function_call_arguments.delta", "response.function_call_arguments.done", "response.output_item.done",
+		"response.completed",
+	}, types)
+	assert.Equal(t, "Hello", completed.Get("output.1.content.0.text").String())
+	assert.Equal(t, "call_1", completed.Get("output.2.call_id").String())
+	assert.Equal(t, int64(17), completed.Get("usage.total_tokens").Int())
+
+	// the tool output continues the conversation
+	w = do(http.MethodPost, "/v1/responses", `{"model":"model1","store":false,"previous_response_id":"`+completed.Get("id").String()+`","input":[{"type":"function_call_output","call_id":"call_1","output":"42"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	mu.Lock()
+	assert.Contains(t, received[2], `{"content":"Hello","role":"assistant","tool_calls":[{"function":{"arguments":"{}","name":"read"},"id":"call_1","type":"function"}]},{"content":"42","role":"tool","tool_call_id":"call_1"}`)
+	mu.Unlock()
+	w = do(http.MethodGet, "/v1/responses/"+gjson.Get(w.Body.String(), "id").String(), "")
+	assert.Equal(t, http.StatusNotFound, w.Code, "store: false")
+
+	// delete, unknown IDs
+	w = do(http.MethodDelete, "/v1/responses/"+first.Get("id").String(), "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"`+first.Get("id").String()+`","object":"response","deleted":true}`, w.Body.String())
+	w = do(http.MethodDelete, "/v1/responses/"+first.Get("id").String(), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = do(http.MethodPost, "/v1/responses", `{"model":"model1","previous_response_id":"resp_unknown","input":"hi"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Previous response with id 'resp_unknown' not found.", gjson.Get(w.Body.String(), "error.message").String())
+}
@@ -0,0 +1,263 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/tidwall/gjson"
+)
+
+// slotFileRegex matches the slot files written by slotCache.save.
+var slotFileRegex = regexp.MustCompile(`^[0-9a-f]{16}\.bin$`)
+
+// slotCache keeps each conversation on the same llama-server slot (id_slot),
+// saves the slots used since the start before unloading and restores them after a restart,
+// see config.SlotsConfig.
+type slotCache struct {
+	mu      sync.Mutex
+	cfg     config.SlotsConfig
+	modelID string
+	slots   []slotState
+	live    bool // the server is started and its slots restored, until unload
+	logger  *LogMonitor
+	client  *http.Client
+}
+
+type slotState struct {
+	session  string // conversation using the slot, empty when free
+	lastUsed time.Time
+	busy     int  // in-flight requests, a busy slot is not evicted
+	hot      bool // used since the start, not saved yet
+	reserved bool // being saved and restored, outside sc.mu
+}
+
+func newSlotCache(modelID string, cfg config.SlotsConfig, logger *LogMonitor) *slotCache {
+	if cfg.Count < 1 {
+		return nil
+	}
+	return &slotCache{
+		cfg:     cfg,
+		modelID: modelID,
+		slots:   make([]slotState, cfg.Count),
+		logger:  logger,
+		client:  &http.Client{Timeout: hookTimeout},
+	}
+}
+
+// assign returns the slot of the conversation and the function to call once its request is done:
+// its current slot, a free one or the least recently used idle slot, -1 when all the slots are busy.
+// A new slot gets the saved state of the conversation (e.g. after a Goinfer restart),
+// the conversation evicted from the slot is saved first, the slot is reserved meanwhile.
+func (sc *slotCache) assign(ctx context.Context, proxyURL, session string) (int, func()) {
+	sc.mu.Lock()
+	i := -1
+	for j, s := range sc.slots {
+		if s.session == session {
+			i = j
+			break
+		}
+		if s.busy > 0 || s.reserved {
+			continue
+		}
+		if i == -1 || (sc.slots[i].session != "" && (s.session == "" || s.lastUsed.Before(sc.slots[i].lastUsed))) {
+			i = j
+		}
+	}
+	if i == -1 || sc.slots[i].reserved {
+		sc.mu.Unlock()
+		return -1, func() {}
+	}
+
+	release := func() {
+		sc.mu.Lock()
+		defer sc.mu.Unlock()
+		sc.slots[i].busy--
+	}
+	slot := &sc.slots[i]
+	if slot.session == session {
+		slot.lastUsed = time.Now()
+		slot.hot = true
+		slot.busy++
+		sc.mu.Unlock()
+		return i, release
+	}
+
+	evicted := *slot
+	*slot = slotState{session: session, lastUsed: time.Now(), busy: 1, hot: true}
+	// not live: restored once the server is started
+	if sc.cfg.SavePath == "" || !sc.live {
+		sc.mu.Unlock()
+		return i, release
+	}
+	slot.reserved = true
+	sc.mu.Unlock()
+
+	if evicted.hot {
+		sc.saveSlot(ctx, proxyURL, i, evicted.session)
+	}
+	sc.restoreSlot(ctx, proxyURL, i, session)
+
+	sc.mu.Lock()
+	sc.slots[i].reserved = false
+	sc.mu.Unlock()
+	return i, release
+}
+
+// filename of the saved slot of a conversation, in the --slot-save-path directory.
+func (sc *slotCache) filename(session string) string {
+	h := fnv.New64a()
+	h.Write([]byte(sc.modelID))
+	h.Write([]byte{0})
+	h.Write([]byte(session))
+	return fmt.Sprintf("%016x.bin", h.Sum64())
+}
+
+// save writes the slots used since the start to disk, then deletes the oldest files beyond maxDiskMB.
+func (sc *slotCache) save(ctx context.Context, proxyURL string) {
+	if sc.cfg.SavePath == "" {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for i, s := range sc.slots {
+		if s.hot && !s.reserved && sc.saveSlot(ctx, proxyURL, i, s.session) {
+			sc.slots[i].hot = false
+		}
+	}
+	sc.trim()
+}
+
+// restore loads the saved slots of the conversations assigned to the slots.
+func (sc *slotCache) restore(ctx context.Context, proxyURL string) {
+	if sc.cfg.SavePath == "" {
+		return
+	}
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for i, s := range sc.slots {
+		if s.session != "" {
+			sc.restoreSlot(ctx, proxyURL, i, s.session)
+		}
+	}
+	sc.live = true
+}
+
+// unload is called once the server is stopped.
+func (sc *slotCache) unload() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.live = false
+}
+
+// saveSlot writes the conversation of the slot i to disk, it reports whether it was saved.
+func (sc *slotCache) saveSlot(ctx context.Context, proxyURL string, i int, session string) bool {
+	n, err := sc.action(ctx, proxyURL, i, "save", sc.filename(session))
+	if err != nil {
+		sc.logger.Warnf("<%s> Failed to save slot %d: %v", sc.modelID, i, err)
+		return false
+	}
+	sc.logger.Infof("<%s> Saved slot %d (%d tokens)", sc.modelID, i, n)
+	return true
+}
+
+// restoreSlot loads the saved state of the conversation into the slot i, if any.
+func (sc *slotCache) restoreSlot(ctx context.Context, proxyURL string, i int, session string) {
+	name := sc.filename(session)
+	if _, err := os.Stat(filepath.Join(sc.cfg.SavePath, name)); err != nil {
+		return // never saved or deleted by trim
+	}
+	n, err := sc.action(ctx, proxyURL, i, "restore", name)
+	if err != nil {
+		sc.logger.Warnf("<%s> Failed to restore slot %d: %v", sc.modelID, i, err)
+		return
+	}
+	sc.logger.Infof("<%s> Restored slot %d (%d tokens)", sc.modelID, i, n)
+}
+
+// action calls POST /slots/<id>?action=save|restore, it returns the number of tokens saved or restored.
+func (sc *slotCache) action(ctx context.Context, proxyURL string, slot int, action, filename string) (int64, error) {
+	slotURL, err := url.JoinPath(proxyURL, "slots", strconv.Itoa(slot))
+	if err != nil {
+		return 0, err
+	}
+	body := `{"filename":"` + filename + `"}`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, slotURL+"?action="+action, strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status code %d: %s", resp.StatusCode, gjson.GetBytes(b, "error.message").String())
+	}
+	if action == "restore" {
+		return gjson.GetBytes(b, "n_restored").Int(), nil
+	}
+	return gjson.GetBytes(b, "n_saved").Int(), nil
+}
+
+// trim deletes the oldest saved slots while their total size exceeds maxDiskMB.
+func (sc *slotCache) trim() {
+	maxBytes := int64(cmp.Or(sc.cfg.MaxDiskMB, 4096)) << 20
+
+	var files []fs.FileInfo
+	var total int64
+	entries, err := os.ReadDir(sc.cfg.SavePath)
+	if err != nil {
+		sc.logger.Warnf("<%s> Failed to list the saved slots: %v", sc.modelID, err)
+		return
+	}
+	for _, entry := range entries {
+		if !slotFileRegex.MatchString(entry.Name()) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			files = append(files, info)
+			total += info.Size()
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, info := range files {
+		if total <= maxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(sc.cfg.SavePath, info.Name())); err != nil {
+			sc.logger.Warnf("<%s> Failed to delete the saved slot %s: %v", sc.modelID, info.Name(), err)
+			continue
+		}
+		total -= info.Size()
+		sc.logger.Debugf("<%s> Deleted the saved slot %s (maxDiskMB)", sc.modelID, info.Name())
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestSlotCache_Assign(t *testing.T) {
+	assert.Nil(t, newSlotCache("m", config.SlotsConfig{}, testLogger))
+
+	sc := newSlotCache("m", config.SlotsConfig{Count: 2}, testLogger)
+	assign := func(session string) int {
+		slot, release := sc.assign(t.Context(), "", session)
+		release()
+		return slot
+	}
+	assert.Equal(t, 0, assign("a"))
+	assert.Equal(t, 1, assign("b"))
+	assert.Equal(t, 0, assign("a"))
+	assert.Equal(t, 1, assign("c"), "the least recently used slot")
+	assert.Equal(t, 0, assign("b"))
+	assert.NotEqual(t, sc.filename("a"), sc.filename("b"))
+
+	// a busy slot is not evicted, no slot when all are busy
+	slot, releaseB := sc.assign(t.Context(), "", "b")
+	assert.Equal(t, 0, slot)
+	assert.Equal(t, 1, assign("c"))
+	slot, releaseD := sc.assign(t.Context(), "", "d")
+	assert.Equal(t, 1, slot, "the least recently used slot is busy")
+	slot, _ = sc.assign(t.Context(), "", "e")
+	assert.Equal(t, -1, slot)
+	slot, releaseB2 := sc.assign(t.Context(), "", "b")
+	assert.Equal(t, 0, slot, "shared by the requests of the conversation")
+	releaseB()
+	releaseB2()
+	releaseD()
+	assert.Equal(t, 1, assign("e"))
+}
+
+func TestSlotCache_AssignOutsideLock(t *testing.T) {
+	saving := make(chan struct{})
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(saving)
+		<-release
+		w.Write([]byte(`{"n_saved":30000}`))
+	}))
+	defer upstream.Close()
+
+	sc := newSlotCache("m", config.SlotsConfig{Count: 2, SavePath: t.TempDir()}, testLogger)
+	sc.live = true
+	for _, session := range []string{"a", "b"} {
+		_, done := sc.assign(t.Context(), upstream.URL, session)
+		done()
+	}
+
+	// "a" is saved while the other slot is used
+	assigned := make(chan int)
+	go func() {
+		slot, done := sc.assign(t.Context(), upstream.URL, "c")
+		done()
+		assigned <- slot
+	}()
+	<-saving
+	slot, done := sc.assign(t.Context(), upstream.URL, "b")
+	assert.Equal(t, 1, slot)
+	done()
+	slot, _ = sc.assign(t.Context(), upstream.URL, "c")
+	assert.Equal(t, -1, slot, "reserved while saved")
+	close(release)
+	assert.Equal(t, 0, <-assigned)
+}
+
+func TestSlotCache_Trim(t *testing.T) {
+	dir := t.TempDir()
+	sc := newSlotCache("m", config.SlotsConfig{Count: 1, SavePath: dir, MaxDiskMB: 1}, testLogger)
+	for i, name := range []string{"0000000000000001.bin", "0000000000000002.bin", "0000000000000003.bin"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, make([]byte, 400<<10), 0o600))
+		mtime := time.Now().Add(time.Duration(i-3) * time.Minute)
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.bin"), make([]byte, 1<<20), 0o600))
+
+	sc.trim()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"0000000000000002.bin", "0000000000000003.bin", "other.bin"}, names)
+}
+
+func TestProxyManager_Slots(t *testing.T) {
+	dir := t.TempDir()
+	var mu sync.Mutex
+	var calls []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/v1/chat/completions":
+			calls = append(calls, "chat "+gjson.GetBytes(body, "id_slot").Raw)
+			w.Write([]byte(`{}`))
+		case strings.HasPrefix(r.URL.Path, "/slots/"):
+			action := r.URL.Query().Get("action")
+			filename := gjson.GetBytes(body, "filename").String()
+			calls = append(calls, action+" "+strings.TrimPrefix(r.URL.Path, "/slots/"))
+			if action == "save" { // written by llama-server in --slot-save-path
+				os.WriteFile(filepath.Join(dir, filename), []byte("kv"), 0o600)
+				w.Write([]byte(`{"id_slot":0,"n_saved":30000}`))
+				return
+			}
+			w.Write([]byte(`{"id_slot":0,"n_restored":30000}`))
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"model1": {Proxy: upstream.URL, CheckEndpoint: "/health", Slots: config.SlotsConfig{Count: 2, SavePath: dir}},
+		},
+		StickyKeys: []string{"user"},
+		LogLevel:   "error",
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	post := func(body string) {
+		w := CreateTestResponseRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	post(`{"model":"model1","user":"alice"}`)
+	post(`{"model":"model1","user":"bob"}`)
+	post(`{"model":"model1","user":"alice"}`)
+	post(`{"model":"model1"}`)
+
+	// the used slots are saved before unloading, restored after the restart
+	proxy.StopProcesses(StopWaitForInflightRequest)
+	post(`{"model":"model1","user":"bob"}`)
+
+	took := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		c := calls
+		calls = nil
+		return c
+	}
+	assert.Equal(t, []string{
+		"chat 0", "chat 1", "chat 0", "chat ",
+		"save 0", "save 1",
+		"restore 0", "restore 1",
+		"chat 1",
+	}, took())
+
+	// saved on shutdown, restored when assigned after the Goinfer restart
+	post(`{"model":"model1","user":"carol"}`)
+	proxy.Shutdown()
+	assert.Equal(t, []string{"chat 0", "save 0", "save 1"}, took())
+
+	proxy = New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+	post(`{"model":"model1","user":"carol"}`)
+	post(`{"model":"model1","user":"alice"}`)
+	assert.Equal(t, []string{"restore 0", "chat 0", "restore 1", "chat 1"}, took())
+
+	// the evicted conversation is saved first
+	post(`{"model":"model1","user":"dave"}`)
+	assert.Equal(t, []string{"save 0", "chat 0"}, took())
+}
@@ -0,0 +1,441 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lynxai-team/goinfer/proxy/config"
+)
+
+// Minimal OpenTelemetry tracing: W3C trace context propagation and an OTLP/HTTP exporter
+// using the JSON encoding, see https://opentelemetry.io/docs/specs/otlp/#otlphttp
+
+// OTLP span kinds and status codes.
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+
+	spanStatusError = 2
+)
+
+const (
+	traceExportInterval = 2 * time.Second
+	traceBatchSize      = 256
+	traceMaxPending     = 4096 // spans are dropped beyond, when the collector is down
+)
+
+// requests not worth a trace: health checks, scrapes, UI and long-lived streams
+var untracedPaths = []string{"/health", "/wol-health", "/metrics", "/favicon.ico", "/ui", "/api/events", "/logs/stream"}
+
+type spanAttribute struct {
+	key   string
+	value any
+}
+
+// span is nil when tracing is disabled, all its methods accept a nil receiver.
+type span struct {
+	tracer   *tracer
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    []spanAttribute
+	errMsg   string
+	kind     int
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+	mu       sync.Mutex
+}
+
+type spanCtxKey struct{}
+
+func spanFromContext(ctx context.Context) *span {
+	s, _ := ctx.Value(spanCtxKey{}).(*span)
+	return s
+}
+
+// startSpan starts a child of the span in ctx, it returns a nil span when ctx is not traced.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	parent := spanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := &span{
+		tracer:   parent.tracer,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+		traceID:  parent.traceID,
+		parentID: parent.spanID,
+		sampled:  parent.sampled,
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanCtxKey{}, s), s
+}
+
+func (s *span) setAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, spanAttribute{key, value})
+}
+
+// finish ends the span, err sets the error status.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.end = time.Now()
+	if err != nil {
+		s.errMsg = err.Error()
+	}
+	s.mu.Unlock()
+	if s.sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+// setTokenMetrics records the token counts of the request, using the GenAI semantic conventions.
+func (s *span) setTokenMetrics(tm TokenMetrics) {
+	if s == nil {
+		return
+	}
+	s.setAttr("gen_ai.usage.input_tokens", tm.InputTokens)
+	s.setAttr("gen_ai.usage.output_tokens", tm.OutputTokens)
+	if tm.CachedTokens >= 0 {
+		s.setAttr("gen_ai.usage.cached_tokens", tm.CachedTokens)
+	}
+	if tm.TTFTMs >= 0 {
+		s.setAttr("goinfer.ttft_ms", tm.TTFTMs)
+	}
+}
+
+// traceparent returns the W3C header value with this span as parent.
+func (s *span) traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-" + flags
+}
+
+// injectTraceparent propagates the trace context of ctx to an outgoing request.
+func injectTraceparent(ctx context.Context, header http.Header) {
+	if s := spanFromContext(ctx); s != nil {
+		header.Set("Traceparent", s.traceparent())
+	}
+}
+
+// parseTraceparent parses version 00 of the W3C traceparent header.
+func parseTraceparent(value string) (traceID [16]byte, parentID [8]byte, sampled, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || parentID == [8]byte{} {
+		return traceID, parentID, false, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return traceID, parentID, false, false
+	}
+	return traceID, parentID, flags&1 == 1, true
+}
+
+// tracer batches the finished spans and exports them to the OTLP collector.
+type tracer struct {
+	client      *http.Client
+	headers     map[string]string
+	logger      *LogMonitor
+	done        chan struct{}
+	url         string
+	serviceName string
+	pending     []*span
+	stopOnce    sync.Once
+	exportMu    sync.Mutex // one export at a time
+	mu          sync.Mutex
+}
+
+// newTracer returns nil if tracing is not configured.
+func newTracer(cfg config.TracingConfig, logger *LogMonitor) *tracer {
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	t := &tracer{
+		client:      &http.Client{Timeout: 10 * time.Second},
+		headers:     cfg.Headers,
+		logger:      logger,
+		done:        make(chan struct{}),
+		url:         strings.TrimSuffix(cfg.Endpoint, "/") + "/v1/traces",
+		serviceName: cfg.ServiceName,
+	}
+	go t.exportLoop()
+	return t
+}
+
+// startServerSpan starts the root span of an incoming request,
+// child of the caller span when the request has a valid traceparent header.
+func (t *tracer) startServerSpan(r *http.Request, name string) (context.Context, *span) {
+	s := &span{tracer: t, name: name, kind: spanKindServer, start: time.Now(), sampled: true}
+	if traceID, parentID, sampled, ok := parseTraceparent(r.Header.Get("Traceparent")); ok {
+		s.traceID, s.parentID, s.sampled = traceID, parentID, sampled
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(r.Context(), spanCtxKey{}, s), s
+}
+
+func (t *tracer) enqueue(s *span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pending) >= traceMaxPending {
+		return
+	}
+	t.pending = append(t.pending, s)
+}
+
+func (t *tracer) exportLoop() {
+	ticker := time.NewTicker(traceExportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.flush()
+		}
+	}
+}
+
+// flush exports the pending spans, by batches of traceBatchSize.
+func (t *tracer) flush() {
+	t.exportMu.Lock()
+	defer t.exportMu.Unlock()
+	for {
+		t.mu.Lock()
+		batch := t.pending[:min(len(t.pending), traceBatchSize)]
+		t.pending = t.pending[len(batch):]
+		t.mu.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(batch); err != nil {
+			t.logger.Warnf("tracing: dropping %d spans: %v", len(batch), err)
+			return
+		}
+	}
+}
+
+// shutdown stops the export loop and exports the remaining spans.
+func (t *tracer) shutdown() {
+	if t == nil {
+		return
+	}
+	t.stopOnce.Do(func() {
+		close(t.done)
+		t.flush()
+	})
+}
+
+func (t *tracer) export(batch []*span) error {
+	body, err := json.Marshal(t.otlpRequest(batch))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP/JSON: the IDs are hex strings and the 64-bit integers are strings.
+type (
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpStatus struct {
+		Message string `json:"message,omitempty"`
+		Code    int    `json:"code,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+		Kind              int             `json:"kind"`
+	}
+	otlpScopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpResourceSpans struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpTraceRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+)
+
+func newOTLPAttribute(key string, value any) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case string:
+		a.Value.StringValue = &v
+	case int:
+		i := strconv.Itoa(v)
+		a.Value.IntValue = &i
+	case int64:
+		i := strconv.FormatInt(v, 10)
+		a.Value.IntValue = &i
+	case float64:
+		a.Value.DoubleValue = &v
+	case bool:
+		a.Value.BoolValue = &v
+	default:
+		str := fmt.Sprint(v)
+		a.Value.StringValue = &str
+	}
+	return a
+}
+
+func (t *tracer) otlpRequest(batch []*span) otlpTraceRequest {
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(batch))}
+	scope.Scope.Name = "github.com/lynxai-team/goinfer/proxy"
+	for _, s := range batch {
+		s.mu.Lock()
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parentID != [8]byte{} {
+			out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for _, a := range s.attrs {
+			out.Attributes = append(out.Attributes, newOTLPAttribute(a.key, a.value))
+		}
+		if s.errMsg != "" {
+			out.Status = otlpStatus{Code: spanStatusError, Message: s.errMsg}
+		}
+		s.mu.Unlock()
+		scope.Spans = append(scope.Spans, out)
+	}
+
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	rs.Resource.Attributes = []otlpAttribute{newOTLPAttribute("service.name", t.serviceName)}
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
+
+// realModelName is RealModelName recorded in the trace of ctx.
+func (pm *ProxyManager) realModelName(ctx context.Context, requestedModel string) (string, bool) {
+	_, span := startSpan(ctx, "resolve model", spanKindInternal)
+	modelID, found := pm.cfg.Swap.RealModelName(requestedModel)
+	span.setAttr("gen_ai.request.model", requestedModel)
+	span.setAttr("goinfer.model", modelID)
+	span.finish(nil)
+	return modelID, found
+}
+
+// swapProcessGroupTraced is swapProcessGroup recorded in the trace of ctx.
+func (pm *ProxyManager) swapProcessGroupTraced(ctx context.Context, modelID string) (*ProcessGroup, error) {
+	_, span := startSpan(ctx, "swap process group", spanKindInternal)
+	span.setAttr("goinfer.model", modelID)
+	processGroup, err := pm.swapProcessGroup(ctx, modelID)
+	span.finish(err)
+	return processGroup, err
+}
+
+// traceRequests is a middleware starting the root span of the request.
+func (pm *ProxyManager) traceRequests(c *gin.Context) {
+	path := c.Request.URL.Path
+	if pm.tracer == nil || hasAnyPrefix(untracedPaths, path) {
+		c.Next()
+		return
+	}
+
+	route := c.FullPath()
+	if route == "" {
+		route = path
+	}
+	ctx, root := pm.tracer.startServerSpan(c.Request, c.Request.Method+" "+route)
+	root.setAttr("http.request.method", c.Request.Method)
+	root.setAttr("url.path", path)
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+
+	status := c.Writer.Status()
+	root.setAttr("http.response.status_code", status)
+	if modelID, _ := c.Request.Context().Value(proxyCtxKey("model")).(string); modelID != "" {
+		root.setAttr("gen_ai.request.model", modelID)
+	}
+	var err error
+	if status >= http.StatusInternalServerError {
+		err = fmt.Errorf("HTTP %d", status)
+	}
+	root.finish(err)
+}
+
+func hasAnyPrefix(prefixes []string, path string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracing_ParseTraceparent(t *testing.T) {
+	traceID, parentID, sampled, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", fmt.Sprintf("%x", traceID))
+	assert.Equal(t, "00f067aa0ba902b7", fmt.Sprintf("%x", parentID))
+	assert.True(t, sampled)
+
+	_, _, sampled, ok = parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.True(t, ok)
+	assert.False(t, sampled)
+
+	for _, invalid := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", // unknown version
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01", // zero trace ID
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", // zero parent ID
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",  // short trace ID
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bz-01", // not hex
+	} {
+		_, _, _, ok := parseTraceparent(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestTracing_DisabledSpans(t *testing.T) {
+	// without a root span, the spans are nil and their methods are no-op
+	ctx, s := startSpan(t.Context(), "noop", spanKindInternal)
+	assert.Nil(t, s)
+	s.setAttr("k", 1)
+	s.setTokenMetrics(TokenMetrics{})
+	s.finish(nil)
+	header := http.Header{}
+	injectTraceparent(ctx, header)
+	assert.Empty(t, header.Get("Traceparent"))
+	var tr *tracer
+	tr.shutdown()
+}
+
+// otlpCollector is a local stand-in of an OpenTelemetry collector.
+type otlpCollector struct {
+	spans []otlpSpan
+	mu    sync.Mutex
+}
+
+func (oc *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Collector-Token") != "t0k3n" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	var req otlpTraceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			oc.spans = append(oc.spans, ss.Spans...)
+		}
+	}
+	w.Write([]byte("{}"))
+}
+
+func (oc *otlpCollector) byName() map[string]otlpSpan {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	result := make(map[string]otlpSpan, len(oc.spans))
+	for _, s := range oc.spans {
+		result[s.Name] = s
+	}
+	return result
+}
+
+func spanAttr(s otlpSpan, key string) string {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			switch {
+			case a.Value.StringValue != nil:
+				return *a.Value.StringValue
+			case a.Value.IntValue != nil:
+				return *a.Value.IntValue
+			}
+		}
+	}
+	return ""
+}
+
+func TestTracing_ProxyRequest(t *testing.T) {
+	collector := &otlpCollector{}
+	collectorServer := httptest.NewServer(collector)
+	defer collectorServer.Close()
+
+	var upstreamTraceparent string
+	var mu sync.Mutex
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/chat/completions" {
+			mu.Lock()
+			upstreamTraceparent = r.Header.Get("Traceparent")
+			mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"usage":{"prompt_tokens":12,"completion_tokens":34}}`))
+		}
+	}))
+	defer upstream.Close()
+
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"traced": {Proxy: upstream.URL, CheckEndpoint: "/health"},
+		},
+		LogLevel:        "error",
+		RequiredAPIKeys: []string{"sk-trace"},
+		Tracing: config.TracingConfig{
+			Endpoint:    collectorServer.URL,
+			ServiceName: "goinfer-test",
+			Headers:     map[string]string{"X-Collector-Token": "t0k3n"},
+		},
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"traced"}`))
+	req.Header.Set("Authorization", "Bearer sk-trace")
+	req.Header.Set("Traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	proxy.tracer.flush()
+	spans := collector.byName()
+	for _, name := range []string{"POST /v1/chat/completions", "auth", "resolve model", "swap process group", "process start", "health check", "upstream traced"} {
+		require.Contains(t, spans, name)
+		assert.Equal(t, traceID, spans[name].TraceID, name)
+	}
+
+	root := spans["POST /v1/chat/completions"]
+	assert.Equal(t, "00f067aa0ba902b7", root.ParentSpanID, "the incoming traceparent is the parent")
+	assert.Equal(t, spanKindServer, root.Kind)
+	assert.Equal(t, "200", spanAttr(root, "http.response.status_code"))
+	assert.Equal(t, "12", spanAttr(root, "gen_ai.usage.input_tokens"))
+	assert.Equal(t, "34", spanAttr(root, "gen_ai.usage.output_tokens"))
+
+	assert.Equal(t, root.SpanID, spans["auth"].ParentSpanID)
+	assert.Equal(t, spans["process start"].SpanID, spans["health check"].ParentSpanID)
+	assert.Equal(t, "traced", spanAttr(spans["swap process group"], "goinfer.model"))
+
+	mu.Lock()
+	assert.Equal(t, "00-"+traceID+"-"+spans["upstream traced"].SpanID+"-01", upstreamTraceparent, "llama-server continues the trace")
+	mu.Unlock()
+
+	// the health checks are not traced
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", http.NoBody))
+	proxy.tracer.flush()
+	assert.Len(t, collector.byName(), len(spans))
+}
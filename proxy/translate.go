@@ -0,0 +1,145 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// translateWriter receives the upstream response of a translated request (Ollama, Anthropic):
+// the SSE data payloads are given to event while streaming, the other responses are buffered.
+// The upstream headers are kept apart, the client gets its own Content-Type and Content-Length.
+type translateWriter struct {
+	gin.ResponseWriter                   // the client
+	header             http.Header       // of the upstream response
+	event              func(data []byte) // data of an SSE event, including [DONE]
+	line               []byte            // partial SSE line
+	body               bytes.Buffer      // not streamed responses
+	size               int
+	status             int
+	sse                bool // the upstream response is streamed
+}
+
+func newTranslateWriter(client gin.ResponseWriter, event func(data []byte)) translateWriter {
+	return translateWriter{ResponseWriter: client, header: make(http.Header), event: event}
+}
+
+// proxyTranslated sends the translated request to ProxyInferenceHandler, the response goes to tw.
+func (pm *ProxyManager) proxyTranslated(c *gin.Context, path string, body []byte, tw *translateWriter) {
+	c.Request.URL.Path = path
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.Header.Del("Accept-Encoding") // the responses are translated
+
+	client := c.Writer
+	c.Writer = tw
+	pm.ProxyInferenceHandler(c)
+	c.Writer = client
+}
+
+func (tw *translateWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *translateWriter) WriteHeader(statusCode int) {
+	if tw.status == 0 {
+		tw.status = statusCode
+	}
+}
+
+// WriteHeaderNow is deferred to the translated response.
+func (tw *translateWriter) WriteHeaderNow() {}
+
+func (tw *translateWriter) Status() int {
+	if tw.status == 0 {
+		return http.StatusOK
+	}
+	return tw.status
+}
+
+func (tw *translateWriter) Written() bool {
+	return tw.status != 0
+}
+
+// Size is the size of the upstream response, for the metrics.
+func (tw *translateWriter) Size() int {
+	return tw.size
+}
+
+func (tw *translateWriter) WriteString(s string) (int, error) {
+	return tw.Write([]byte(s))
+}
+
+func (tw *translateWriter) Write(b []byte) (int, error) {
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	if tw.size == 0 {
+		tw.sse = tw.status == http.StatusOK && strings.Contains(tw.header.Get("Content-Type"), "text/event-stream")
+	}
+	tw.size += len(b)
+	if !tw.sse {
+		tw.body.Write(b)
+		return len(b), nil
+	}
+
+	tw.line = append(tw.line, b...)
+	start := 0
+	for {
+		i := bytes.IndexByte(tw.line[start:], '\n')
+		if i < 0 {
+			break
+		}
+		tw.sseLine(tw.line[start : start+i])
+		start += i + 1
+	}
+	tw.line = append(tw.line[:0], tw.line[start:]...)
+	return len(b), nil
+}
+
+// endStream parses the last line of a stream ending without line feed.
+func (tw *translateWriter) endStream() {
+	if len(tw.line) > 0 {
+		tw.sseLine(tw.line)
+		tw.line = tw.line[:0]
+	}
+}
+
+func (tw *translateWriter) sseLine(line []byte) {
+	if data, found := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:")); found {
+		tw.event(bytes.TrimSpace(data))
+	}
+}
+
+func (tw *translateWriter) Flush() {
+	if tw.ResponseWriter.Written() {
+		tw.ResponseWriter.Flush()
+	}
+}
+
+// writeHeader sends the client headers, with the capture ID of the upstream request and the served model.
+func (tw *translateWriter) writeHeader(status int, contentType string) {
+	for _, name := range []string{captureIDHeader, servedModelHeader} {
+		if value := tw.header.Get(name); value != "" {
+			tw.ResponseWriter.Header().Set(name, value)
+		}
+	}
+	tw.ResponseWriter.Header().Set("Content-Type", contentType)
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+// writeResponse sends a complete translated response.
+func (tw *translateWriter) writeResponse(status int, contentType string, b []byte) {
+	tw.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	tw.writeHeader(status, contentType)
+	tw.ResponseWriter.Write(b)
+}
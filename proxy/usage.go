@@ -0,0 +1,162 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UsageTotals aggregates the token metrics of a group of requests.
+// The averages only count the requests reporting the value.
+type UsageTotals struct {
+	Key                string  `json:"key,omitempty"` // model, day (YYYY-MM-DD), API key identifier or peer
+	Requests           int     `json:"requests"`
+	InputTokens        int64   `json:"input_tokens"`
+	OutputTokens       int64   `json:"output_tokens"`
+	CachedTokens       int64   `json:"cache_tokens"`
+	TotalTokens        int64   `json:"total_tokens"`
+	CostUSD            float64 `json:"cost_usd"` // spent on the remote providers
+	AvgPromptPerSecond float64 `json:"avg_prompt_per_second"`
+	AvgTokensPerSecond float64 `json:"avg_tokens_per_second"`
+	AvgDurationMs      float64 `json:"avg_duration_ms"`
+
+	promptSpeeds, tokenSpeeds int
+}
+
+func (u *UsageTotals) add(tm TokenMetrics) {
+	u.Requests++
+	u.InputTokens += int64(max(tm.InputTokens, 0))
+	u.OutputTokens += int64(max(tm.OutputTokens, 0))
+	u.CachedTokens += int64(max(tm.CachedTokens, 0))
+	u.TotalTokens = u.InputTokens + u.OutputTokens
+	u.CostUSD += tm.CostUSD
+
+	// running averages
+	if tm.PromptPerSecond > 0 {
+		u.promptSpeeds++
+		u.AvgPromptPerSecond += (tm.PromptPerSecond - u.AvgPromptPerSecond) / float64(u.promptSpeeds)
+	}
+	if tm.TokensPerSecond > 0 {
+		u.tokenSpeeds++
+		u.AvgTokensPerSecond += (tm.TokensPerSecond - u.AvgTokensPerSecond) / float64(u.tokenSpeeds)
+	}
+	u.AvgDurationMs += (float64(tm.DurationMs) - u.AvgDurationMs) / float64(u.Requests)
+}
+
+// UsageReport is the response of /api/usage.
+type UsageReport struct {
+	From    *time.Time    `json:"from,omitempty"`
+	To      *time.Time    `json:"to,omitempty"`
+	GroupBy string        `json:"group_by"`
+	Groups  []UsageTotals `json:"groups"`
+	Total   UsageTotals   `json:"total"`
+}
+
+// usageGroupKeys returns the group key of a metric.
+var usageGroupKeys = map[string]func(TokenMetrics) string{
+	"model": func(tm TokenMetrics) string { return tm.Model },
+	"day":   func(tm TokenMetrics) string { return tm.Timestamp.Local().Format(time.DateOnly) },
+	"key": func(tm TokenMetrics) string {
+		if tm.APIKey == "" {
+			return "none" // no API key required
+		}
+		return tm.APIKey
+	},
+	"peer": func(tm TokenMetrics) string {
+		if tm.Peer == "" {
+			return "local"
+		}
+		return tm.Peer
+	},
+}
+
+// queryUsage aggregates the metrics in [from, to) from the store,
+// or from the in-memory history when the store is disabled.
+func (mp *metricsMonitor) queryUsage(from, to time.Time, groupBy string) (UsageReport, error) {
+	report := UsageReport{GroupBy: groupBy, Groups: []UsageTotals{}}
+	if !from.IsZero() {
+		report.From = &from
+	}
+	if !to.IsZero() {
+		report.To = &to
+	}
+
+	groupKey := usageGroupKeys[groupBy]
+	groups := make(map[string]*UsageTotals)
+	add := func(tm TokenMetrics) {
+		key := groupKey(tm)
+		if groups[key] == nil {
+			groups[key] = &UsageTotals{Key: key}
+		}
+		groups[key].add(tm)
+		report.Total.add(tm)
+	}
+
+	if mp.store != nil {
+		err := mp.store.query(from, to, add)
+		if err != nil {
+			return report, err
+		}
+	} else {
+		for _, tm := range mp.getMetrics() {
+			if (from.IsZero() || !tm.Timestamp.Before(from)) && (to.IsZero() || tm.Timestamp.Before(to)) {
+				add(tm)
+			}
+		}
+	}
+
+	for _, g := range groups {
+		report.Groups = append(report.Groups, *g)
+	}
+	slices.SortFunc(report.Groups, func(a, b UsageTotals) int { return strings.Compare(a.Key, b.Key) })
+	return report, nil
+}
+
+// parseUsageTime accepts RFC 3339 or a date (YYYY-MM-DD) in local time.
+// A date used as upper bound includes the whole day.
+func parseUsageTime(value string, upper bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		if upper {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// apiGetUsage handles /api/usage?from=&to=&group_by=model|day|key|peer
+func (pm *ProxyManager) apiGetUsage(c *gin.Context) {
+	from, err := parseUsageTime(c.Query("from"), false)
+	if err != nil {
+		pm.sendErrorResponse(c, http.StatusBadRequest, "invalid from, expected YYYY-MM-DD or RFC 3339: "+err.Error())
+		return
+	}
+	to, err := parseUsageTime(c.Query("to"), true)
+	if err != nil {
+		pm.sendErrorResponse(c, http.StatusBadRequest, "invalid to, expected YYYY-MM-DD or RFC 3339: "+err.Error())
+		return
+	}
+
+	groupBy := c.DefaultQuery("group_by", "model")
+	if _, ok := usageGroupKeys[groupBy]; !ok {
+		pm.sendErrorResponse(c, http.StatusBadRequest, "invalid group_by, expected model, day, key or peer")
+		return
+	}
+
+	report, err := pm.metricsMonitor.queryUsage(from, to, groupBy)
+	if err != nil {
+		pm.sendErrorResponse(c, http.StatusInternalServerError, "failed to read the metrics: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,99 @@
+// Copyright 2025 The contributors of Goinfer.
+// This file is part of Goinfer, a LLM proxy under the MIT License.
+// SPDX-License-Identifier: MIT
+
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lynxai-team/goinfer/conf"
+	"github.com/lynxai-team/goinfer/proxy/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsage_QueryGroups(t *testing.T) {
+	mm := newMetricsMonitor(testLogger, 10)
+	day1 := time.Date(2026, 9, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	mm.addMetrics(TokenMetrics{Timestamp: day1, Model: "a", APIKey: "key-1", InputTokens: 100, OutputTokens: 10, CachedTokens: -1, PromptPerSecond: 100, TokensPerSecond: 10, DurationMs: 1000})
+	mm.addMetrics(TokenMetrics{Timestamp: day1, Model: "b", APIKey: "key-2", InputTokens: 50, OutputTokens: 5, CachedTokens: 20, PromptPerSecond: -1, TokensPerSecond: -1, DurationMs: 500})
+	mm.addMetrics(TokenMetrics{Timestamp: day2, Model: "a", InputTokens: 200, OutputTokens: 20, CachedTokens: 0, PromptPerSecond: 300, TokensPerSecond: 30, DurationMs: 2000})
+
+	report, err := mm.queryUsage(time.Time{}, time.Time{}, "model")
+	require.NoError(t, err)
+	require.Len(t, report.Groups, 2)
+	a := report.Groups[0]
+	assert.Equal(t, "a", a.Key)
+	assert.Equal(t, 2, a.Requests)
+	assert.Equal(t, int64(300), a.InputTokens)
+	assert.Equal(t, int64(330), a.TotalTokens)
+	assert.InDelta(t, 200, a.AvgPromptPerSecond, 0.001)
+	assert.InDelta(t, 20, a.AvgTokensPerSecond, 0.001)
+	assert.InDelta(t, 1500, a.AvgDurationMs, 0.001)
+	assert.Equal(t, 3, report.Total.Requests)
+	assert.Equal(t, int64(20), report.Total.CachedTokens)
+
+	report, err = mm.queryUsage(time.Time{}, time.Time{}, "key")
+	require.NoError(t, err)
+	keys := []string{}
+	for _, g := range report.Groups {
+		keys = append(keys, g.Key)
+	}
+	assert.Equal(t, []string{"key-1", "key-2", "none"}, keys)
+
+	report, err = mm.queryUsage(day2, time.Time{}, "day")
+	require.NoError(t, err)
+	require.Len(t, report.Groups, 1)
+	assert.Equal(t, "2026-09-02", report.Groups[0].Key)
+}
+
+func TestProxyManager_UsageEndpoint(t *testing.T) {
+	cfg := conf.DefaultCfg()
+	cfg.Swap = &config.Config{
+		HealthCheckTimeout: 15,
+		Models: map[string]*config.ModelConfig{
+			"usage-model": getTestSimpleResponderConfig("usage-model"),
+		},
+		LogLevel:        "error",
+		RequiredAPIKeys: []string{"team-key"},
+		MetricsStore:    config.MetricsStoreConfig{Dir: t.TempDir(), MaxSizeMB: 1},
+	}
+	cfg.Swap.AddDefaultGroupToConfig()
+
+	proxy := New(cfg)
+	defer proxy.StopProcesses(StopWaitForInflightRequest)
+	require.NotNil(t, proxy.metricsMonitor.store)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"usage-model","stream":true}`))
+	req.Header.Set("Authorization", "Bearer team-key")
+	w := CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	today := time.Now().Format(time.DateOnly)
+	req = httptest.NewRequest(http.MethodGet, "/api/usage?from="+today+"&to="+today+"&group_by=key", http.NoBody)
+	req.Header.Set("Authorization", "Bearer team-key")
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var report UsageReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	require.Len(t, report.Groups, 1)
+	assert.Equal(t, apiKeyID("team-key"), report.Groups[0].Key)
+	assert.NotContains(t, w.Body.String(), "team-key", "the API key is never exposed")
+	assert.Equal(t, 1, report.Total.Requests)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/usage?group_by=week", http.NoBody)
+	req.Header.Set("Authorization", "Bearer team-key")
+	w = CreateTestResponseRecorder()
+	proxy.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
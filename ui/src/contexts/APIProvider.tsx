@@ -1,7 +1,7 @@
 import { createContext, useState, useContext, useEffect, useCallback, useMemo, type ReactNode } from "react";
 import type { ConnectionState } from "../lib/types";
 
-type ModelStatus = "ready" | "starting" | "stopping" | "stopped" | "shutdown" | "unknown";
+type ModelStatus = "ready" | "starting" | "stopping" | "unhealthy" | "stopped" | "shutdown" | "unknown";
 const LOG_LENGTH_LIMIT = 1024 * 100; /* 100KB of log data */
 
 export interface Model {